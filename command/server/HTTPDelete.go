@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+func (h *HttpServer) deleteAnnotation(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		annotationID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid annotation id")
+			return
+		}
+
+		if err := h.db.deleteAnnotation(ctx, annotationID); err != nil {
+			h.writeError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *HttpServer) deleteKeepOutZone(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		zoneID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid keep-out zone id")
+			return
+		}
+
+		if err := removeKeepOutZone(ctx, h.db, zoneID); err != nil {
+			h.writeError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *HttpServer) deleteMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
+
+		if err := h.db.deleteMap(ctx, mapID); err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *HttpServer) deleteUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		if err := deleteUser(ctx, h.db, username); err != nil {
+			h.writeError(w, r, userErrorStatus(err), err.Error())
+			return
+		}
+		h.credentials.invalidate()
+		h.auditEvent(r, "user deleted", zap.String("targetUser", username))
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -6,10 +6,15 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
 )
 
 type staticTestData struct {
@@ -30,136 +35,455 @@ type energy struct {
 }
 
 func (h *HttpServer) connect(w http.ResponseWriter, req *http.Request) {
-	status := h.mqtt.getIsConnected()
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-
-	if err := json.NewEncoder(w).Encode(status); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
-
-	w.WriteHeader(http.StatusOK)
-
+	h.writeJSON(w, req, http.StatusOK, h.mqtt.getIsConnected())
 }
 
 func (h *HttpServer) battery(w http.ResponseWriter, req *http.Request) {
 
 }
 
-func check(w http.ResponseWriter, req *http.Request) {
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-
+func (h *HttpServer) check(w http.ResponseWriter, req *http.Request) {
 	data := staticTestData{
 		Info: "Some static test data",
 		Data: []int{
 			1, 2, 3, 4, 5,
 		},
 	}
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	h.writeJSON(w, req, http.StatusOK, data)
+}
+
+func (h *HttpServer) updateWebMap(w http.ResponseWriter, req *http.Request) {
+	h.writeJSON(w, req, http.StatusOK, Map)
+}
+
+func (h *HttpServer) updateRover(w http.ResponseWriter, req *http.Request) {
+	h.writeJSON(w, req, http.StatusOK, Rover)
+}
+
+func (h *HttpServer) loadMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.writeJSON(w, r, http.StatusOK, dbMap)
+
+		// clearning instruction log
+		var empty []driveInstruction
+		dbMap.Instructions = empty
 	}
+}
+
+func (h *HttpServer) getFeed(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.writeJSON(w, r, http.StatusOK, feed)
 
-	w.WriteHeader(http.StatusOK)
+		// clearing feed
+		var empty string
+		feed = empty
+	}
 }
 
-func (h *HttpServer) updateWebMap(w http.ResponseWriter, req *http.Request) {
+func (h *HttpServer) getEnergyStatus(w http.ResponseWriter, req *http.Request) {
+	h.writeJSON(w, req, http.StatusOK, currentEnergy)
+}
+
+func (h *HttpServer) getIsAuthorised(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Tokens were checked when they were issued so no password comparison is needed
+		if token, ok := bearerToken(r); ok {
+			claims, err := h.tokens.verifyAccessToken(token, time.Now())
+			if err != nil {
+				h.writeJSON(w, r, http.StatusOK, false)
+				return
+			}
+
+			// Like the token middleware, users that were disabled or removed are no longer authorised
+			_, userExists, err := h.credentials.lookup(r.Context(), claims.Username)
+			if err != nil {
+				h.requestLogger(r).Error("server: HTTPGet: failed to look up credentials", zap.Error(err))
+				h.writeError(w, r, http.StatusInternalServerError, "failed to look up credentials")
+				return
+			}
+			h.writeJSON(w, r, http.StatusOK, userExists)
+			return
+		}
+
+		data := true
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			data = false
+		} else if _, retryAfter, err := h.authenticate(ctx, r, username, password); err != nil {
+			if h.loginError(w, r, retryAfter, err) {
+				return
+			}
+			data = false
+		}
+
+		h.writeJSON(w, r, http.StatusOK, data)
+	}
+}
+
+// Exports a saved map in the format given by the "format" query parameter (json by default)
+func (h *HttpServer) exportMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = mapFormatJSON
+		}
+
+		m, err := h.db.getMap(ctx, mapID)
+		if err != nil {
+			h.writeError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+
+		data, contentType, extension, err := encodeMap(m.tileMap(), format)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-	data := Map
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="map_%d.%s"`, mapID, extension))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(data); err != nil {
+			h.requestLogger(r).Error("server: HTTPGet: failed to write exported map")
+		}
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+func (h *HttpServer) getGroundTruths(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := h.db.getGroundTruthNames(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, names)
+	}
 }
 
-func (h *HttpServer) updateRover(w http.ResponseWriter, req *http.Request) {
+// Scores a saved map against the ground truth given by the "truth" query parameter
+func (h *HttpServer) scoreSavedMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		score, err := scoreSavedMapByID(ctx, h.db, mapID, r.URL.Query().Get("truth"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-	data := Rover
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeJSON(w, r, http.StatusOK, score)
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+// Scores the live map against the ground truth given by the "truth" query parameter
+func (h *HttpServer) scoreLiveMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groundTruth, err := h.db.getGroundTruth(ctx, r.URL.Query().Get("truth"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		score, err := scoreMap(Map, groundTruth, discovery)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, score)
+	}
 }
 
-func (h *HttpServer) loadMap(ctx context.Context) http.HandlerFunc {
+/*
+	Revisions can be given either as a revision id or as an RFC3339 timestamp (latest revision at that time).
+	An empty string returns defaultRevision.
+*/
+func (h *HttpServer) parseRevision(ctx context.Context, value string, defaultRevision int) (int, error) {
+	if value == "" {
+		return defaultRevision, nil
+	}
+
+	if revisionID, err := strconv.Atoi(value); err == nil {
+		return revisionID, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return -1, fmt.Errorf("server: HTTPGet: invalid revision %q: must be a revision id or RFC3339 timestamp", value)
+	}
+
+	return h.db.getRevisionIDAtTime(ctx, t)
+}
+
+// Returns the "from" and "to" query parameters as revision ids (defaults: first and latest revision)
+func (h *HttpServer) parseRevisionRange(ctx context.Context, r *http.Request) (int, int, error) {
+	latestRevisionID, err := h.db.getLatestRevisionID(ctx)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	from, err := h.parseRevision(ctx, r.URL.Query().Get("from"), 0)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	to, err := h.parseRevision(ctx, r.URL.Query().Get("to"), latestRevisionID)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	if from > to {
+		return -1, -1, errors.New("server: HTTPGet: from revision must not be after to revision")
+	}
+
+	return from, to, nil
+}
+
+// Lists the tile revisions after "from" up to and including "to"
+func (h *HttpServer) getMapRevisions(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := h.parseRevisionRange(ctx, r)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		revisions, err := h.db.getTileRevisions(ctx, from, to)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 
-		data := dbMap
-		if err := json.NewEncoder(w).Encode(data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeJSON(w, r, http.StatusOK, revisions)
+	}
+}
+
+type revisionMap struct {
+	RevisionID int `json:"revisionID"`
+	tileMap
+}
+
+// Returns the live map as it was at the revision given by the "at" query parameter (default: latest)
+func (h *HttpServer) getMapAtRevision(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		latestRevisionID, err := h.db.getLatestRevisionID(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
 		}
 
-		// clearning instruction log
-		var empty []driveInstruction
-		dbMap.Instructions = empty
+		revisionID, err := h.parseRevision(ctx, r.URL.Query().Get("at"), latestRevisionID)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		w.WriteHeader(http.StatusOK)
+		m, err := mapAtRevision(ctx, h.db, revisionID)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, revisionMap{
+			RevisionID: revisionID,
+			tileMap:    m,
+		})
 	}
 }
 
-func (h *HttpServer) getFeed(ctx context.Context) http.HandlerFunc {
+// Returns all tiles that differ between the maps at the "from" and "to" revisions
+func (h *HttpServer) getMapRevisionDiff(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		from, to, err := h.parseRevisionRange(ctx, r)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		data := feed
-		if err := json.NewEncoder(w).Encode(data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		fromMap, err := mapAtRevision(ctx, h.db, from)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		toMap, err := mapAtRevision(ctx, h.db, to)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if fromMap.Rows != toMap.Rows || fromMap.Cols != toMap.Cols {
+			h.writeError(w, r, http.StatusBadRequest, "maps at the from and to revisions have different dimensions")
+			return
 		}
 
-		// clearing feed
-		var empty string
-		feed = empty
+		h.writeJSON(w, r, http.StatusOK, diffTileMaps(fromMap, toMap))
+	}
+}
 
-		w.WriteHeader(http.StatusOK)
+func (h *HttpServer) getReplayStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, http.StatusOK, getReplayStatus())
+}
+
+func (h *HttpServer) getAnnotations(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		annotations, err := h.db.getAnnotations(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, annotations)
 	}
 }
 
-func (h *HttpServer) getEnergyStatus(w http.ResponseWriter, req *http.Request) {
+func (h *HttpServer) getKeepOutZones(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, http.StatusOK, keepOutZones)
+}
 
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+func (h *HttpServer) getSavedKeepOutZones(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
 
-	if err := json.NewEncoder(w).Encode(currentEnergy); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		zones, err := h.db.getKeepOutZones(ctx, mapID)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, zones)
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+func (h *HttpServer) getMaps(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		maps, err := h.db.getMaps(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 
+		h.writeJSON(w, r, http.StatusOK, maps)
+	}
 }
 
-func (h *HttpServer) getIsAuthorised(creds map[string]string) http.HandlerFunc {
+func (h *HttpServer) getMap(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
 
-		data := true
+		m, err := h.db.getMap(ctx, mapID)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
 
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			data = false
+		h.writeJSON(w, r, http.StatusOK, m)
+	}
+}
+
+func (h *HttpServer) getMissions(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		missions, err := h.db.getMissions(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
 		}
 
-		passwordHash, userExists := creds[username]
-		if !userExists {
-			data = false
+		h.writeJSON(w, r, http.StatusOK, missions)
+	}
+}
+
+func (h *HttpServer) getCurrentMission(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, http.StatusOK, currentMission)
+}
+
+type user struct {
+	Username string `json:"username"`
+	Role     role   `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+func (h *HttpServer) getUsers(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		creds, err := h.credentials.getAll(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
 		}
 
-		passwordHashBytes := []byte(passwordHash)
-		passwordBytes := []byte(password)
-		if err := bcrypt.CompareHashAndPassword(passwordHashBytes, passwordBytes); err != nil {
-			data = false
+		users := []user{}
+		for _, cred := range creds {
+			users = append(users, user{
+				Username: cred.username,
+				Role:     cred.role,
+				Disabled: cred.disabled,
+			})
+		}
+		sort.Slice(users, func(i, j int) bool {
+			return users[i].Username < users[j].Username
+		})
+
+		h.writeJSON(w, r, http.StatusOK, users)
+	}
+}
+
+/*
+	Returns recorded state-changing API calls, newest first.
+	Filtered by the username, path (prefix), from, to (RFC3339) and limit query parameters.
+	The "format" query parameter selects json (default) or csv.
+*/
+func (h *HttpServer) getAuditRecords(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
 		}
 
-		if err := json.NewEncoder(w).Encode(data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			h.writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown format %q (json or csv)", format))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		records, err := h.db.getAuditRecords(ctx, filter)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+			w.WriteHeader(http.StatusOK)
+			if err := writeAuditCSV(w, records); err != nil {
+				h.requestLogger(r).Error("server: HTTPGet: failed to write audit csv")
+			}
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, records)
 	}
 }
+
+// Config the server was started with, secrets are redacted
+func (h *HttpServer) getConfig(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, http.StatusOK, h.config.redacted())
+}
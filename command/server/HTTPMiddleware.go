@@ -5,48 +5,365 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
 )
 
-func allowOriginFunc(r *http.Request, origin string) bool {
-	// Allow all without checking origin
+type contextKey string
+
+// Username and role of the authenticated user
+const (
+	usernameContextKey contextKey = "username"
+	roleContextKey     contextKey = "role"
+)
+
+/*
+	Browsers only let the websites of allowed origins (e.g. "https://spacexpp.co.uk") read responses of the API.
+	Other websites could still send requests with the cached basic auth credentials of a logged-in user (CSRF),
+	so state-changing requests must additionally pass csrfProtection.
+*/
+var (
+	corsAllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsAllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Requested-With", requestIDHeader}
+)
+
+const corsMaxAge = 10 * time.Minute
+
+// Sets the origins of websites that may use the API from a browser
+func (h *HttpServer) SetAllowedOrigins(origins []string) error {
+	allowed, err := parseAllowedOrigins(origins)
+	if err != nil {
+		return err
+	}
+
+	h.allowedOrigins = allowed
+	return nil
+}
+
+func parseAllowedOrigins(origins []string) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return nil, fmt.Errorf("server: HTTPMiddleware: invalid origin %q (expected scheme://host[:port])", origin)
+		}
+		allowed[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+	return allowed, nil
+}
+
+func (h *HttpServer) allowOrigin(r *http.Request, origin string) bool {
+	return h.allowedOrigins[strings.ToLower(origin)]
+}
+
+// Rejects preflight requests that the CORS handler would not allow instead of answering them with an empty 200
+func (h *HttpServer) strictPreflight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || requestedMethod == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !h.allowOrigin(r, r.Header.Get("Origin")) {
+			h.writeError(w, r, http.StatusForbidden, "Origin not allowed")
+			return
+		}
+		if !containsFold(corsAllowedMethods, requestedMethod) {
+			h.writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !containsFold(corsAllowedHeaders, header) {
+				h.writeError(w, r, http.StatusForbidden, "Header not allowed: "+header)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Headers that tell browsers to only use HTTPS, to never render or frame responses of the API
+	and to not guess content types. The Webpage sets its own content security policy.
+*/
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+	CSRF protection of state-changing requests (everything except GET, HEAD and OPTIONS).
+	Requests sent by a browser from a website that is not allowed are rejected.
+	Requests that are authenticated with basic auth or a client certificate (which browsers attach automatically) must also set
+	the X-Requested-With header, which other websites can only set after a preflight request that is rejected.
+	Bearer tokens are never attached automatically so those requests don't need the header.
+*/
+func (h *HttpServer) csrfProtection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && !h.allowOrigin(r, origin) {
+			h.auditEvent(r, "cross-site request rejected", zap.String("origin", origin))
+			h.writeError(w, r, http.StatusForbidden, "Origin not allowed")
+			return
+		}
+
+		if _, ok := bearerToken(r); !ok && r.Header.Get("X-Requested-With") == "" {
+			h.auditEvent(r, "cross-site request rejected", zap.String("reason", "missing X-Requested-With header"))
+			h.writeError(w, r, http.StatusForbidden, "X-Requested-With header required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+var (
+	errLoginFailed = errors.New("server: HTTPMiddleware: invalid username or password")
+	errLoginLocked = errors.New("server: HTTPMiddleware: too many failed login attempts")
+)
+
+// Compared against when the user does not exist so that unknown users take as long to fail as wrong passwords
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+/*
+	Checks a username and password, limited by the login limiter.
+	Returns errLoginLocked and the time to wait if the client or username is locked out.
+	Unknown users, disabled users and incorrect passwords all return errLoginFailed so that usernames can't be enumerated.
+*/
+func (h *HttpServer) authenticate(ctx context.Context, r *http.Request, username string, password string) (credential, time.Duration, error) {
+	ip := clientIP(r)
+
+	if wait := h.loginLimiter.retryAfter(ip, username, time.Now()); wait > 0 {
+		h.auditEvent(r, "login locked out", zap.String("loginUsername", username), zap.Duration("retryAfter", wait))
+		return credential{}, wait, errLoginLocked
+	}
+
+	cred, userExists, err := h.credentials.lookup(ctx, username)
+	if err != nil {
+		return credential{}, 0, fmt.Errorf("server: HTTPMiddleware: failed to look up credentials: %w", err)
+	}
+
+	passwordHash := cred.password
+	if !userExists {
+		dummyPasswordHashOnce.Do(func() {
+			dummyPasswordHash, _ = hashPassword("dummy password")
+		})
+		passwordHash = dummyPasswordHash
+	}
+
+	if err := verifyPassword(passwordHash, password); err != nil || !userExists {
+		h.loginLimiter.failed(ip, username, time.Now())
+		h.auditEvent(r, "login failed", zap.String("loginUsername", username))
+		return credential{}, 0, errLoginFailed
+	}
+
+	h.loginLimiter.succeeded(username)
+	return cred, 0, nil
+}
+
+// Responds to errors of authenticate except errLoginFailed which every caller responds to in its own way.
+// Returns false if the error was errLoginFailed.
+func (h *HttpServer) loginError(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, err error) bool {
+	switch {
+	case errors.Is(err, errLoginFailed):
+		return false
+	case errors.Is(err, errLoginLocked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		h.writeError(w, r, http.StatusTooManyRequests, "Too many failed login attempts")
+	default:
+		h.requestLogger(r).Error("server: HTTPMiddleware: authentication failed", zap.Error(err))
+		h.writeError(w, r, http.StatusInternalServerError, "failed to look up credentials")
+	}
 	return true
 }
 
-func (h *HttpServer) basicAuth(realm string, creds map[string]string) func(next http.Handler) http.Handler {
+func (h *HttpServer) basicAuth(realm string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			username, password, ok := r.BasicAuth()
 			if !ok {
-				h.basicAuthFailed(w, realm, "Authentication failed")
+				h.basicAuthFailed(w, r, realm, "Authentication failed")
 				return
 			}
 
-			passwordHash, userExists := creds[username]
-			if !userExists {
-				h.basicAuthFailed(w, realm, fmt.Sprintf("Invalid username: %v", username))
+			cred, retryAfter, err := h.authenticate(r.Context(), r, username, password)
+			if err != nil {
+				if !h.loginError(w, r, retryAfter, err) {
+					h.basicAuthFailed(w, r, realm, "Invalid username or password")
+				}
+				return
+			}
+
+			// Authorised
+			setAuditAuthenticated(r, username)
+			ctx := context.WithValue(r.Context(), usernameContextKey, username)
+			ctx = context.WithValue(ctx, roleContextKey, cred.role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Credentials that a group of private routes accepts
+type authPolicy int
+
+const (
+	authPassword             authPolicy = iota // bearer access token or basic auth
+	authPasswordOrClientCert                   // also a client certificate (see client_certs.go)
+)
+
+/*
+	Accepts a bearer access token (see tokens.go) or basic auth credentials.
+	If the policy allows it, requests without an Authorization header may authenticate with a client certificate instead.
+*/
+func (h *HttpServer) auth(realm string, policy authPolicy) func(next http.Handler) http.Handler {
+	basicAuth := h.basicAuth(realm)
+
+	return func(next http.Handler) http.Handler {
+		basicAuthNext := basicAuth(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				if user, ok := h.clientCerts.user(r); ok && policy == authPasswordOrClientCert && r.Header.Get("Authorization") == "" {
+					// Authorised
+					setAuditAuthenticated(r, user.Username)
+					ctx := context.WithValue(r.Context(), usernameContextKey, user.Username)
+					ctx = context.WithValue(ctx, roleContextKey, user.Role)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+
+				basicAuthNext.ServeHTTP(w, r)
 				return
 			}
 
-			passwordHashBytes := []byte(passwordHash)
-			passwordBytes := []byte(password)
-			if err := bcrypt.CompareHashAndPassword(passwordHashBytes, passwordBytes); err != nil {
-				h.basicAuthFailed(w, realm, "Incorrect password")
+			claims, err := h.tokens.verifyAccessToken(token, time.Now())
+			if err != nil {
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s", error="invalid_token"`, realm))
+				h.writeError(w, r, http.StatusUnauthorized, "Invalid access token")
+
+				h.requestLogger(r).Info("HTTP token auth failed: " + err.Error())
+				return
+			}
+
+			// Users that were disabled or removed lose access immediately, role changes apply immediately
+			cred, userExists, err := h.credentials.lookup(r.Context(), claims.Username)
+			if err != nil {
+				h.requestLogger(r).Error("server: HTTPMiddleware: failed to look up credentials", zap.Error(err))
+				h.writeError(w, r, http.StatusInternalServerError, "failed to look up credentials")
+				return
+			}
+			if !userExists {
+				w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s", error="invalid_token"`, realm))
+				h.writeError(w, r, http.StatusUnauthorized, "User disabled or removed")
+
+				h.requestLogger(r).Info("HTTP token auth failed: user disabled or removed: " + claims.Username)
 				return
 			}
 
 			// Authorised
-			next.ServeHTTP(w, r)
+			setAuditAuthenticated(r, cred.username)
+			ctx := context.WithValue(r.Context(), usernameContextKey, cred.username)
+			ctx = context.WithValue(ctx, roleContextKey, cred.role)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func (h *HttpServer) basicAuthFailed(w http.ResponseWriter, realm string, msg string) {
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return authorization[len(prefix):], true
+}
+
+func (h *HttpServer) basicAuthFailed(w http.ResponseWriter, r *http.Request, realm string, msg string) {
 	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
-	http.Error(w, msg, http.StatusUnauthorized)
+	h.writeError(w, r, http.StatusUnauthorized, msg)
+
+	h.requestLogger(r).Info("HTTP auth failed: " + msg)
+}
+
+// Returns the username of the authenticated user (empty string for public routes)
+func getUsername(r *http.Request) string {
+	username, _ := r.Context().Value(usernameContextKey).(string)
+	return username
+}
 
-	h.logger.Info("HTTP auth failed: " + msg)
+// Returns the role of the authenticated user (empty role for public routes)
+func getRole(r *http.Request) role {
+	userRole, _ := r.Context().Value(roleContextKey).(role)
+	return userRole
+}
+
+// Must be used after an authentication middleware
+// Rejects routes that drive the rover or change the live map while a replay owns the live map
+func (h *HttpServer) rejectDuringReplay(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReplayRunning() {
+			h.writeError(w, r, http.StatusConflict, "not available while a replay is running")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *HttpServer) requireRole(required role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !getRole(r).includes(required) {
+				h.auditEvent(r, "access denied", zap.String("role", string(getRole(r))), zap.String("requiredRole", string(required)))
+				h.writeError(w, r, http.StatusForbidden, fmt.Sprintf("Role %v required", required))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
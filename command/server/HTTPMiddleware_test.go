@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSetAllowedOrigins(t *testing.T) {
+	type test struct {
+		origins     []string
+		origin      string
+		expected    bool
+		expectError bool
+	}
+
+	tests := []test{
+		{[]string{"https://spacexpp.co.uk"}, "https://spacexpp.co.uk", true, false},
+		{[]string{"https://SpaceXpp.co.uk/"}, "https://spacexpp.co.uk", true, false},
+		{[]string{"https://spacexpp.co.uk", " http://localhost:8080"}, "http://localhost:8080", true, false},
+		{[]string{"https://spacexpp.co.uk"}, "http://spacexpp.co.uk", false, false},
+		{[]string{"https://spacexpp.co.uk"}, "https://evil.example", false, false},
+		{[]string{""}, "", false, false},
+		{[]string{"spacexpp.co.uk"}, "", false, true},
+		{[]string{"https://spacexpp.co.uk/map"}, "", false, true},
+		{[]string{"ftp://spacexpp.co.uk"}, "", false, true},
+	}
+
+	for _, test := range tests {
+		h := &HttpServer{}
+		err := h.SetAllowedOrigins(test.origins)
+		if (err != nil) != test.expectError {
+			t.Errorf("SetAllowedOrigins(%q) returned error %v, expected error: %v", test.origins, err, test.expectError)
+			continue
+		}
+
+		output := h.allowOrigin(nil, test.origin)
+		if output != test.expected {
+			t.Errorf("Origin %q allowed by %q not equal to expected value.\nOutput: %v\nExpected: %v", test.origin, test.origins, output, test.expected)
+		}
+	}
+}
+
+func TestCSRFProtection(t *testing.T) {
+	type test struct {
+		method   string
+		headers  map[string]string
+		expected int
+	}
+
+	tests := []test{
+		{http.MethodGet, map[string]string{"Origin": "https://evil.example"}, http.StatusOK},
+		{http.MethodPost, map[string]string{}, http.StatusForbidden},
+		{http.MethodPost, map[string]string{"X-Requested-With": "XMLHttpRequest"}, http.StatusOK},
+		{http.MethodPost, map[string]string{"X-Requested-With": "XMLHttpRequest", "Origin": "https://spacexpp.co.uk"}, http.StatusOK},
+		{http.MethodPost, map[string]string{"X-Requested-With": "XMLHttpRequest", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{http.MethodDelete, map[string]string{"Authorization": "Bearer token"}, http.StatusOK},
+		{http.MethodPut, map[string]string{"Authorization": "Bearer token", "Origin": "https://evil.example"}, http.StatusForbidden},
+	}
+
+	h := &HttpServer{logger: zap.NewNop()}
+	if err := h.SetAllowedOrigins([]string{"https://spacexpp.co.uk"}); err != nil {
+		t.Fatalf("SetAllowedOrigins returned error: %v", err)
+	}
+	handler := h.csrfProtection(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/drive/distance", nil)
+		for header, value := range test.headers {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expected {
+			t.Errorf("Status of %v request with headers %v not equal to expected status.\nOutput status: %v\nExpected status: %v", test.method, test.headers, w.Code, test.expected)
+		}
+	}
+}
+
+func TestStrictPreflight(t *testing.T) {
+	type test struct {
+		origin   string
+		method   string
+		headers  string
+		expected int
+	}
+
+	tests := []test{
+		{"https://spacexpp.co.uk", "POST", "authorization, content-type, x-requested-with", http.StatusOK},
+		{"https://evil.example", "POST", "authorization", http.StatusForbidden},
+		{"", "POST", "", http.StatusForbidden},
+		{"https://spacexpp.co.uk", "PATCH", "", http.StatusMethodNotAllowed},
+		{"https://spacexpp.co.uk", "POST", "x-pingother", http.StatusForbidden},
+	}
+
+	h := &HttpServer{logger: zap.NewNop()}
+	if err := h.SetAllowedOrigins([]string{"https://spacexpp.co.uk"}); err != nil {
+		t.Fatalf("SetAllowedOrigins returned error: %v", err)
+	}
+	handler := h.strictPreflight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodOptions, "/map/reset", nil)
+		r.Header.Set("Origin", test.origin)
+		r.Header.Set("Access-Control-Request-Method", test.method)
+		r.Header.Set("Access-Control-Request-Headers", test.headers)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expected {
+			t.Errorf("Status of preflight from %q for %v %q not equal to expected status.\nOutput status: %v\nExpected status: %v", test.origin, test.method, test.headers, w.Code, test.expected)
+		}
+	}
+}
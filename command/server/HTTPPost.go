@@ -6,105 +6,116 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
 )
 
+type replayRequest struct {
+	MissionID int     `json:"missionID"`
+	Speed     float64 `json:"speed"`
+}
+
+func (r replayRequest) validate() error {
+	if r.MissionID <= 0 {
+		return &validationError{"missionID", "is required"}
+	}
+	return validateReplaySpeed(r.Speed)
+}
+
 type coordinates struct {
 	X    int `json:"x"`
 	Y    int `json:"y"`
 	Mode int `json:"mode"`
 }
 
-func (h *HttpServer) driveD(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-
-	var t int
-	if err := decoder.Decode(&t); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-	}
+func (c coordinates) validate() error {
+	return validateTarget(c.X, c.Y, c.Mode, Map)
+}
 
-	w.WriteHeader(http.StatusOK)
+// Target of the webpage, mode autonomousTargetMode starts autonomous mode instead of driving to the target
+type webpageTarget coordinates
 
-	instruction := []driveInstruction{}
+const autonomousTargetMode = 3
 
-	instruction = append(instruction, driveInstruction{
-		Instruction: "forward",
-		Value:       t,
-	})
+func (h *HttpServer) driveD(w http.ResponseWriter, r *http.Request) {
+	var t int
+	if !h.decodeRequest(w, r, &t) {
+		return
+	}
+	if err := validateDistance(t); err != nil {
+		h.writeValidationError(w, r, err)
+		return
+	}
 
-	h.mqtt.publishDriveInstructionSequence(instruction)
+	if err := driveForward(r.Context(), h.mqtt, t); err != nil {
+		h.writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
 
+	w.WriteHeader(http.StatusOK)
 }
 func (h *HttpServer) driveA(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
-		defer r.Body.Close()
-
 		var t int
-		if err := decoder.Decode(&t); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if !h.decodeRequest(w, r, &t) {
+			return
 		}
-
-		// Check for correct format
-		w.WriteHeader(http.StatusOK)
-
-		c := "turnRight"
-		if t < 0 {
-			c = "turnLeft"
+		if err := validateAngle(t); err != nil {
+			h.writeValidationError(w, r, err)
+			return
 		}
 
-		n := Abs(t) / 90
-
-		instruction := []driveInstruction{}
-		for i := 0; i < n; i++ {
-			instruction = append(instruction, driveInstruction{
-				Instruction: c,
-				Value:       90,
-			})
-		}
-		h.mqtt.publishDriveInstructionSequence(instruction)
+		turn(r.Context(), h.mqtt, t)
 
+		w.WriteHeader(http.StatusOK)
 	}
 }
 
 func (h *HttpServer) targetCoords(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
+	var target webpageTarget
+	if !h.decodeRequest(w, r, &target) {
+		return
+	}
 
-	var targetCoords coordinates
-	if err := decoder.Decode(&targetCoords); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if target.Mode == autonomousTargetMode {
+		startAutonomousMode(r.Context(), h.mqtt)
+		w.WriteHeader(http.StatusOK)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	if targetCoords.Mode == 3 {
-		feed = "<br> <br> Rover is in autonomous mode, exploring the area" + feed
-		stopAutonomous = false
-		autonomousDrive(h.mqtt)
+	targetCoords := coordinates(target)
+	if err := targetCoords.validate(); err != nil {
+		h.writeValidationError(w, r, err)
+		return
 	}
-	previousDestinationRow = targetCoords.X
-	previousDestinationCol = targetCoords.Y
-	previousDestinationMode = targetCoords.Mode
 
-	if err := mapAndDrive(h.mqtt, targetCoords.X, targetCoords.Y, targetCoords.Mode); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := driveToTarget(r.Context(), h.mqtt, targetCoords); err != nil {
+		h.writeError(w, r, http.StatusConflict, err.Error())
+		return
 	}
+
+	w.WriteHeader(http.StatusOK)
 }
 func (h *HttpServer) stopAutonom(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-
-	if err := decoder.Decode(&stopAutonomous); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var stop bool
+	if !h.decodeRequest(w, r, &stop) {
+		return
 	}
 
-	feed = "<br> <br> Exiting autonomous mode" + feed
+	if stop {
+		stopAutonomousMode()
+	} else {
+		stopAutonomous = false
+	}
 
 	w.WriteHeader(http.StatusOK)
-
 }
 
 func Abs(x int) int {
@@ -116,97 +127,513 @@ func Abs(x int) int {
 }
 func (h *HttpServer) resetMap(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		Map.Tiles = []int{
-			3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
-			3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
-
-		Rover.X = 5
-		Rover.Y = 5
-		Rover.Rotation = 0
-
-		mapID, err := h.db.getLatestMapID(ctx)
-		if err != nil {
-			fmt.Println("no mapID : ", mapID)
-			fmt.Println("Error: couldnt get latest map ID")
+		// Instructions and revisions after the reset belong to a new mission
+		if err := startMission(ctx, h.db); err != nil {
+			h.requestLogger(r).Error("server: HTTPPost: resetMap: failed to start mission", zap.Error(err))
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		resetTiles("")
+		if err := recordMapRevisions(ctx, h.db); err != nil {
+			h.requestLogger(r).Error("server: HTTPPost: resetMap: failed to record map reset", zap.Error(err))
 		}
 
+		resetRover()
+
+		resetDiscoveryStats()
+
 		var empty []driveInstruction
 		dbMap.Instructions = empty
 
-		h.db.resetInstructions(ctx, (mapID + 1))
-
+		w.WriteHeader(http.StatusOK)
 	}
 }
 func (h *HttpServer) requestMap(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Aquiring map name
-		decoder := json.NewDecoder(r.Body)
-		defer r.Body.Close()
+		var name string
+		if !h.decodeRequest(w, r, &name) {
+			return
+		}
+
+		// map is quered using name to get id
+		mapID, err := h.db.getMapID(ctx, name)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		h.requestLogger(r).Debug("requested map", zap.String("name", name), zap.Int("mapID", mapID))
+
+		m, err := h.db.getMap(ctx, mapID)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		instructions, err := h.db.getInstructions(ctx, m.MissionID)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Map, rover and instructions are stored in dbMap for the webpage to load
+		dbMap = mapDB{
+			Rows:          m.Rows,
+			Cols:          m.Cols,
+			Tiles:         m.Tiles,
+			RoverIndx:     m.RoverIndx,
+			RoverRotation: m.RoverRotation,
+			Instructions:  instructions,
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
 
+func (h *HttpServer) save(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		var name string
-		if err := decoder.Decode(&name); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if !h.decodeRequest(w, r, &name) {
+			return
+		}
+		if err := validateMapName(name); err != nil {
+			h.writeValidationError(w, r, err)
+			return
 		}
 
+		mapID, err := saveLiveMap(ctx, h.db, name)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		h.requestLogger(r).Info("saved map", zap.String("name", name), zap.Int("mapID", mapID))
+
 		w.WriteHeader(http.StatusOK)
+	}
+}
 
-		fmt.Println("map name:", name)
+// Maximum accepted size of an imported map file (bytes)
+const maxImportedMapSize = 1 << 20
 
-		// map is quered using name to get id
-		mapID, err := h.db.getMapID(ctx, name)
+/*
+	Imports a map as a new saved map.
+	Query parameters:
+		- format: json, csv, png or ros (required)
+		- name: name under which the map is saved (required)
+		- rows, cols: dimensions of png maps (default to the current map dimensions)
+		- load: if "true", the imported map also replaces the current live map
+*/
+func (h *HttpServer) importMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		name := query.Get("name")
+		if format == "" || name == "" {
+			h.writeError(w, r, http.StatusBadRequest, "format and name query parameters are required")
+			return
+		}
+
+		rows, cols := Map.Rows, Map.Cols
+		if query.Get("rows") != "" || query.Get("cols") != "" {
+			var err error
+			if rows, err = strconv.Atoi(query.Get("rows")); err != nil {
+				h.writeError(w, r, http.StatusBadRequest, "invalid rows query parameter")
+				return
+			}
+			if cols, err = strconv.Atoi(query.Get("cols")); err != nil {
+				h.writeError(w, r, http.StatusBadRequest, "invalid cols query parameter")
+				return
+			}
+		}
+
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportedMapSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				h.writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("map must not be larger than %v bytes", maxImportedMapSize))
+				return
+			}
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		imported, err := decodeMap(data, format, rows, cols)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Only maps with the dimensions of the live map can replace it
+		load := query.Get("load") == "true"
+		if load && (imported.Rows != Map.Rows || imported.Cols != Map.Cols) {
+			h.writeError(w, r, http.StatusBadRequest, fmt.Sprintf("map must have %v rows and %v cols to be loaded", Map.Rows, Map.Cols))
+			return
 		}
 
-		fmt.Println("map ID:", mapID)
+		// Imported maps start with the rover at its default position
+		roverX, roverY := roverStart(imported.Rows, imported.Cols)
+		now := time.Now()
+		m := savedMap{
+			Name:      name,
+			Rows:      imported.Rows,
+			Cols:      imported.Cols,
+			Tiles:     imported.Tiles,
+			RoverIndx: roverX + (roverY * imported.Cols),
+			Created:   now,
+			Updated:   now,
+		}
+		if err := validateSavedMap(m); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		// map is built and stored in dbmap
-		h.db.retriveMap(ctx, mapID)
+		// Imported maps get a mission of their own as they were not recorded by one
+		mapID, _, err := h.db.insertImportedMap(ctx, m)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
 
-		// Rover built and stored in dbmap
-		h.db.retriveRover(ctx, mapID)
+		if load {
+			for i, value := range imported.Tiles {
+				setTile(i, value, causeImport, "")
+			}
+			if err := recordMapRevisions(ctx, h.db); err != nil {
+				h.requestLogger(r).Error("server: HTTPPost: importMap: failed to record map revisions", zap.Error(err))
+			}
+			addToFeed("<br> <br> Imported map loaded: " + name)
+		}
 
-		// Instructions Built and stored in dbmap
-		h.db.retriveInstruction(ctx, mapID)
+		h.requestLogger(r).Info("imported map", zap.String("name", name), zap.Int("mapID", mapID), zap.String("format", format))
 
+		h.writeJSON(w, r, http.StatusOK, mapID)
 	}
 }
 
-func (h *HttpServer) save(ctx context.Context) http.HandlerFunc {
+// Registers a ground truth map. Query parameters: name and format (see importMap)
+func (h *HttpServer) registerGroundTruth(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
+		name := r.URL.Query().Get("name")
+		format := r.URL.Query().Get("format")
+		if format == "" || name == "" {
+			h.writeError(w, r, http.StatusBadRequest, "format and name query parameters are required")
+			return
+		}
+
 		defer r.Body.Close()
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportedMapSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				h.writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("ground truth must not be larger than %v bytes", maxImportedMapSize))
+				return
+			}
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		var name string
-		if err := decoder.Decode(&name); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := RegisterGroundTruth(ctx, h.db, name, format, data); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
 		}
 
-		h.db.saveMapName(ctx, name)
+		h.requestLogger(r).Info("registered ground truth", zap.String("name", name))
 
-		mapID, err := h.db.getMapID(ctx, name)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Replays the recorded telemetry of a mission at the given speed
+func (h *HttpServer) startReplay(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request replayRequest
+		if !h.decodeRequest(w, r, &request) {
+			return
+		}
+
+		if err := startReplay(ctx, h.logger, h.db, h.mqtt, request.MissionID, request.Speed); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errReplayRunning) || errors.Is(err, errReplayRoverActive) {
+				status = http.StatusConflict
+			}
+			h.writeError(w, r, status, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *HttpServer) stopReplay(w http.ResponseWriter, r *http.Request) {
+	if err := stopReplay(); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HttpServer) setReplaySpeed(w http.ResponseWriter, r *http.Request) {
+	var speed float64
+	if !h.decodeRequest(w, r, &speed) {
+		return
+	}
+
+	if err := setReplaySpeed(speed); err != nil {
+		h.writeValidationError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Records manual map edits and reports them in the feed
+func (h *HttpServer) finishMapEdit(ctx context.Context, r *http.Request, description string) {
+	if err := recordMapRevisions(ctx, h.db); err != nil {
+		h.requestLogger(r).Error("server: HTTPPost: failed to record map edit", zap.Error(err))
+	}
+
+	addToFeed("<br> <br> Map edited by " + getUsername(r) + ": " + description)
+	h.requestLogger(r).Info("map edited", zap.String("username", getUsername(r)), zap.String("edit", description))
+}
+
+func (h *HttpServer) editTile(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var edit tileEdit
+		if !h.decodeRequest(w, r, &edit) {
+			return
+		}
+
+		if err := validateTileEdit(edit.X, edit.Y, edit.Value, Map); err != nil {
+			h.writeValidationError(w, r, err)
+			return
+		}
+
+		setTile(edit.X+(edit.Y*Map.Cols), edit.Value, causeManual, getUsername(r))
+		h.finishMapEdit(ctx, r, fmt.Sprintf("tile (%v, %v) set to %v", edit.X, edit.Y, edit.Value))
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *HttpServer) editRectangle(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var edit rectangleEdit
+		if !h.decodeRequest(w, r, &edit) {
+			return
+		}
+
+		if err := editRectangle(edit.tileRectangle, edit.Value, getUsername(r)); err != nil {
+			h.writeValidationError(w, r, err)
+			return
+		}
+		h.finishMapEdit(ctx, r, fmt.Sprintf("rectangle %+v set to %v", edit.tileRectangle, edit.Value))
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Sets all tiles in a rectangle to the given value (used for clearing and no-go zones)
+func (h *HttpServer) fillRectangle(ctx context.Context, value int, description string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rectangle tileRectangle
+		if !h.decodeRequest(w, r, &rectangle) {
+			return
+		}
+
+		if err := editRectangle(rectangle, value, getUsername(r)); err != nil {
+			h.writeValidationError(w, r, err)
+			return
+		}
+		h.finishMapEdit(ctx, r, fmt.Sprintf("%v %+v", description, rectangle))
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *HttpServer) addAnnotation(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var a annotation
+		if !h.decodeRequest(w, r, &a) {
+			return
+		}
+
+		if err := validateTileCoordinates(a.X, a.Y, Map); err != nil {
+			h.writeValidationError(w, r, err)
+			return
+		}
+		if a.Text == "" {
+			h.writeValidationError(w, r, &validationError{"text", "is required"})
+			return
+		}
+
+		a.Author = getUsername(r)
+		a.Timestamp = time.Now()
+
+		id, err := h.db.insertAnnotation(ctx, a)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, id)
+	}
+}
+
+func (h *HttpServer) addKeepOutZone(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var zone keepOutZone
+		if !h.decodeRequest(w, r, &zone) {
+			return
 		}
 
-		h.convertAndInsert(ctx, mapID)
+		id, err := addKeepOutZone(ctx, h.db, zone)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		roverIndex := Rover.X + (Rover.Y * Map.Cols)
-		fmt.Println("Rover index =", roverIndex)
-		h.db.saveRover(ctx, mapID, roverIndex)
+		addToFeed("<br> <br> Keep-out zone " + zone.Name + " added")
+
+		h.writeJSON(w, r, http.StatusOK, id)
+	}
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (h *HttpServer) login(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req loginRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
+
+		cred, retryAfter, err := h.authenticate(ctx, r, req.Username, req.Password)
+		if err != nil {
+			if !h.loginError(w, r, retryAfter, err) {
+				h.writeError(w, r, http.StatusUnauthorized, "Invalid username or password")
+			}
+			return
+		}
+		setAuditAuthenticated(r, cred.username)
+
+		tokens, err := h.tokens.login(ctx, h.db, cred)
+		if err != nil {
+			h.requestLogger(r).Error("server: HTTPPost: login: failed to create session", zap.Error(err))
+			h.writeError(w, r, http.StatusInternalServerError, "failed to create session")
+			return
+		}
+
+		h.requestLogger(r).Info("user logged in", zap.String("username", cred.username))
+
+		w.Header().Set("Cache-Control", "no-store")
+		h.writeJSON(w, r, http.StatusOK, tokens)
+	}
+}
+
+func (h *HttpServer) refreshTokens(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
+
+		tokens, username, err := h.tokens.refresh(ctx, h.db, h.credentials, req.RefreshToken)
+		setAuditUsername(r, username)
+		if err != nil {
+			h.writeError(w, r, tokenErrorStatus(err), err.Error())
+			return
+		}
+		setAuditAuthenticated(r, username)
+
+		w.Header().Set("Cache-Control", "no-store")
+		h.writeJSON(w, r, http.StatusOK, tokens)
+	}
+}
+
+func (h *HttpServer) logout(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
+
+		username, err := h.tokens.logout(ctx, h.db, req.RefreshToken)
+		setAuditUsername(r, username)
+		if err != nil {
+			h.writeError(w, r, tokenErrorStatus(err), err.Error())
+			return
+		}
+		setAuditAuthenticated(r, username)
 
 		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type newUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     role   `json:"role"`
+}
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+func (h *HttpServer) addUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req newUserRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
+
+		if err := createUser(ctx, h.db, req.Username, req.Password, req.Role); err != nil {
+			h.writeError(w, r, userErrorStatus(err), err.Error())
+			return
+		}
+		h.credentials.invalidate()
+		h.auditEvent(r, "user added", zap.String("targetUser", req.Username), zap.String("targetRole", string(req.Role)))
+
+		h.writeJSON(w, r, http.StatusCreated, user{
+			Username: req.Username,
+			Role:     req.Role,
+		})
+	}
+}
+
+// Resetting a password logs the user out everywhere
+func (h *HttpServer) resetUserPassword(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		var req passwordRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
 
+		if err := resetPassword(ctx, h.db, username, req.Password); err != nil {
+			h.writeError(w, r, userErrorStatus(err), err.Error())
+			return
+		}
+		h.credentials.invalidate()
+		if err := h.tokens.loadRevokedSessions(ctx, h.db); err != nil {
+			h.requestLogger(r).Error("server: HTTPPost: failed to load revoked sessions", zap.Error(err))
+		}
+		h.auditEvent(r, "password reset", zap.String("targetUser", username))
+
+		w.WriteHeader(http.StatusOK)
 	}
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+/*
+	Renames a saved map and/or replaces its layout and rover pose.
+	Returns the updated map.
+*/
+func (h *HttpServer) updateMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
+
+		var update savedMapUpdate
+		if !h.decodeRequest(w, r, &update) {
+			return
+		}
+
+		m, err := h.db.getMap(ctx, mapID)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		m = update.apply(m)
+		m.Updated = time.Now()
+		if err := validateSavedMap(m); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := h.db.updateMap(ctx, m); err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, m)
+	}
+}
+
+// Fields that are not given are left unchanged
+type userUpdate struct {
+	Role     *role `json:"role"`
+	Disabled *bool `json:"disabled"`
+}
+
+// Changes the role of a user and/or disables or enables them. Disabling a user logs them out everywhere.
+func (h *HttpServer) updateUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		var update userUpdate
+		if !h.decodeRequest(w, r, &update) {
+			return
+		}
+
+		if update.Role != nil {
+			if err := setUserRole(ctx, h.db, username, *update.Role); err != nil {
+				h.writeError(w, r, userErrorStatus(err), err.Error())
+				return
+			}
+			h.auditEvent(r, "user role changed", zap.String("targetUser", username), zap.String("targetRole", string(*update.Role)))
+		}
+		if update.Disabled != nil {
+			if err := setUserDisabled(ctx, h.db, username, *update.Disabled); err != nil {
+				h.writeError(w, r, userErrorStatus(err), err.Error())
+				return
+			}
+			h.auditEvent(r, "user disabled changed", zap.String("targetUser", username), zap.Bool("disabled", *update.Disabled))
+		}
+		h.credentials.invalidate()
+
+		creds, err := h.credentials.getAll(ctx)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cred, ok := creds[username]
+		if !ok {
+			h.writeError(w, r, http.StatusNotFound, errUserNotFound.Error())
+			return
+		}
+
+		h.writeJSON(w, r, http.StatusOK, user{
+			Username: cred.username,
+			Role:     cred.role,
+			Disabled: cred.disabled,
+		})
+	}
+}
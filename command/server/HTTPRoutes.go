@@ -9,57 +9,152 @@ import (
 	"fmt"
 
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 )
 
 func (h *HttpServer) routes(ctx context.Context) error {
 
 	// General middleware
+	h.router.Use(h.logRequests)
+	h.router.Use(securityHeaders)
+	h.router.Use(h.strictPreflight)
 	h.router.Use(cors.Handler(cors.Options{
-		AllowOriginFunc:  allowOriginFunc,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"X-PINGOTHER", "Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowOriginFunc:  h.allowOrigin,
+		AllowedMethods:   corsAllowedMethods,
+		AllowedHeaders:   corsAllowedHeaders,
+		ExposedHeaders:   []string{"Link", "Retry-After", requestIDHeader},
 		AllowCredentials: true,
+		MaxAge:           int(corsMaxAge.Seconds()),
 	}))
-	h.router.Use(middleware.Logger)
+	h.router.Use(instrumentHTTP)
 
-	// Credentials from database
-	credentials, err := h.db.getCredentials(ctx)
-	if err != nil {
-		return fmt.Errorf("server: routes: failed to get credentials: %w", err)
+	// Unknown routes get the same JSON errors as the handlers (see requests.go)
+	h.router.NotFound(h.notFound)
+	h.router.MethodNotAllowed(h.methodNotAllowed)
+
+	// Credentials from database, looked up on every request
+	h.credentials = newCredentialStore(h.db, credentialsCacheTTL)
+	h.loginLimiter = newLoginLimiter()
+
+	// Access tokens
+	var err error
+	if h.tokens, err = newTokenIssuer(nil); err != nil {
+		return fmt.Errorf("server: routes: failed to create token issuer: %w", err)
+	}
+	if err := h.tokens.loadRevokedSessions(ctx, h.db); err != nil {
+		return fmt.Errorf("server: routes: failed to load revoked sessions: %w", err)
 	}
 
-	// Public routes
+	// Public routes, logins and logouts are audited
 	h.router.Group(func(r chi.Router) {
-		r.Get("/isAuthorised", h.getIsAuthorised(credentials))
+		r.Use(h.auditTrail(ctx))
+
+		r.Get("/isAuthorised", h.getIsAuthorised(ctx))
+		r.Post("/auth/login", h.login(ctx))
+		r.Post("/auth/refresh", h.refreshTokens(ctx))
+		r.Post("/auth/logout", h.logout(ctx))
+
+		// Monitoring (see health.go and metrics.go)
+		r.Get("/healthz", h.getHealthz)
+		r.Get("/readyz", h.getReadyz)
+		r.Get("/metrics", h.getMetrics)
 	})
 
 	// Private routes
 	h.router.Group(func(r chi.Router) {
-		r.Use(h.basicAuth("SpaceXpp-Server", credentials))
-
-		// Get
-		r.Get("/connect", h.connect)
-		r.Get("/battery", h.battery)
-		r.Get("/check", check)
-		r.Get("/feed", h.getFeed(ctx))
-		r.Get("/map/getMap", h.updateWebMap)
-		r.Get("/map/getRover", h.updateRover)
-		r.Get("/map/history/load", h.loadMap(ctx))
-		r.Get("/energy/values", h.getEnergyStatus)
-
-		// Post
-		r.Post("/drive/distance", h.driveD)
-		r.Post("/drive/angle", h.driveA(ctx))
-		r.Post("/map/targetCoords", h.targetCoords)
-		r.Post("/map/reset", h.resetMap(ctx))
-		r.Post("/map/history/request", h.requestMap(ctx))
-		r.Post("/map/history/save", h.save(ctx))
-		r.Post("/map/stopAutonomous", h.stopAutonom)
 
+		// Read-only routes
+		r.Group(func(r chi.Router) {
+			h.private(ctx, r, authPasswordOrClientCert, roleViewer)
+
+			r.Get("/connect", h.connect)
+			r.Get("/battery", h.battery)
+			r.Get("/check", h.check)
+			r.Get("/feed", h.getFeed(ctx))
+			r.Get("/map/getMap", h.updateWebMap)
+			r.Get("/map/getRover", h.updateRover)
+			r.Get("/map/history/load", h.loadMap(ctx))
+			r.Get("/energy/values", h.getEnergyStatus)
+			r.Get("/maps", h.getMaps(ctx))
+			r.Get("/maps/{id}", h.getMap(ctx))
+			r.Get("/maps/{id}/export", h.exportMap(ctx))
+			r.Get("/maps/{id}/score", h.scoreSavedMap(ctx))
+			r.Get("/map/score", h.scoreLiveMap(ctx))
+			r.Get("/groundTruths", h.getGroundTruths(ctx))
+			r.Get("/map/revisions", h.getMapRevisions(ctx))
+			r.Get("/map/revisions/at", h.getMapAtRevision(ctx))
+			r.Get("/map/revisions/diff", h.getMapRevisionDiff(ctx))
+			r.Get("/replay/status", h.getReplayStatus)
+			r.Get("/map/annotations", h.getAnnotations(ctx))
+			r.Get("/map/keepOutZones", h.getKeepOutZones)
+			r.Get("/maps/{id}/keepOutZones", h.getSavedKeepOutZones(ctx))
+			r.Get("/missions", h.getMissions(ctx))
+			r.Get("/missions/current", h.getCurrentMission)
+		})
+
+		// Driving and map editing routes
+		r.Group(func(r chi.Router) {
+			h.private(ctx, r, authPasswordOrClientCert, roleOperator)
+
+			r.Post("/replay/start", h.startReplay(ctx))
+			r.Post("/replay/stop", h.stopReplay)
+			r.Post("/replay/speed", h.setReplaySpeed)
+
+			// A running replay owns the live map
+			r.Group(func(r chi.Router) {
+				r.Use(h.rejectDuringReplay)
+
+				// Post
+				r.Post("/drive/distance", h.driveD)
+				r.Post("/drive/angle", h.driveA(ctx))
+				r.Post("/map/targetCoords", h.targetCoords)
+				r.Post("/map/reset", h.resetMap(ctx))
+				r.Post("/map/history/request", h.requestMap(ctx))
+				r.Post("/map/history/save", h.save(ctx))
+				r.Post("/map/stopAutonomous", h.stopAutonom)
+				r.Post("/maps/import", h.importMap(ctx))
+				r.Post("/groundTruths", h.registerGroundTruth(ctx))
+				r.Post("/map/edit/tile", h.editTile(ctx))
+				r.Post("/map/edit/rectangle", h.editRectangle(ctx))
+				r.Post("/map/edit/clear", h.fillRectangle(ctx, tileMapUnknownVal, "cleared"))
+				r.Post("/map/edit/noGo", h.fillRectangle(ctx, tileMapNoGoVal, "no-go zone"))
+				r.Post("/map/annotations", h.addAnnotation(ctx))
+				r.Post("/map/keepOutZones", h.addKeepOutZone(ctx))
+
+				// Put
+				r.Put("/maps/{id}", h.updateMap(ctx))
+
+				// Delete
+				r.Delete("/maps/{id}", h.deleteMap(ctx))
+				r.Delete("/map/annotations/{id}", h.deleteAnnotation(ctx))
+				r.Delete("/map/keepOutZones/{id}", h.deleteKeepOutZone(ctx))
+			})
+		})
+
+		// User management and administration routes, only for people with a password
+		r.Group(func(r chi.Router) {
+			h.private(ctx, r, authPassword, roleAdmin)
+
+			r.Get("/audit", h.getAuditRecords(ctx))
+			r.Get("/config", h.getConfig)
+			r.Get("/users", h.getUsers(ctx))
+			r.Post("/users", h.addUser(ctx))
+			r.Post("/users/{username}/password", h.resetUserPassword(ctx))
+			r.Put("/users/{username}", h.updateUser(ctx))
+			r.Delete("/users/{username}", h.deleteUser(ctx))
+		})
 	})
 
+	// Versioned API (see api_v1.go)
+	h.routesV1(ctx)
+
 	return nil
 }
+
+// Authentication, audit trail, CSRF protection and role check of a group of private routes
+func (h *HttpServer) private(ctx context.Context, r chi.Router, policy authPolicy, required role) {
+	r.Use(h.auditTrail(ctx))
+	r.Use(h.auth("SpaceXpp-Server", policy))
+	r.Use(h.csrfProtection)
+	r.Use(h.requireRole(required))
+}
@@ -6,8 +6,10 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/go-chi/chi"
 	"go.uber.org/zap"
@@ -18,18 +20,51 @@ type HttpServer struct {
 	mqtt   MQTT
 	router *chi.Mux
 	logger *zap.Logger
+	tokens *tokenIssuer
+
+	credentials  *credentialStore
+	loginLimiter *loginLimiter
+
+	allowedOrigins map[string]bool
+	clientCerts    *clientCertAuth
+
+	config Config
+
+	serverMu sync.Mutex
+	server   *http.Server
+	shutdown bool
 }
 
-func OpenHttpServer(ctx context.Context, logger *zap.Logger, router *chi.Mux, db DB, mqtt MQTT) *HttpServer {
+// The config must be valid (see Config.Validate)
+func OpenHttpServer(ctx context.Context, logger *zap.Logger, router *chi.Mux, db DB, mqtt MQTT, config Config) *HttpServer {
 
 	h := &HttpServer{
 		db:     db,
 		mqtt:   mqtt,
 		router: router,
 		logger: logger,
+		config: config,
 	}
 
+	applyMapConfig(config.Map)
+	autonomySettings = config.Autonomy
+
 	h.resetMap(ctx)
+
+	if err := startMission(ctx, db); err != nil {
+		logger.Error("server: http_server: failed to start mission", zap.Error(err))
+	}
+
+	// Server always starts with the default map
+	resetTiles("")
+	if err := recordMapRevisions(ctx, db); err != nil {
+		logger.Error("server: http_server: failed to record initial map reset", zap.Error(err))
+	}
+
+	if err := loadKeepOutZones(ctx, db); err != nil {
+		logger.Error("server: http_server: failed to load keep-out zones", zap.Error(err))
+	}
+
 	return h
 }
 
@@ -40,12 +75,56 @@ func (h *HttpServer) Serve(ctx context.Context, port string, certFileName string
 
 	portStr := ":" + port
 
-	if err := http.ListenAndServeTLS(portStr, certFileName, keyFileName, h.router); err != nil {
+	h.serverMu.Lock()
+	if h.shutdown {
+		h.serverMu.Unlock()
+		return nil
+	}
+	server := &http.Server{
+		Addr:      portStr,
+		Handler:   h.router,
+		TLSConfig: h.clientCerts.tlsConfig(),
+		ErrorLog:  zap.NewStdLog(h.logger.Named("http")), // e.g. TLS handshake errors
+	}
+	h.server = server
+	h.serverMu.Unlock()
+
+	// Returns http.ErrServerClosed after Shutdown
+	if err := server.ListenAndServeTLS(certFileName, keyFileName); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("server: http_server: http.ListenAndServe failed: %w", err)
 	}
 	return nil
 }
 
+func (h *HttpServer) isShuttingDown() bool {
+	h.serverMu.Lock()
+	defer h.serverMu.Unlock()
+
+	return h.shutdown
+}
+
+/*
+	Stops autonomous mode and any running replay so that no new drive instructions are computed,
+	then stops accepting connections and waits until in-flight requests are done or the context is done.
+*/
+func (h *HttpServer) Shutdown(ctx context.Context) error {
+	stopAutonomous = true
+	stopReplay() // error only means that no replay is running
+
+	h.serverMu.Lock()
+	h.shutdown = true
+	server := h.server
+	h.serverMu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("server: http_server: failed to drain http server: %w", err)
+	}
+	return nil
+}
+
 func (h *HttpServer) Close() error {
 
 	if err := h.db.Close(); err != nil {
@@ -54,3 +133,33 @@ func (h *HttpServer) Close() error {
 
 	return nil
 }
+
+// Maps errors of the map storage to http status codes
+func mapStorageErrorStatus(err error) int {
+	if errors.Is(err, errMapNotFound) {
+		return http.StatusNotFound
+	} else if errors.Is(err, errMapNameTaken) || errors.Is(err, errMapSize) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// Maps errors of token validation to http status codes
+func tokenErrorStatus(err error) int {
+	if errors.Is(err, errInvalidToken) || errors.Is(err, errExpiredToken) || errors.Is(err, errRevokedSession) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// Maps errors of user management to http status codes
+func userErrorStatus(err error) int {
+	if errors.Is(err, errUserNotFound) {
+		return http.StatusNotFound
+	} else if errors.Is(err, errUsernameTaken) {
+		return http.StatusConflict
+	} else if errors.Is(err, errInvalidUser) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
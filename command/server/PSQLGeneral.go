@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+/*
+	PostgreSQL implementation of DB, the queries are shared with SQLiteDB (see SQLdb.go).
+	Allows several command servers to share maps and mission history.
+*/
+type PostgresDB struct {
+	sqlDB
+}
+
+// Opens the db and migrates it to the latest schema version
+func OpenPostgresDB(ctx context.Context, logger *zap.Logger, dsn string) (*PostgresDB, error) {
+	p, err := OpenPostgresDBWithoutMigration(ctx, logger, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.migrate(ctx); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("server: PSQLGeneral: failed to migrate postgres database: %w", err)
+	}
+
+	return p, nil
+}
+
+// Opens the db without changing its schema
+func OpenPostgresDBWithoutMigration(ctx context.Context, logger *zap.Logger, dsn string) (*PostgresDB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("server: PSQLGeneral: failed to open postgres db: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("server: PSQLGeneral: postgres db down: %w", err)
+	}
+
+	return &PostgresDB{sqlDB{
+		db:      db,
+		logger:  logger,
+		dialect: dialectPostgres,
+	}}, nil
+}
+
+/*
+	Same steps as the SQLite migrations (see SQLMigrations.go) using PostgreSQL types.
+	Both lists must always contain the same versions.
+*/
+var postgresMigrations = []migration{
+	{
+		version:     1,
+		description: "create maps, instructions and credentials tables",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS maps (
+					mapID SERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					rows INTEGER NOT NULL,
+					cols INTEGER NOT NULL,
+					layout TEXT NOT NULL,
+					roverIndx INTEGER NOT NULL,
+					roverRotation INTEGER NOT NULL,
+					created TIMESTAMPTZ NOT NULL,
+					updated TIMESTAMPTZ NOT NULL
+				)
+				`,
+				`
+				CREATE TABLE IF NOT EXISTS instructions (
+					instructionID SERIAL PRIMARY KEY,
+					mapID INTEGER NOT NULL,
+					instruction TEXT NOT NULL,
+					value INTEGER NOT NULL
+				)
+				`,
+				`
+				CREATE TABLE IF NOT EXISTS credentials (
+					id SERIAL PRIMARY KEY,
+					username TEXT NOT NULL,
+					password TEXT NOT NULL
+				)
+				`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`DROP TABLE IF EXISTS credentials`,
+				`DROP TABLE IF EXISTS instructions`,
+				`DROP TABLE IF EXISTS maps`,
+			)
+		},
+	},
+	{
+		version:     2,
+		description: "create groundTruths and discovery tables",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS groundTruths (
+					groundTruthID SERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					rows INTEGER NOT NULL,
+					cols INTEGER NOT NULL,
+					layout TEXT NOT NULL
+				)
+				`,
+				`
+				CREATE TABLE IF NOT EXISTS discovery (
+					mapID INTEGER NOT NULL PRIMARY KEY,
+					distance INTEGER NOT NULL,
+					fullyDiscovered BOOLEAN NOT NULL,
+					timeToFullDiscovery DOUBLE PRECISION NOT NULL,
+					distanceToFullDiscovery INTEGER NOT NULL
+				)
+				`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`DROP TABLE IF EXISTS discovery`,
+				`DROP TABLE IF EXISTS groundTruths`,
+			)
+		},
+	},
+	{
+		version:     3,
+		description: "create tileRevisions table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS tileRevisions (
+					revisionID SERIAL PRIMARY KEY,
+					"timestamp" TIMESTAMPTZ NOT NULL,
+					indx INTEGER NOT NULL,
+					value INTEGER NOT NULL,
+					previousValue INTEGER NOT NULL,
+					cause TEXT NOT NULL,
+					author TEXT NOT NULL
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS tileRevisions`)
+		},
+	},
+	{
+		version:     4,
+		description: "create telemetry table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS telemetry (
+					telemetryID SERIAL PRIMARY KEY,
+					"timestamp" TIMESTAMPTZ NOT NULL,
+					topic TEXT NOT NULL,
+					payload TEXT NOT NULL
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS telemetry`)
+		},
+	},
+	{
+		version:     5,
+		description: "create annotations table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS annotations (
+					annotationID SERIAL PRIMARY KEY,
+					x INTEGER NOT NULL,
+					y INTEGER NOT NULL,
+					text TEXT NOT NULL,
+					author TEXT NOT NULL,
+					"timestamp" TIMESTAMPTZ NOT NULL
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS annotations`)
+		},
+	},
+	{
+		version:     6,
+		description: "create keepOutZones table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS keepOutZones (
+					zoneID SERIAL PRIMARY KEY,
+					mapID INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					kind TEXT NOT NULL,
+					shape TEXT NOT NULL
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS keepOutZones`)
+		},
+	},
+	{
+		version:     7,
+		description: "create missions table and record instructions per mission",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			if err := execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS missions (
+					missionID SERIAL PRIMARY KEY,
+					started TIMESTAMPTZ NOT NULL
+				)
+			`); err != nil {
+				return err
+			}
+
+			// Instructions used to be stored for the map saved next, so every saved map gets a mission with the same id
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO missions (missionID, started)
+				SELECT mapID, created
+				FROM maps
+			`); err != nil {
+				return fmt.Errorf("failed to insert missions of saved maps: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO missions (missionID, started)
+				SELECT DISTINCT mapID, $1::TIMESTAMPTZ
+				FROM instructions
+				WHERE mapID NOT IN (SELECT mapID FROM maps)
+			`,
+				time.Now().UTC(),
+			); err != nil {
+				return fmt.Errorf("failed to insert missions of unsaved instructions: %w", err)
+			}
+
+			return execStatements(ctx, tx,
+				// Ids were inserted explicitly so the sequence must continue after them
+				`SELECT setval(pg_get_serial_sequence('missions', 'missionid'), COALESCE(max(missionID), 0) + 1, false) FROM missions`,
+				`ALTER TABLE maps ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+				`UPDATE maps SET missionID = mapID`,
+				`ALTER TABLE instructions RENAME COLUMN mapID TO missionID`,
+				`ALTER TABLE tileRevisions ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE telemetry ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				// Instructions of missions that were never saved are lost
+				`DELETE FROM instructions WHERE missionID NOT IN (SELECT missionID FROM maps)`,
+				`UPDATE instructions SET missionID = (SELECT min(mapID) FROM maps WHERE maps.missionID = instructions.missionID)`,
+				`ALTER TABLE instructions RENAME COLUMN missionID TO mapID`,
+				`ALTER TABLE maps DROP COLUMN missionID`,
+				`ALTER TABLE tileRevisions DROP COLUMN missionID`,
+				`ALTER TABLE telemetry DROP COLUMN missionID`,
+				`DROP TABLE IF EXISTS missions`,
+			)
+		},
+	},
+	{
+		version:     8,
+		description: "add role to credentials",
+		// Existing users could do everything so they become admins, new users get the least privileged role
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`ALTER TABLE credentials ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer'`,
+				`UPDATE credentials SET role = 'admin'`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `ALTER TABLE credentials DROP COLUMN role`)
+		},
+	},
+	{
+		version:     9,
+		description: "create sessions table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS sessions (
+					sessionID TEXT NOT NULL PRIMARY KEY,
+					username TEXT NOT NULL,
+					refreshTokenHash TEXT NOT NULL,
+					created TIMESTAMPTZ NOT NULL,
+					expires TIMESTAMPTZ NOT NULL,
+					revoked TIMESTAMPTZ
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS sessions`)
+		},
+	},
+	{
+		version:     10,
+		description: "make usernames unique and add disabled to credentials",
+		// The role loses its default, from now on it must be given explicitly
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				// Of duplicate usernames only the latest credential was used for authentication
+				`DELETE FROM credentials WHERE id NOT IN (SELECT max(id) FROM credentials GROUP BY username)`,
+				`ALTER TABLE credentials ADD CONSTRAINT credentials_username_key UNIQUE (username)`,
+				`ALTER TABLE credentials ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE`,
+				`ALTER TABLE credentials ALTER COLUMN role DROP DEFAULT`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`ALTER TABLE credentials ALTER COLUMN role SET DEFAULT 'viewer'`,
+				`ALTER TABLE credentials DROP COLUMN disabled`,
+				`ALTER TABLE credentials DROP CONSTRAINT credentials_username_key`,
+			)
+		},
+	},
+	{
+		version:     11,
+		description: "create append-only auditEvents table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS auditEvents (
+					auditEventID SERIAL PRIMARY KEY,
+					"timestamp" TIMESTAMPTZ NOT NULL,
+					username TEXT NOT NULL,
+					sourceIP TEXT NOT NULL,
+					method TEXT NOT NULL,
+					path TEXT NOT NULL,
+					payload TEXT NOT NULL,
+					status INTEGER NOT NULL,
+					result TEXT NOT NULL
+				)
+				`,
+				`
+				CREATE OR REPLACE FUNCTION auditEventsAppendOnly() RETURNS trigger AS $$
+				BEGIN
+					RAISE EXCEPTION 'auditEvents is append-only';
+				END
+				$$ LANGUAGE plpgsql
+				`,
+				`
+				CREATE TRIGGER auditEventsAppendOnly BEFORE UPDATE OR DELETE ON auditEvents
+				FOR EACH ROW EXECUTE PROCEDURE auditEventsAppendOnly()
+				`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`DROP TABLE IF EXISTS auditEvents`,
+				`DROP FUNCTION IF EXISTS auditEventsAppendOnly()`,
+			)
+		},
+	},
+	{
+		version:     12,
+		description: "store map dimensions with tile revisions",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`ALTER TABLE tileRevisions ADD COLUMN rows INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE tileRevisions ADD COLUMN cols INTEGER NOT NULL DEFAULT 0`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`ALTER TABLE tileRevisions DROP COLUMN rows`,
+				`ALTER TABLE tileRevisions DROP COLUMN cols`,
+			)
+		},
+	},
+	{
+		version:     13,
+		description: "move live keep-out zones to their own table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS liveKeepOutZones (
+					zoneID SERIAL PRIMARY KEY,
+					name TEXT NOT NULL,
+					kind TEXT NOT NULL,
+					shape TEXT NOT NULL
+				)
+				`,
+				// Live zones used to be stored under map id 0
+				`
+				INSERT INTO liveKeepOutZones (zoneID, name, kind, shape)
+				SELECT zoneID, name, kind, shape
+				FROM keepOutZones
+				WHERE mapID = 0
+				`,
+				`DELETE FROM keepOutZones WHERE mapID = 0`,
+				// Ids were inserted explicitly so the sequence must continue after them
+				`SELECT setval(pg_get_serial_sequence('livekeepoutzones', 'zoneid'), COALESCE(max(zoneID), 0) + 1, false) FROM liveKeepOutZones`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				INSERT INTO keepOutZones (mapID, name, kind, shape)
+				SELECT 0, name, kind, shape
+				FROM liveKeepOutZones
+				ORDER BY zoneID
+				`,
+				`DROP TABLE IF EXISTS liveKeepOutZones`,
+			)
+		},
+	},
+}
+
+func (p *PostgresDB) migrator() *schemaMigrator {
+	return &schemaMigrator{
+		transact:   p.TransactContext,
+		logger:     p.logger,
+		migrations: postgresMigrations,
+		versionTableSchema: `
+			CREATE TABLE IF NOT EXISTS schema_version (
+				version INTEGER NOT NULL PRIMARY KEY,
+				description TEXT NOT NULL,
+				applied TIMESTAMPTZ NOT NULL
+			)
+		`,
+	}
+}
+
+func (p *PostgresDB) SchemaVersion(ctx context.Context) (int, error) {
+	return p.migrator().version(ctx)
+}
+
+func (p *PostgresDB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return p.migrator().status(ctx)
+}
+
+func (p *PostgresDB) MigrateUp(ctx context.Context, target int) error {
+	return p.migrator().up(ctx, target)
+}
+
+func (p *PostgresDB) MigrateDown(ctx context.Context, target int) error {
+	return p.migrator().down(ctx, target)
+}
+
+func (p *PostgresDB) migrate(ctx context.Context) error {
+	return p.MigrateUp(ctx, LatestSchemaVersion())
+}
@@ -0,0 +1,880 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+	Schema migrations are numbered steps that are applied in order.
+	Every step can be rolled back with its down function.
+	The applied steps are recorded in the schema_version table, the current version is the highest applied step.
+
+	New schema changes must be added as a new step at the end of migrations.
+	Existing steps must never be changed as they may already be applied to deployed dbs.
+*/
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context, tx *sql.Tx) error
+	down        func(ctx context.Context, tx *sql.Tx) error
+}
+
+// State of a migration step in a db
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create maps, instructions and credentials tables",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			// Databases created before maps were stored as a single row are converted first
+			if err := upgradeMapStorage(ctx, tx); err != nil {
+				return fmt.Errorf("failed to upgrade map storage: %w", err)
+			}
+
+			return execStatements(ctx, tx,
+				mapsTableSchema("maps"),
+				`
+				CREATE TABLE IF NOT EXISTS instructions (
+					instructionID INTEGER NOT NULL PRIMARY KEY,
+					mapID INTEGER NOT NULL,
+					instruction STRING NOT NULL,
+					value INTEGER NOT NULL,
+					FOREIGN KEY(mapID) REFERENCES maps(mapID)
+				)
+				`,
+				`
+				CREATE TABLE IF NOT EXISTS credentials (
+					id INTEGER NOT NULL PRIMARY KEY,
+					username TEXT NOT NULL,
+					password TEXT NOT NULL
+				)
+				`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`DROP TABLE IF EXISTS credentials`,
+				`DROP TABLE IF EXISTS instructions`,
+				`DROP TABLE IF EXISTS maps`,
+			)
+		},
+	},
+	{
+		version:     2,
+		description: "create groundTruths and discovery tables",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS groundTruths (
+					groundTruthID INTEGER NOT NULL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					rows INTEGER NOT NULL,
+					cols INTEGER NOT NULL,
+					layout TEXT NOT NULL
+				)
+				`,
+				`
+				CREATE TABLE IF NOT EXISTS discovery (
+					mapID INTEGER NOT NULL PRIMARY KEY,
+					distance INTEGER NOT NULL,
+					fullyDiscovered BOOLEAN NOT NULL,
+					timeToFullDiscovery REAL NOT NULL,
+					distanceToFullDiscovery INTEGER NOT NULL,
+					FOREIGN KEY(mapID) REFERENCES maps(mapID)
+				)
+				`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`DROP TABLE IF EXISTS discovery`,
+				`DROP TABLE IF EXISTS groundTruths`,
+			)
+		},
+	},
+	{
+		version:     3,
+		description: "create tileRevisions table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, tileRevisionsTableSchema("tileRevisions"))
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS tileRevisions`)
+		},
+	},
+	{
+		version:     4,
+		description: "create telemetry table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, telemetryTableSchema("telemetry"))
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS telemetry`)
+		},
+	},
+	{
+		version:     5,
+		description: "create annotations table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS annotations (
+					annotationID INTEGER NOT NULL PRIMARY KEY,
+					x INTEGER NOT NULL,
+					y INTEGER NOT NULL,
+					text TEXT NOT NULL,
+					author TEXT NOT NULL,
+					timestamp DATETIME NOT NULL
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS annotations`)
+		},
+	},
+	{
+		version:     6,
+		description: "create keepOutZones table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS keepOutZones (
+					zoneID INTEGER NOT NULL PRIMARY KEY,
+					mapID INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					kind TEXT NOT NULL,
+					shape TEXT NOT NULL
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS keepOutZones`)
+		},
+	},
+	{
+		version:     7,
+		description: "create missions table and record instructions per mission",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			if err := execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS missions (
+					missionID INTEGER NOT NULL PRIMARY KEY,
+					started DATETIME NOT NULL
+				)
+			`); err != nil {
+				return err
+			}
+
+			// Instructions used to be stored for the map saved next, so every saved map gets a mission with the same id
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO missions (missionID, started)
+				SELECT mapID, created
+				FROM maps
+			`); err != nil {
+				return fmt.Errorf("failed to insert missions of saved maps: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO missions (missionID, started)
+				SELECT DISTINCT mapID, $1
+				FROM instructions
+				WHERE mapID NOT IN (SELECT mapID FROM maps)
+			`,
+				time.Now().UTC(),
+			); err != nil {
+				return fmt.Errorf("failed to insert missions of unsaved instructions: %w", err)
+			}
+
+			return execStatements(ctx, tx,
+				`ALTER TABLE maps ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+				`UPDATE maps SET missionID = mapID`,
+				instructionsTableSchema("instructionsUpgrade"),
+				`
+				INSERT INTO instructionsUpgrade (instructionID, missionID, instruction, value)
+				SELECT instructionID, mapID, instruction, value
+				FROM instructions
+				`,
+				`DROP TABLE instructions`,
+				`ALTER TABLE instructionsUpgrade RENAME TO instructions`,
+				`ALTER TABLE tileRevisions ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE telemetry ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+			)
+		},
+		// SQLite can't drop columns, so the tables are rebuilt without them
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE instructionsDowngrade (
+					instructionID INTEGER NOT NULL PRIMARY KEY,
+					mapID INTEGER NOT NULL,
+					instruction STRING NOT NULL,
+					value INTEGER NOT NULL,
+					FOREIGN KEY(mapID) REFERENCES maps(mapID)
+				)
+				`,
+				// Instructions of missions that were never saved are lost
+				`
+				INSERT INTO instructionsDowngrade (instructionID, mapID, instruction, value)
+				SELECT instructions.instructionID, min(maps.mapID), instructions.instruction, instructions.value
+				FROM instructions
+				JOIN maps ON maps.missionID = instructions.missionID
+				GROUP BY instructions.instructionID
+				`,
+				`DROP TABLE instructions`,
+				`ALTER TABLE instructionsDowngrade RENAME TO instructions`,
+				mapsTableSchema("mapsDowngrade"),
+				`
+				INSERT INTO mapsDowngrade (mapID, name, rows, cols, layout, roverIndx, roverRotation, created, updated)
+				SELECT mapID, name, rows, cols, layout, roverIndx, roverRotation, created, updated
+				FROM maps
+				`,
+				`DROP TABLE maps`,
+				`ALTER TABLE mapsDowngrade RENAME TO maps`,
+				tileRevisionsTableSchema("tileRevisionsDowngrade"),
+				`
+				INSERT INTO tileRevisionsDowngrade (revisionID, timestamp, indx, value, previousValue, cause, author)
+				SELECT revisionID, timestamp, indx, value, previousValue, cause, author
+				FROM tileRevisions
+				`,
+				`DROP TABLE tileRevisions`,
+				`ALTER TABLE tileRevisionsDowngrade RENAME TO tileRevisions`,
+				telemetryTableSchema("telemetryDowngrade"),
+				`
+				INSERT INTO telemetryDowngrade (telemetryID, timestamp, topic, payload)
+				SELECT telemetryID, timestamp, topic, payload
+				FROM telemetry
+				`,
+				`DROP TABLE telemetry`,
+				`ALTER TABLE telemetryDowngrade RENAME TO telemetry`,
+				`DROP TABLE IF EXISTS missions`,
+			)
+		},
+	},
+	{
+		version:     8,
+		description: "add role to credentials",
+		// Existing users could do everything so they become admins, new users get the least privileged role
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`ALTER TABLE credentials ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer'`,
+				`UPDATE credentials SET role = 'admin'`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE credentialsDowngrade (
+					id INTEGER NOT NULL PRIMARY KEY,
+					username TEXT NOT NULL,
+					password TEXT NOT NULL
+				)
+				`,
+				`
+				INSERT INTO credentialsDowngrade (id, username, password)
+				SELECT id, username, password
+				FROM credentials
+				`,
+				`DROP TABLE credentials`,
+				`ALTER TABLE credentialsDowngrade RENAME TO credentials`,
+			)
+		},
+	},
+	{
+		version:     9,
+		description: "create sessions table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `
+				CREATE TABLE IF NOT EXISTS sessions (
+					sessionID TEXT NOT NULL PRIMARY KEY,
+					username TEXT NOT NULL,
+					refreshTokenHash TEXT NOT NULL,
+					created DATETIME NOT NULL,
+					expires DATETIME NOT NULL,
+					revoked DATETIME
+				)
+			`)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS sessions`)
+		},
+	},
+	{
+		version:     10,
+		description: "make usernames unique and add disabled to credentials",
+		// The role loses its default, from now on it must be given explicitly
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE credentialsUpgrade (
+					id INTEGER NOT NULL PRIMARY KEY,
+					username TEXT NOT NULL UNIQUE,
+					password TEXT NOT NULL,
+					role TEXT NOT NULL,
+					disabled BOOLEAN NOT NULL DEFAULT 0
+				)
+				`,
+				// Of duplicate usernames only the latest credential was used for authentication
+				`
+				INSERT INTO credentialsUpgrade (id, username, password, role)
+				SELECT id, username, password, role
+				FROM credentials
+				WHERE id IN (SELECT max(id) FROM credentials GROUP BY username)
+				`,
+				`DROP TABLE credentials`,
+				`ALTER TABLE credentialsUpgrade RENAME TO credentials`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE credentialsDowngrade (
+					id INTEGER NOT NULL PRIMARY KEY,
+					username TEXT NOT NULL,
+					password TEXT NOT NULL,
+					role TEXT NOT NULL DEFAULT 'viewer'
+				)
+				`,
+				`
+				INSERT INTO credentialsDowngrade (id, username, password, role)
+				SELECT id, username, password, role
+				FROM credentials
+				`,
+				`DROP TABLE credentials`,
+				`ALTER TABLE credentialsDowngrade RENAME TO credentials`,
+			)
+		},
+	},
+	{
+		version:     11,
+		description: "create append-only auditEvents table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS auditEvents (
+					auditEventID INTEGER NOT NULL PRIMARY KEY,
+					timestamp DATETIME NOT NULL,
+					username TEXT NOT NULL,
+					sourceIP TEXT NOT NULL,
+					method TEXT NOT NULL,
+					path TEXT NOT NULL,
+					payload TEXT NOT NULL,
+					status INTEGER NOT NULL,
+					result TEXT NOT NULL
+				)
+				`,
+				`
+				CREATE TRIGGER IF NOT EXISTS auditEventsNoUpdate BEFORE UPDATE ON auditEvents
+				BEGIN
+					SELECT RAISE(ABORT, 'auditEvents is append-only');
+				END
+				`,
+				`
+				CREATE TRIGGER IF NOT EXISTS auditEventsNoDelete BEFORE DELETE ON auditEvents
+				BEGIN
+					SELECT RAISE(ABORT, 'auditEvents is append-only');
+				END
+				`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx, `DROP TABLE IF EXISTS auditEvents`)
+		},
+	},
+	{
+		version:     12,
+		description: "store map dimensions with tile revisions",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`ALTER TABLE tileRevisions ADD COLUMN rows INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE tileRevisions ADD COLUMN cols INTEGER NOT NULL DEFAULT 0`,
+			)
+		},
+		// SQLite can't drop columns, so the table is rebuilt without them
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				tileRevisionsTableSchema("tileRevisionsDowngrade"),
+				`ALTER TABLE tileRevisionsDowngrade ADD COLUMN missionID INTEGER NOT NULL DEFAULT 0`,
+				`
+				INSERT INTO tileRevisionsDowngrade (revisionID, timestamp, indx, value, previousValue, cause, author, missionID)
+				SELECT revisionID, timestamp, indx, value, previousValue, cause, author, missionID
+				FROM tileRevisions
+				`,
+				`DROP TABLE tileRevisions`,
+				`ALTER TABLE tileRevisionsDowngrade RENAME TO tileRevisions`,
+			)
+		},
+	},
+	{
+		version:     13,
+		description: "move live keep-out zones to their own table",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				CREATE TABLE IF NOT EXISTS liveKeepOutZones (
+					zoneID INTEGER NOT NULL PRIMARY KEY,
+					name TEXT NOT NULL,
+					kind TEXT NOT NULL,
+					shape TEXT NOT NULL
+				)
+				`,
+				// Live zones used to be stored under map id 0
+				`
+				INSERT INTO liveKeepOutZones (zoneID, name, kind, shape)
+				SELECT zoneID, name, kind, shape
+				FROM keepOutZones
+				WHERE mapID = 0
+				`,
+				`DELETE FROM keepOutZones WHERE mapID = 0`,
+			)
+		},
+		down: func(ctx context.Context, tx *sql.Tx) error {
+			return execStatements(ctx, tx,
+				`
+				INSERT INTO keepOutZones (mapID, name, kind, shape)
+				SELECT 0, name, kind, shape
+				FROM liveKeepOutZones
+				ORDER BY zoneID
+				`,
+				`DROP TABLE IF EXISTS liveKeepOutZones`,
+			)
+		},
+	},
+}
+
+// Version of the newest migration step known to this server
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+func execStatements(ctx context.Context, tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	Applies and rolls back migration steps of a db backend.
+	The queries on schema_version only use syntax that is supported by SQLite and PostgreSQL.
+*/
+type schemaMigrator struct {
+	transact           func(ctx context.Context, f func(ctx context.Context, tx *sql.Tx) error) error
+	logger             *zap.Logger
+	migrations         []migration
+	versionTableSchema string
+}
+
+func (m *schemaMigrator) createVersionTable(ctx context.Context) error {
+	if err := m.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.versionTableSchema); err != nil {
+			return fmt.Errorf("failed to create schema_version table: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLMigrations: createVersionTable transaction failed: %w", err)
+	}
+	return nil
+}
+
+// Returns the current schema version of the db (0 if no migration has been applied)
+func (m *schemaMigrator) version(ctx context.Context) (int, error) {
+	if err := m.createVersionTable(ctx); err != nil {
+		return -1, err
+	}
+
+	var version int
+	if err := m.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(max(version), 0)
+			FROM schema_version
+		`).Scan(&version); err != nil {
+			return fmt.Errorf("server: SQLMigrations: failed to get schema version: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return -1, fmt.Errorf("server: SQLMigrations: version transaction failed: %w", err)
+	}
+
+	return version, nil
+}
+
+func (m *schemaMigrator) status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.createVersionTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	if err := m.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT version, applied
+			FROM schema_version
+		`)
+		if err != nil {
+			return fmt.Errorf("server: SQLMigrations: failed to retrieve schema_version rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version int
+			var appliedAt time.Time
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				return fmt.Errorf("server: SQLMigrations: failed to scan schema_version row: %w", err)
+			}
+			applied[version] = appliedAt
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLMigrations: failed to scan last schema_version row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLMigrations: status transaction failed: %w", err)
+	}
+
+	status := []MigrationStatus{}
+	for _, step := range m.migrations {
+		appliedAt, ok := applied[step.version]
+		status = append(status, MigrationStatus{
+			Version:     step.version,
+			Description: step.description,
+			Applied:     ok,
+			AppliedAt:   appliedAt,
+		})
+	}
+
+	return status, nil
+}
+
+// Applies all migration steps up to and including the target version
+func (m *schemaMigrator) up(ctx context.Context, target int) error {
+	current, err := m.version(ctx)
+	if err != nil {
+		return err
+	}
+	if current > len(m.migrations) {
+		return fmt.Errorf("server: SQLMigrations: db schema version %v is newer than this server (latest is %v)", current, len(m.migrations))
+	}
+	if target > len(m.migrations) {
+		return fmt.Errorf("server: SQLMigrations: target version %v does not exist (latest is %v)", target, len(m.migrations))
+	}
+	if target <= current {
+		return nil
+	}
+
+	for _, step := range m.migrations[current:target] {
+		step := step
+		if err := m.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			if err := step.up(ctx, tx); err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO schema_version (version, description, applied)
+				VALUES ($1, $2, $3)
+			`,
+				step.version,
+				step.description,
+				time.Now().UTC(),
+			); err != nil {
+				return fmt.Errorf("failed to record schema version: %w", err)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("server: SQLMigrations: migration %v (%s) failed: %w", step.version, step.description, err)
+		}
+		m.logger.Info("server: SQLMigrations: applied migration", zap.Int("version", step.version), zap.String("description", step.description))
+	}
+
+	return nil
+}
+
+// Rolls back all migration steps above the target version
+func (m *schemaMigrator) down(ctx context.Context, target int) error {
+	current, err := m.version(ctx)
+	if err != nil {
+		return err
+	}
+	if target < 0 {
+		return errors.New("server: SQLMigrations: target version must not be negative")
+	}
+	if current > len(m.migrations) {
+		return fmt.Errorf("server: SQLMigrations: db schema version %v is newer than this server (latest is %v)", current, len(m.migrations))
+	}
+
+	for version := current; version > target; version-- {
+		step := m.migrations[version-1]
+		if err := m.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			if err := step.down(ctx, tx); err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM schema_version
+				WHERE version = $1
+			`,
+				step.version,
+			); err != nil {
+				return fmt.Errorf("failed to remove schema version: %w", err)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("server: SQLMigrations: rollback of migration %v (%s) failed: %w", step.version, step.description, err)
+		}
+		m.logger.Info("server: SQLMigrations: rolled back migration", zap.Int("version", step.version), zap.String("description", step.description))
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) migrator() *schemaMigrator {
+	return &schemaMigrator{
+		transact:   s.TransactContext,
+		logger:     s.logger,
+		migrations: migrations,
+		versionTableSchema: `
+			CREATE TABLE IF NOT EXISTS schema_version (
+				version INTEGER NOT NULL PRIMARY KEY,
+				description TEXT NOT NULL,
+				applied DATETIME NOT NULL
+			)
+		`,
+	}
+}
+
+func (s *SQLiteDB) SchemaVersion(ctx context.Context) (int, error) {
+	return s.migrator().version(ctx)
+}
+
+func (s *SQLiteDB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return s.migrator().status(ctx)
+}
+
+func (s *SQLiteDB) MigrateUp(ctx context.Context, target int) error {
+	return s.migrator().up(ctx, target)
+}
+
+func (s *SQLiteDB) MigrateDown(ctx context.Context, target int) error {
+	return s.migrator().down(ctx, target)
+}
+
+/*
+	Brings the db to the latest schema version.
+	Fails if the db was migrated by a newer server as the schema may be incompatible.
+*/
+func (s *SQLiteDB) migrate(ctx context.Context) error {
+	return s.MigrateUp(ctx, LatestSchemaVersion())
+}
+
+func tileRevisionsTableSchema(table string) string {
+	return `
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
+			revisionID INTEGER NOT NULL PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			indx INTEGER NOT NULL,
+			value INTEGER NOT NULL,
+			previousValue INTEGER NOT NULL,
+			cause TEXT NOT NULL,
+			author TEXT NOT NULL
+		)
+	`
+}
+
+func telemetryTableSchema(table string) string {
+	return `
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
+			telemetryID INTEGER NOT NULL PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			topic TEXT NOT NULL,
+			payload TEXT NOT NULL
+		)
+	`
+}
+
+func instructionsTableSchema(table string) string {
+	return `
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
+			instructionID INTEGER NOT NULL PRIMARY KEY,
+			missionID INTEGER NOT NULL,
+			instruction STRING NOT NULL,
+			value INTEGER NOT NULL,
+			FOREIGN KEY(missionID) REFERENCES missions(missionID)
+		)
+	`
+}
+
+func mapsTableSchema(table string) string {
+	return `
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
+			mapID INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			rows INTEGER NOT NULL,
+			cols INTEGER NOT NULL,
+			layout TEXT NOT NULL,
+			roverIndx INTEGER NOT NULL,
+			roverRotation INTEGER NOT NULL,
+			created DATETIME NOT NULL,
+			updated DATETIME NOT NULL
+		)
+	`
+}
+
+// Dimensions of maps saved before the dimensions were stored with the map
+const (
+	legacyMapRows = 12
+	legacyMapCols = 12
+)
+
+/*
+	Converts maps stored with one row per tile (tiles table) and a separate rover table
+	into the maps table that stores the whole map in a single row.
+	Duplicate map names are made unique by appending the map id.
+*/
+func upgradeMapStorage(ctx context.Context, tx *sql.Tx) error {
+	columns, err := tx.QueryContext(ctx, `
+		SELECT name
+		FROM pragma_table_info('maps')
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to get maps table columns: %w", err)
+	}
+	isLegacy := false
+	for columns.Next() {
+		var column string
+		if err := columns.Scan(&column); err != nil {
+			columns.Close()
+			return fmt.Errorf("failed to scan maps table column: %w", err)
+		}
+		if column == "layout" {
+			columns.Close()
+			return nil
+		}
+		isLegacy = true
+	}
+	columns.Close()
+	if !isLegacy {
+		return nil
+	}
+
+	type legacyMap struct {
+		mapID int
+		name  string
+	}
+	legacyMaps := []legacyMap{}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT mapID, name
+		FROM maps
+		ORDER BY mapID
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve legacy map rows: %w", err)
+	}
+	for rows.Next() {
+		var m legacyMap
+		if err := rows.Scan(&m.mapID, &m.name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan legacy map row: %w", err)
+		}
+		legacyMaps = append(legacyMaps, m)
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, mapsTableSchema("mapsUpgrade")); err != nil {
+		return fmt.Errorf("failed to create mapsUpgrade table: %w", err)
+	}
+
+	now := time.Now().UTC()
+	names := map[string]bool{}
+	for _, m := range legacyMaps {
+		tiles := []int{}
+		tileRows, err := tx.QueryContext(ctx, `
+			SELECT value
+			FROM tiles
+			WHERE mapID = :mapID
+			ORDER BY indx
+		`,
+			sql.Named("mapID", m.mapID),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve legacy tile rows: %w", err)
+		}
+		for tileRows.Next() {
+			var value int
+			if err := tileRows.Scan(&value); err != nil {
+				tileRows.Close()
+				return fmt.Errorf("failed to scan legacy tile row: %w", err)
+			}
+			tiles = append(tiles, value)
+		}
+		tileRows.Close()
+
+		// Maps that were only partially saved start from the default map
+		if len(tiles) != legacyMapRows*legacyMapCols {
+			tiles = defaultTiles(legacyMapRows, legacyMapCols)
+		}
+
+		roverIndx, roverRotation := 5+(5*legacyMapCols), 0
+		if err := tx.QueryRowContext(ctx, `
+			SELECT indx, rotation
+			FROM rover
+			WHERE mapID = :mapID
+		`,
+			sql.Named("mapID", m.mapID),
+		).Scan(&roverIndx, &roverRotation); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to retrieve legacy rover row: %w", err)
+		}
+
+		// Duplicate names get the map id appended, counting up if that name is taken as well
+		name := m.name
+		for suffix := m.mapID; names[name]; suffix++ {
+			name = fmt.Sprintf("%s (%d)", m.name, suffix)
+		}
+		names[name] = true
+
+		layout, err := json.Marshal(tiles)
+		if err != nil {
+			return fmt.Errorf("failed to marshal legacy map layout: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO mapsUpgrade (mapID, name, rows, cols, layout, roverIndx, roverRotation, created, updated)
+			VALUES (:mapID, :name, :rows, :cols, :layout, :roverIndx, :roverRotation, :created, :updated)
+		`,
+			sql.Named("mapID", m.mapID),
+			sql.Named("name", name),
+			sql.Named("rows", legacyMapRows),
+			sql.Named("cols", legacyMapCols),
+			sql.Named("layout", string(layout)),
+			sql.Named("roverIndx", roverIndx),
+			sql.Named("roverRotation", roverRotation),
+			sql.Named("created", now),
+			sql.Named("updated", now),
+		); err != nil {
+			return fmt.Errorf("failed to insert upgraded map: %w", err)
+		}
+	}
+
+	for _, statement := range []string{
+		`DROP TABLE maps`,
+		`DROP TABLE IF EXISTS tiles`,
+		`DROP TABLE IF EXISTS rover`,
+		`ALTER TABLE mapsUpgrade RENAME TO maps`,
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to replace legacy map tables: %w", err)
+		}
+	}
+
+	return nil
+}
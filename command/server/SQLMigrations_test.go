@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// Migration versions must be numbered 1, 2, 3, ... in order as the current version is used as index
+func TestMigrationVersions(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("Migration version not equal to expected version.\nOutput version: %v\nExpected version: %v", m.version, i+1)
+		}
+		if m.up == nil || m.down == nil {
+			t.Errorf("Migration %v is missing an up or down step", m.version)
+		}
+	}
+}
+
+// Both backends must share the same schema versions so that the migrate command behaves the same
+func TestPostgresMigrationVersions(t *testing.T) {
+	if len(postgresMigrations) != len(migrations) {
+		t.Fatalf("Number of postgres migrations not equal to expected number.\nOutput number: %v\nExpected number: %v", len(postgresMigrations), len(migrations))
+	}
+
+	for i, m := range postgresMigrations {
+		if m.version != migrations[i].version || m.description != migrations[i].description {
+			t.Errorf("Postgres migration not equal to expected migration.\nOutput migration: %v %q\nExpected migration: %v %q", m.version, m.description, migrations[i].version, migrations[i].description)
+		}
+		if m.up == nil || m.down == nil {
+			t.Errorf("Postgres migration %v is missing an up or down step", m.version)
+		}
+	}
+}
+
+// Users that existed before roles were added become admins, users added later default to viewer until the role is required
+func TestCredentialRoleMigration(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenSQLiteDBWithoutMigration(ctx, zap.NewNop(), filepath.Join(t.TempDir(), "migration.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.MigrateUp(ctx, 7); err != nil {
+		t.Fatalf("failed to migrate to version 7: %v", err)
+	}
+	if err := db.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO credentials (username, password) VALUES ('existing', 'hash')`)
+		return err
+	}); err != nil {
+		t.Fatalf("failed to insert credential: %v", err)
+	}
+
+	for _, version := range []int{8, LatestSchemaVersion()} {
+		if err := db.MigrateUp(ctx, version); err != nil {
+			t.Fatalf("failed to migrate to version %v: %v", version, err)
+		}
+
+		var userRole role
+		if err := db.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			return tx.QueryRowContext(ctx, `SELECT role FROM credentials WHERE username = 'existing'`).Scan(&userRole)
+		}); err != nil {
+			t.Fatalf("failed to get role: %v", err)
+		}
+		if userRole != roleAdmin {
+			t.Errorf("Role of existing user at version %v not equal to expected role.\nOutput role: %v\nExpected role: %v", version, userRole, roleAdmin)
+		}
+	}
+
+	if err := db.MigrateDown(ctx, 8); err != nil {
+		t.Fatalf("failed to roll back to version 8: %v", err)
+	}
+	var userRole role
+	if err := db.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO credentials (username, password) VALUES ('added', 'hash')`); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, `SELECT role FROM credentials WHERE username = 'added'`).Scan(&userRole)
+	}); err != nil {
+		t.Fatalf("failed to insert credential without role: %v", err)
+	}
+	if userRole != roleViewer {
+		t.Errorf("Role of added user at version 8 not equal to expected role.\nOutput role: %v\nExpected role: %v", userRole, roleViewer)
+	}
+}
+
+// Legacy maps with duplicate names are renamed so that the names are unique, even if the renamed name was taken
+func TestLegacyMapNameMigration(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := OpenSQLiteDBWithoutMigration(ctx, zap.NewNop(), filepath.Join(t.TempDir(), "migration.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return execStatements(ctx, tx,
+			`CREATE TABLE maps (mapID INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL)`,
+			`CREATE TABLE tiles (mapID INTEGER NOT NULL, indx INTEGER NOT NULL, value INTEGER NOT NULL)`,
+			`CREATE TABLE rover (mapID INTEGER NOT NULL, indx INTEGER NOT NULL, rotation INTEGER NOT NULL)`,
+			`INSERT INTO maps (mapID, name) VALUES (1, 'arena'), (2, 'arena (3)'), (3, 'arena'), (4, 'arena')`,
+		)
+	}); err != nil {
+		t.Fatalf("failed to create legacy maps: %v", err)
+	}
+
+	if err := db.MigrateUp(ctx, LatestSchemaVersion()); err != nil {
+		t.Fatalf("failed to migrate legacy maps: %v", err)
+	}
+
+	maps, err := db.getMaps(ctx)
+	if err != nil {
+		t.Fatalf("getMaps returned error: %v", err)
+	}
+	names := map[int]string{}
+	for _, m := range maps {
+		names[m.MapID] = m.Name
+	}
+	expected := map[int]string{1: "arena", 2: "arena (3)", 3: "arena (4)", 4: "arena (5)"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Map names not equal to expected names.\nOutput names: %v\nExpected names: %v", names, expected)
+	}
+}
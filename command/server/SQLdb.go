@@ -7,151 +7,384 @@ package server
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	"go.uber.org/zap"
 )
 
-func (s *SQLiteDB) getLogger() *zap.Logger {
+/*
+	Implementation of DB shared by the SQLite and PostgreSQL backends, only the schema migrations differ (see SQLMigrations.go and PSQLGeneral.go).
+	Queries are written for both: numbered placeholders ($1, $2, ...), COALESCE instead of IFNULL, CAST instead of ::
+	and quoted "timestamp" columns.
+*/
+type sqlDB struct {
+	db      *sql.DB
+	logger  *zap.Logger
+	dialect sqlDialect
+}
+
+type sqlDialect int
+
+const (
+	dialectSQLite sqlDialect = iota
+	dialectPostgres
+)
+
+var numberedPlaceholder = regexp.MustCompile(`\$([0-9]+)`)
+
+// SQLite binds $n placeholders in order of appearance instead of by number, ?n is always bound to the nth argument
+func (s *sqlDB) rebind(query string) string {
+	if s.dialect == dialectSQLite {
+		return numberedPlaceholder.ReplaceAllString(query, "?$1")
+	}
+	return query
+}
+
+func (s *sqlDB) exec(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlDB) query(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlDB) queryRow(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	return tx.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlDB) prepare(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	return tx.PrepareContext(ctx, s.rebind(query))
+}
+
+// Inserts a row and returns the value of its id column (PostgreSQL has no LastInsertId, the bundled SQLite no RETURNING)
+func (s *sqlDB) insert(ctx context.Context, tx *sql.Tx, idColumn string, query string, args ...interface{}) (int, error) {
+	if s.dialect == dialectPostgres {
+		var id int
+		if err := tx.QueryRowContext(ctx, query+" RETURNING "+idColumn, args...).Scan(&id); err != nil {
+			return -1, err
+		}
+		return id, nil
+	}
+
+	result, err := s.exec(ctx, tx, query, args...)
+	if err != nil {
+		return -1, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to get %v: %w", idColumn, err)
+	}
+	return int(id), nil
+}
+
+// Reports whether err is a violation of a UNIQUE constraint on either backend
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+func (s *sqlDB) TransactContext(ctx context.Context, f func(ctx context.Context, tx *sql.Tx) error) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("server: SQLdb: failed to begin a transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.logger.Error("server: SQLdb: transaction rollback failed")
+			}
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	return f(ctx, tx)
+}
+
+func (s *sqlDB) getLogger() *zap.Logger {
 	return s.logger
 }
 
-func (s *SQLiteDB) saveMapName(ctx context.Context, name string) error {
+func (s *sqlDB) insertMap(ctx context.Context, m savedMap) (int, error) {
+	var id int
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO maps (name)
-			VALUES (:name)
-		`,
-			sql.Named("name", name),
-		); err != nil {
-			fmt.Println("not inserted:", name)
-			return fmt.Errorf("server: SQLdb: failed to insert map name data into db: %w", err)
+		insertedID, err := s.insertMapTx(ctx, tx, m)
+		if err != nil {
+			return err
 		}
+		id = insertedID
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: saveMapName transaction failed: %w", err)
+		return -1, fmt.Errorf("server: SQLdb: insertMap transaction failed: %w", err)
 	}
-	return nil
+
+	return id, nil
 }
 
-func (s *SQLiteDB) saveRover(ctx context.Context, mapID int, roverIndex int) error {
+// Inserts a map together with its discovery stats and keep-out zones so that a map is never saved partially
+func (s *sqlDB) insertMapSnapshot(ctx context.Context, m savedMap, stats discoveryStats, zones []keepOutZone) (int, error) {
+	var id int
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO rover (mapID, indx, rotation)
-			VALUES (:mapID, :indx, :rotation)
-		`,
-			sql.Named("mapID", mapID),
-			sql.Named("indx", roverIndex),
-			sql.Named("rotation", Rover.Rotation),
-		); err != nil {
-			fmt.Println("rover not inserted")
-			return fmt.Errorf("server: SQLdb: failed to insert rover data into db: %w", err)
+		insertedID, err := s.insertMapTx(ctx, tx, m)
+		if err != nil {
+			return err
+		}
+		if err := s.saveDiscoveryStatsTx(ctx, tx, insertedID, stats); err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			if _, err := s.insertKeepOutZoneTx(ctx, tx, insertedID, zone); err != nil {
+				return err
+			}
 		}
+		id = insertedID
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: saveRover transaction failed: %w", err)
+		return -1, fmt.Errorf("server: SQLdb: insertMapSnapshot transaction failed: %w", err)
 	}
-	return nil
+
+	return id, nil
 }
 
-func (s *SQLiteDB) insertMap(ctx context.Context, tiles []int, mapID int) error {
+// Inserts a map that was not recorded by a mission together with a new mission of its own, returns the map and mission id
+func (s *sqlDB) insertImportedMap(ctx context.Context, m savedMap) (int, int, error) {
+	var mapID, missionID int
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		insertedMissionID, err := s.insertMissionTx(ctx, tx, m.Created)
+		if err != nil {
+			return err
+		}
+		m.MissionID = insertedMissionID
+
+		insertedMapID, err := s.insertMapTx(ctx, tx, m)
+		if err != nil {
+			return err
+		}
+		mapID, missionID = insertedMapID, insertedMissionID
+		return nil
+	}); err != nil {
+		return -1, -1, fmt.Errorf("server: SQLdb: insertImportedMap transaction failed: %w", err)
+	}
+
+	return mapID, missionID, nil
+}
+
+func (s *sqlDB) insertMapTx(ctx context.Context, tx *sql.Tx, m savedMap) (int, error) {
+	layout, err := json.Marshal(m.Tiles)
+	if err != nil {
+		return -1, fmt.Errorf("server: SQLdb: failed to marshal map layout: %w", err)
+	}
 
-		for i := 0; i < 144; i++ {
+	id, err := s.insert(ctx, tx, "mapID", `
+		INSERT INTO maps (name, rows, cols, layout, roverIndx, roverRotation, missionID, created, updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`,
+		m.Name,
+		m.Rows,
+		m.Cols,
+		string(layout),
+		m.RoverIndx,
+		m.RoverRotation,
+		m.MissionID,
+		m.Created.UTC(),
+		m.Updated.UTC(),
+	)
+	if isUniqueViolation(err) {
+		return -1, errMapNameTaken
+	}
+	if err != nil {
+		return -1, fmt.Errorf("server: SQLdb: failed to insert map into db: %w", err)
+	}
+	return id, nil
+}
 
-			if _, err := tx.ExecContext(ctx, `
-			INSERT INTO tiles (indx, mapID, value)
-			VALUES (:indx, :mapID, :value )
+func (s *sqlDB) getMap(ctx context.Context, mapID int) (savedMap, error) {
+	var m savedMap
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var layout string
+		if err := s.queryRow(ctx, tx, `
+			SELECT mapID, name, rows, cols, layout, roverIndx, roverRotation, missionID, created, updated
+			FROM maps
+			WHERE mapID = $1
 		`,
-				sql.Named("indx", i),
-				sql.Named("mapID", mapID),
-				sql.Named("value", tiles[i]),
-			); err != nil {
-				fmt.Println("not inserted:", i, tiles[i], mapID)
-				return fmt.Errorf("server: SQLdb: failed to insert map into db: %w", err)
+			mapID,
+		).Scan(
+			&m.MapID,
+			&m.Name,
+			&m.Rows,
+			&m.Cols,
+			&layout,
+			&m.RoverIndx,
+			&m.RoverRotation,
+			&m.MissionID,
+			&m.Created,
+			&m.Updated,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errMapNotFound
 			}
+			return fmt.Errorf("server: SQLdb: failed to find map row: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(layout), &m.Tiles); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to unmarshal map layout: %w", err)
 		}
-		return nil
 
+		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: insertMap transaction failed: %w", err)
+		return savedMap{}, fmt.Errorf("server: SQLdb: getMap transaction failed: %w", err)
 	}
 
-	return nil
+	return m, nil
 }
 
-func (s *SQLiteDB) retriveMap(ctx context.Context, mapID int) error {
-
+// Returns all saved maps without their layout
+func (s *sqlDB) getMaps(ctx context.Context) ([]savedMap, error) {
+	maps := []savedMap{}
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		rows, err := tx.QueryContext(ctx, `
-			SELECT indx, value 
-			FROM tiles 
-			WHERE mapID = :mID
-			`,
-			sql.Named("mID", mapID),
-		)
+		rows, err := s.query(ctx, tx, `
+			SELECT mapID, name, rows, cols, roverIndx, roverRotation, missionID, created, updated
+			FROM maps
+			ORDER BY mapID
+		`)
 		if err != nil {
-			return fmt.Errorf("server: SQLdb: failed to retrieve data from tiles rows: %w", err)
+			return fmt.Errorf("server: SQLdb: failed to retrieve map rows: %w", err)
 		}
 		defer rows.Close()
 
 		for rows.Next() {
-			var tileID, value int
+			var m savedMap
 			if err := rows.Scan(
-				&tileID,
-				&value,
+				&m.MapID,
+				&m.Name,
+				&m.Rows,
+				&m.Cols,
+				&m.RoverIndx,
+				&m.RoverRotation,
+				&m.MissionID,
+				&m.Created,
+				&m.Updated,
 			); err != nil {
-				return fmt.Errorf("server: SQLdb: failed to scan tiles row: %w", err)
+				return fmt.Errorf("server: SQLdb: failed to scan map row: %w", err)
 			}
-			dbMap.Tiles[tileID] = value
+			maps = append(maps, m)
 		}
 		if err := rows.Err(); err != nil {
-			return fmt.Errorf("server: SQLdb: failed to scan last tile row: %w", err)
+			return fmt.Errorf("server: SQLdb: failed to scan last map row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getMaps transaction failed: %w", err)
+	}
+
+	return maps, nil
+}
+
+func (s *sqlDB) updateMap(ctx context.Context, m savedMap) error {
+	layout, err := json.Marshal(m.Tiles)
+	if err != nil {
+		return fmt.Errorf("server: SQLdb: failed to marshal map layout: %w", err)
+	}
+
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE maps
+			SET name = $2, rows = $3, cols = $4, layout = $5, roverIndx = $6, roverRotation = $7, updated = $8
+			WHERE mapID = $1
+		`,
+			m.MapID,
+			m.Name,
+			m.Rows,
+			m.Cols,
+			string(layout),
+			m.RoverIndx,
+			m.RoverRotation,
+			m.Updated.UTC(),
+		)
+		if isUniqueViolation(err) {
+			return errMapNameTaken
+		}
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to update map: %w", err)
 		}
 
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errMapNotFound
+		}
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: retriveMap transaction failed: %w", err)
+		return fmt.Errorf("server: SQLdb: updateMap transaction failed: %w", err)
 	}
 
 	return nil
 }
 
-func (s *SQLiteDB) retriveRover(ctx context.Context, mapID int) error {
-	var indx, rotation int
+// Deletes a map together with its discovery stats and keep-out zones (the instructions belong to its mission)
+func (s *sqlDB) deleteMap(ctx context.Context, mapID int) error {
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if err := tx.QueryRowContext(ctx, `
-			SELECT indx, rotation
-			FROM rover
-			WHERE mapID = :mID
+		result, err := s.exec(ctx, tx, `
+			DELETE FROM maps
+			WHERE mapID = $1
 		`,
-			sql.Named("mID", mapID),
-		).Scan(&indx, &rotation); err != nil {
-			return fmt.Errorf("server: SQLdb: failed to find id row: %w", err)
+			mapID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to delete map from db: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errMapNotFound
+		}
+
+		for _, table := range []string{"discovery", "keepOutZones"} {
+			if _, err := s.exec(ctx, tx, `
+				DELETE FROM `+table+`
+				WHERE mapID = $1
+			`,
+				mapID,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to delete map data from %s: %w", table, err)
+			}
 		}
 
-		fmt.Println("rover index: ", indx, "rotation: ", rotation)
-		dbMap.RoverRotation = rotation
-		dbMap.RoverIndx = indx
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: retriveRover transaction failed: %w", err)
+		return fmt.Errorf("server: SQLdb: deleteMap transaction failed: %w", err)
 	}
 
 	return nil
 }
 
-func (s *SQLiteDB) getMapID(ctx context.Context, name string) (int, error) {
+func (s *sqlDB) getMapID(ctx context.Context, name string) (int, error) {
 
 	var id int
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if err := tx.QueryRowContext(ctx, `
+		if err := s.queryRow(ctx, tx, `
 			SELECT mapID
 			FROM maps
-			WHERE name = :mapName
+			WHERE name = $1
 		`,
-			sql.Named("mapName", name),
+			name,
 		).Scan(&id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errMapNotFound
+			}
 			return fmt.Errorf("server: SQLdb: failed to find id row: %w", err)
 		}
 		return nil
@@ -162,53 +395,83 @@ func (s *SQLiteDB) getMapID(ctx context.Context, name string) (int, error) {
 	return id, nil
 }
 
-func (s *SQLiteDB) getLatestMapID(ctx context.Context) (int, error) {
-
+func (s *sqlDB) insertMission(ctx context.Context, started time.Time) (int, error) {
 	var id int
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if err := tx.QueryRowContext(ctx, `
-			SELECT max(mapID)
-			FROM maps
-		`,
-		).Scan(&id); err != nil {
-			id = 0
-			s.logger.Info("server: SQLdb: couldnt get latest map id, setting mapID to 0 (so next is 1)")
-
-			return fmt.Errorf("server: SQLdb: failed to find id row: %w", err)
+		insertedID, err := s.insertMissionTx(ctx, tx, started)
+		if err != nil {
+			return err
 		}
-
+		id = insertedID
 		return nil
 	}); err != nil {
-		return -1, fmt.Errorf("server: SQLdb: getLatestMapID transaction failed: %w", err)
+		return -1, fmt.Errorf("server: SQLdb: insertMission transaction failed: %w", err)
 	}
 
 	return id, nil
 }
 
-func (s *SQLiteDB) storeInstruction(ctx context.Context, instruction string, value int) error {
-	s.logger.Info("storing instruction: inside function")
-
-	mapID, err := s.getLatestMapID(ctx)
+func (s *sqlDB) insertMissionTx(ctx context.Context, tx *sql.Tx, started time.Time) (int, error) {
+	id, err := s.insert(ctx, tx, "missionID", `
+		INSERT INTO missions (started)
+		VALUES ($1)
+	`,
+		started.UTC(),
+	)
 	if err != nil {
-		fmt.Println("no mapID : ", mapID)
-		fmt.Println("Error: couldnt get latest map ID")
+		return -1, fmt.Errorf("server: SQLdb: failed to insert mission into db: %w", err)
 	}
+	return id, nil
+}
+
+func (s *sqlDB) getMissions(ctx context.Context) ([]mission, error) {
+	missions := []mission{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT missionID, started
+			FROM missions
+			ORDER BY missionID
+		`)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve mission rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var m mission
+			if err := rows.Scan(
+				&m.MissionID,
+				&m.Started,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan mission row: %w", err)
+			}
+			missions = append(missions, m)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last mission row: %w", err)
+		}
 
-	s.logger.Info("storing instruction: map id", zap.Int("mapID", mapID))
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getMissions transaction failed: %w", err)
+	}
+
+	return missions, nil
+}
 
+func (s *sqlDB) storeInstruction(ctx context.Context, missionID int, instruction string, value int) error {
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO instructions (mapID, instruction, value)
-			VALUES (:mapID, :instruction, :value )
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO instructions (missionID, instruction, value)
+			VALUES ($1, $2, $3)
 		`,
-			sql.Named("mapID", (mapID+1)),
-			sql.Named("instruction", instruction),
-			sql.Named("value", value),
+			missionID,
+			instruction,
+			value,
 		); err != nil {
-			fmt.Println("not inserted:", mapID, instruction, value)
 			return fmt.Errorf("server: SQLdb: failed to insert instruction into db: %w", err)
 		}
-		s.logger.Info("inserted instruction", zap.Int("mapID", mapID), zap.String("instruction", instruction), zap.Int("value", value))
+		s.logger.Info("inserted instruction", zap.Int("missionID", missionID), zap.String("instruction", instruction), zap.Int("value", value))
 
 		return nil
 	}); err != nil {
@@ -218,38 +481,31 @@ func (s *SQLiteDB) storeInstruction(ctx context.Context, instruction string, val
 	return nil
 }
 
-func (s *SQLiteDB) retriveInstruction(ctx context.Context, mapID int) error {
-
-	var instr string
-	var val int
-
+func (s *sqlDB) getInstructions(ctx context.Context, missionID int) ([]driveInstruction, error) {
+	instructions := []driveInstruction{}
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		rows, err := tx.QueryContext(ctx, `
-			SELECT instruction, value 
+		rows, err := s.query(ctx, tx, `
+			SELECT instruction, value
 			FROM instructions
-			WHERE mapID = :mID
-			ORDER BY instructionID 
+			WHERE missionID = $1
+			ORDER BY instructionID
 			`,
-			sql.Named("mID", mapID),
+			missionID,
 		)
 		if err != nil {
-			fmt.Println("did not work extracting instructions")
 			return fmt.Errorf("server: SQLdb: failed to retrieve data from instruction rows: %w", err)
 		}
 		defer rows.Close()
+
 		for rows.Next() {
+			var instruction driveInstruction
 			if err := rows.Scan(
-				&instr,
-				&val,
+				&instruction.Instruction,
+				&instruction.Value,
 			); err != nil {
 				return fmt.Errorf("server: SQLdb: failed to scan instruction row: %w", err)
 			}
-
-			dbMap.Instructions = append(dbMap.Instructions, driveInstruction{
-				Instruction: instr,
-				Value:       val,
-			})
-
+			instructions = append(instructions, instruction)
 		}
 		if err := rows.Err(); err != nil {
 			return fmt.Errorf("server: SQLdb: failed to scan last instruction row: %w", err)
@@ -257,93 +513,1042 @@ func (s *SQLiteDB) retriveInstruction(ctx context.Context, mapID int) error {
 
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: retriveInstruction transaction failed: %w", err)
+		return nil, fmt.Errorf("server: SQLdb: getInstructions transaction failed: %w", err)
 	}
 
-	return nil
+	return instructions, nil
 }
 
-func (s *SQLiteDB) resetInstructions(ctx context.Context, mapID int) error {
+func (s *sqlDB) insertGroundTruth(ctx context.Context, name string, groundTruth tileMap) error {
+	layout, err := json.Marshal(groundTruth.Tiles)
+	if err != nil {
+		return fmt.Errorf("server: SQLdb: failed to encode ground truth layout: %w", err)
+	}
 
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, `
-			DELETE FROM instructions
-			WHERE mapID = :mapID
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO groundTruths (name, rows, cols, layout)
+			VALUES ($1, $2, $3, $4)
 		`,
-			sql.Named("mapID", mapID),
+			name,
+			groundTruth.Rows,
+			groundTruth.Cols,
+			string(layout),
 		); err != nil {
-			fmt.Println("instructions not deleted")
-			return fmt.Errorf("server: SQLdb: failed to delete instructions from db: %w", err)
+			return fmt.Errorf("server: SQLdb: failed to insert ground truth into db: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: insertGroundTruth transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) getGroundTruth(ctx context.Context, name string) (tileMap, error) {
+	var groundTruth tileMap
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var layout string
+		if err := s.queryRow(ctx, tx, `
+			SELECT rows, cols, layout
+			FROM groundTruths
+			WHERE name = $1
+		`,
+			name,
+		).Scan(&groundTruth.Rows, &groundTruth.Cols, &layout); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to find ground truth row: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(layout), &groundTruth.Tiles); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to decode ground truth layout: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return tileMap{}, fmt.Errorf("server: SQLdb: getGroundTruth transaction failed: %w", err)
+	}
+
+	return groundTruth, nil
+}
+
+func (s *sqlDB) getGroundTruthNames(ctx context.Context) ([]string, error) {
+	names := []string{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT name
+			FROM groundTruths
+			ORDER BY name
+		`)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve ground truth rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan ground truth row: %w", err)
+			}
+			names = append(names, name)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last ground truth row: %w", err)
 		}
-		s.logger.Info("instructions deleted successfully")
 
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: resetInstructions transaction failed: %w", err)
+		return nil, fmt.Errorf("server: SQLdb: getGroundTruthNames transaction failed: %w", err)
 	}
 
+	return names, nil
+}
+
+func (s *sqlDB) saveDiscoveryStats(ctx context.Context, mapID int, stats discoveryStats) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return s.saveDiscoveryStatsTx(ctx, tx, mapID, stats)
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: saveDiscoveryStats transaction failed: %w", err)
+	}
 	return nil
+}
 
+func (s *sqlDB) saveDiscoveryStatsTx(ctx context.Context, tx *sql.Tx, mapID int, stats discoveryStats) error {
+	if _, err := s.exec(ctx, tx, `
+		INSERT INTO discovery (mapID, distance, fullyDiscovered, timeToFullDiscovery, distanceToFullDiscovery)
+		VALUES ($1, $2, $3, $4, $5)
+	`,
+		mapID,
+		stats.distance,
+		stats.fullyDiscovered,
+		stats.timeToFullDiscovery.Seconds(),
+		stats.distanceToFullDiscovery,
+	); err != nil {
+		return fmt.Errorf("server: SQLdb: failed to insert discovery stats into db: %w", err)
+	}
+	return nil
 }
 
-func (s *SQLiteDB) insertCredentials(ctx context.Context, credential credential) error {
+// Returns empty stats for maps that were saved without them
+func (s *sqlDB) getDiscoveryStats(ctx context.Context, mapID int) (discoveryStats, error) {
+	var stats discoveryStats
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO credentials (username, password)
-			VALUES (:username, :password)
+		var seconds float64
+		err := s.queryRow(ctx, tx, `
+			SELECT distance, fullyDiscovered, timeToFullDiscovery, distanceToFullDiscovery
+			FROM discovery
+			WHERE mapID = $1
 		`,
-			sql.Named("username", credential.username),
-			sql.Named("password", credential.password),
-		); err != nil {
-			return fmt.Errorf("server: SQLdb: failed to insert credential into db: %w", err)
+			mapID,
+		).Scan(&stats.distance, &stats.fullyDiscovered, &seconds, &stats.distanceToFullDiscovery)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to find discovery row: %w", err)
 		}
 
+		stats.timeToFullDiscovery = time.Duration(seconds * float64(time.Second))
 		return nil
 	}); err != nil {
-		return fmt.Errorf("server: SQLdb: insertCredentials transaction failed: %w", err)
+		return discoveryStats{}, fmt.Errorf("server: SQLdb: getDiscoveryStats transaction failed: %w", err)
 	}
-	return nil
+
+	return stats, nil
 }
 
-func (s *SQLiteDB) getCredentials(ctx context.Context) (map[string]string, error) {
-	credentials := map[string]string{}
+func (s *sqlDB) insertTileRevisions(ctx context.Context, revisions []tileRevision) error {
 	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
-		rows, err := tx.QueryContext(ctx, `
-			SELECT username, password
-			FROM credentials
+		stmt, err := s.prepare(ctx, tx, `
+			INSERT INTO tileRevisions (missionID, "timestamp", indx, value, previousValue, cause, author, rows, cols)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		`)
 		if err != nil {
-			return fmt.Errorf("server: SQLdb: failed to retrieve credential rows: %w", err)
+			return fmt.Errorf("server: SQLdb: failed to prepare tile revision insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, revision := range revisions {
+			if _, err := stmt.ExecContext(ctx,
+				revision.MissionID,
+				revision.Timestamp,
+				revision.Indx,
+				revision.Value,
+				revision.PreviousValue,
+				revision.Cause,
+				revision.Author,
+				revision.Rows,
+				revision.Cols,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to insert tile revision into db: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: insertTileRevisions transaction failed: %w", err)
+	}
+	return nil
+}
+
+// Returns revisions with afterRevisionID < revisionID <= toRevisionID in order
+func (s *sqlDB) getTileRevisions(ctx context.Context, afterRevisionID int, toRevisionID int) ([]tileRevision, error) {
+	revisions := []tileRevision{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT revisionID, missionID, "timestamp", indx, value, previousValue, cause, author, rows, cols
+			FROM tileRevisions
+			WHERE revisionID > $1 AND revisionID <= $2
+			ORDER BY revisionID
+		`,
+			afterRevisionID,
+			toRevisionID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve tile revision rows: %w", err)
 		}
 		defer rows.Close()
 
 		for rows.Next() {
-			var username, password string
+			var revision tileRevision
 			if err := rows.Scan(
-				&username,
-				&password,
+				&revision.RevisionID,
+				&revision.MissionID,
+				&revision.Timestamp,
+				&revision.Indx,
+				&revision.Value,
+				&revision.PreviousValue,
+				&revision.Cause,
+				&revision.Author,
+				&revision.Rows,
+				&revision.Cols,
 			); err != nil {
-				return fmt.Errorf("server: SQLdb: failed to scan credential row: %w", err)
+				return fmt.Errorf("server: SQLdb: failed to scan tile revision row: %w", err)
 			}
+			revisions = append(revisions, revision)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last tile revision row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getTileRevisions transaction failed: %w", err)
+	}
+
+	return revisions, nil
+}
 
-			credentials[username] = password
+// Returns the id of the latest map reset at or before revisionID (0 if there is none)
+func (s *sqlDB) getLatestResetRevisionID(ctx context.Context, revisionID int) (int, error) {
+	var id int
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.queryRow(ctx, tx, `
+			SELECT COALESCE(max(revisionID), 0)
+			FROM tileRevisions
+			WHERE indx = $1 AND revisionID <= $2
+		`,
+			mapResetIndx,
+			revisionID,
+		).Scan(&id); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to find reset revision row: %w", err)
 		}
+		return nil
+	}); err != nil {
+		return -1, fmt.Errorf("server: SQLdb: getLatestResetRevisionID transaction failed: %w", err)
+	}
 
-		if err := rows.Err(); err != nil {
-			return fmt.Errorf("server: SQLdb: failed to scan last credential row: %w", err)
+	return id, nil
+}
+
+// Returns the id of the latest revision at or before t (0 if there is none)
+func (s *sqlDB) getRevisionIDAtTime(ctx context.Context, t time.Time) (int, error) {
+	var id int
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.queryRow(ctx, tx, `
+			SELECT COALESCE(max(revisionID), 0)
+			FROM tileRevisions
+			WHERE "timestamp" <= $1
+		`,
+			t.UTC(),
+		).Scan(&id); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to find revision row: %w", err)
 		}
+		return nil
+	}); err != nil {
+		return -1, fmt.Errorf("server: SQLdb: getRevisionIDAtTime transaction failed: %w", err)
+	}
+
+	return id, nil
+}
 
+func (s *sqlDB) getLatestRevisionID(ctx context.Context) (int, error) {
+	var id int
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.queryRow(ctx, tx, `
+			SELECT COALESCE(max(revisionID), 0)
+			FROM tileRevisions
+		`).Scan(&id); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to find revision row: %w", err)
+		}
 		return nil
 	}); err != nil {
-		return nil, fmt.Errorf("server: SQLdb: getCredentials transaction failed: %w", err)
+		return -1, fmt.Errorf("server: SQLdb: getLatestRevisionID transaction failed: %w", err)
 	}
 
-	return credentials, nil
+	return id, nil
+}
+
+func (s *sqlDB) insertTelemetry(ctx context.Context, missionID int, topic string, payload string) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO telemetry (missionID, "timestamp", topic, payload)
+			VALUES ($1, $2, $3, $4)
+		`,
+			missionID,
+			time.Now().UTC(),
+			topic,
+			payload,
+		); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to insert telemetry into db: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: insertTelemetry transaction failed: %w", err)
+	}
+	return nil
+}
+
+// Returns the telemetry of a mission in the order it was received
+func (s *sqlDB) getTelemetry(ctx context.Context, missionID int) ([]telemetryRecord, error) {
+	records := []telemetryRecord{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT missionID, "timestamp", topic, payload
+			FROM telemetry
+			WHERE missionID = $1
+			ORDER BY telemetryID
+		`,
+			missionID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve telemetry rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var record telemetryRecord
+			if err := rows.Scan(
+				&record.MissionID,
+				&record.Timestamp,
+				&record.Topic,
+				&record.Payload,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan telemetry row: %w", err)
+			}
+			records = append(records, record)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last telemetry row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getTelemetry transaction failed: %w", err)
+	}
+
+	return records, nil
+}
+
+func (s *sqlDB) insertAnnotation(ctx context.Context, annotation annotation) (int, error) {
+	var id int
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		insertedID, err := s.insert(ctx, tx, "annotationID", `
+			INSERT INTO annotations (x, y, text, author, "timestamp")
+			VALUES ($1, $2, $3, $4, $5)
+		`,
+			annotation.X,
+			annotation.Y,
+			annotation.Text,
+			annotation.Author,
+			annotation.Timestamp.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to insert annotation into db: %w", err)
+		}
+		id = insertedID
+		return nil
+	}); err != nil {
+		return -1, fmt.Errorf("server: SQLdb: insertAnnotation transaction failed: %w", err)
+	}
+	return id, nil
+}
+
+func (s *sqlDB) getAnnotations(ctx context.Context) ([]annotation, error) {
+	annotations := []annotation{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT annotationID, x, y, text, author, "timestamp"
+			FROM annotations
+			ORDER BY annotationID
+		`)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve annotation rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var a annotation
+			if err := rows.Scan(
+				&a.AnnotationID,
+				&a.X,
+				&a.Y,
+				&a.Text,
+				&a.Author,
+				&a.Timestamp,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan annotation row: %w", err)
+			}
+			annotations = append(annotations, a)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last annotation row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getAnnotations transaction failed: %w", err)
+	}
+
+	return annotations, nil
+}
+
+func (s *sqlDB) deleteAnnotation(ctx context.Context, annotationID int) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			DELETE FROM annotations
+			WHERE annotationID = $1
+		`,
+			annotationID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to delete annotation from db: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return fmt.Errorf("server: SQLdb: annotation %v does not exist", annotationID)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: deleteAnnotation transaction failed: %w", err)
+	}
+	return nil
+}
+
+// Rectangle or polygon of a keep-out zone is stored as json
+type keepOutZoneShape struct {
+	Rectangle *tileRectangle `json:"rectangle,omitempty"`
+	Polygon   []point        `json:"polygon,omitempty"`
+}
+
+func marshalKeepOutZoneShape(zone keepOutZone) (string, error) {
+	shape, err := json.Marshal(keepOutZoneShape{
+		Rectangle: zone.Rectangle,
+		Polygon:   zone.Polygon,
+	})
+	if err != nil {
+		return "", fmt.Errorf("server: SQLdb: failed to marshal keep-out zone shape: %w", err)
+	}
+	return string(shape), nil
+}
+
+// Stores a keep-out zone with a saved map
+func (s *sqlDB) insertKeepOutZoneTx(ctx context.Context, tx *sql.Tx, mapID int, zone keepOutZone) (int, error) {
+	shape, err := marshalKeepOutZoneShape(zone)
+	if err != nil {
+		return -1, err
+	}
+
+	id, err := s.insert(ctx, tx, "zoneID", `
+		INSERT INTO keepOutZones (mapID, name, kind, shape)
+		VALUES ($1, $2, $3, $4)
+	`,
+		mapID,
+		zone.Name,
+		zone.Kind,
+		shape,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("server: SQLdb: failed to insert keep-out zone into db: %w", err)
+	}
+	return id, nil
+}
+
+// Returns the keep-out zones stored with a saved map
+func (s *sqlDB) getKeepOutZones(ctx context.Context, mapID int) ([]keepOutZone, error) {
+	var zones []keepOutZone
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT zoneID, name, kind, shape
+			FROM keepOutZones
+			WHERE mapID = $1
+			ORDER BY zoneID
+		`,
+			mapID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve keep-out zone rows: %w", err)
+		}
+		defer rows.Close()
+
+		zones, err = scanKeepOutZones(rows)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getKeepOutZones transaction failed: %w", err)
+	}
+
+	return zones, nil
+}
+
+func scanKeepOutZones(rows *sql.Rows) ([]keepOutZone, error) {
+	zones := []keepOutZone{}
+	for rows.Next() {
+		var z keepOutZone
+		var shape string
+		if err := rows.Scan(
+			&z.ZoneID,
+			&z.Name,
+			&z.Kind,
+			&shape,
+		); err != nil {
+			return nil, fmt.Errorf("server: SQLdb: failed to scan keep-out zone row: %w", err)
+		}
+
+		var zoneShape keepOutZoneShape
+		if err := json.Unmarshal([]byte(shape), &zoneShape); err != nil {
+			return nil, fmt.Errorf("server: SQLdb: failed to unmarshal keep-out zone shape: %w", err)
+		}
+		z.Rectangle = zoneShape.Rectangle
+		z.Polygon = zoneShape.Polygon
+
+		zones = append(zones, z)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: failed to scan last keep-out zone row: %w", err)
+	}
+
+	return zones, nil
+}
+
+func (s *sqlDB) insertLiveKeepOutZone(ctx context.Context, zone keepOutZone) (int, error) {
+	var id int
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		insertedID, err := s.insertLiveKeepOutZoneTx(ctx, tx, zone)
+		if err != nil {
+			return err
+		}
+		id = insertedID
+		return nil
+	}); err != nil {
+		return -1, fmt.Errorf("server: SQLdb: insertLiveKeepOutZone transaction failed: %w", err)
+	}
+	return id, nil
+}
+
+func (s *sqlDB) insertLiveKeepOutZoneTx(ctx context.Context, tx *sql.Tx, zone keepOutZone) (int, error) {
+	shape, err := marshalKeepOutZoneShape(zone)
+	if err != nil {
+		return -1, err
+	}
+
+	id, err := s.insert(ctx, tx, "zoneID", `
+		INSERT INTO liveKeepOutZones (name, kind, shape)
+		VALUES ($1, $2, $3)
+	`,
+		zone.Name,
+		zone.Kind,
+		shape,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("server: SQLdb: failed to insert live keep-out zone into db: %w", err)
+	}
+	return id, nil
+}
+
+// Replaces all keep-out zones of the live map and returns the new zones with their ids
+func (s *sqlDB) replaceLiveKeepOutZones(ctx context.Context, zones []keepOutZone) ([]keepOutZone, error) {
+	replaced := []keepOutZone{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := s.exec(ctx, tx, `
+			DELETE FROM liveKeepOutZones
+		`); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to delete live keep-out zones from db: %w", err)
+		}
+
+		for _, zone := range zones {
+			id, err := s.insertLiveKeepOutZoneTx(ctx, tx, zone)
+			if err != nil {
+				return err
+			}
+			zone.ZoneID = id
+			replaced = append(replaced, zone)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: replaceLiveKeepOutZones transaction failed: %w", err)
+	}
+	return replaced, nil
+}
+
+func (s *sqlDB) getLiveKeepOutZones(ctx context.Context) ([]keepOutZone, error) {
+	var zones []keepOutZone
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT zoneID, name, kind, shape
+			FROM liveKeepOutZones
+			ORDER BY zoneID
+		`)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve live keep-out zone rows: %w", err)
+		}
+		defer rows.Close()
+
+		zones, err = scanKeepOutZones(rows)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getLiveKeepOutZones transaction failed: %w", err)
+	}
+
+	return zones, nil
+}
+
+func (s *sqlDB) deleteLiveKeepOutZone(ctx context.Context, zoneID int) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			DELETE FROM liveKeepOutZones
+			WHERE zoneID = $1
+		`,
+			zoneID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to delete live keep-out zone from db: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return fmt.Errorf("server: SQLdb: keep-out zone %v does not exist", zoneID)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: deleteLiveKeepOutZone transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) insertSession(ctx context.Context, session session) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO sessions (sessionID, username, refreshTokenHash, created, expires)
+			VALUES ($1, $2, $3, $4, $5)
+		`,
+			session.SessionID,
+			session.Username,
+			session.RefreshTokenHash,
+			session.Created.UTC(),
+			session.Expires.UTC(),
+		); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to insert session into db: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: insertSession transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) getSession(ctx context.Context, sessionID string) (session, error) {
+	var session session
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var revoked sql.NullTime
+		if err := s.queryRow(ctx, tx, `
+			SELECT sessionID, username, refreshTokenHash, created, expires, revoked
+			FROM sessions
+			WHERE sessionID = $1
+		`,
+			sessionID,
+		).Scan(
+			&session.SessionID,
+			&session.Username,
+			&session.RefreshTokenHash,
+			&session.Created,
+			&session.Expires,
+			&revoked,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errSessionNotFound
+			}
+			return fmt.Errorf("server: SQLdb: failed to find session row: %w", err)
+		}
+		session.Revoked = revoked.Valid
+
+		return nil
+	}); err != nil {
+		return session, fmt.Errorf("server: SQLdb: getSession transaction failed: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *sqlDB) updateSessionRefreshToken(ctx context.Context, sessionID string, refreshTokenHash string, expires time.Time) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE sessions
+			SET refreshTokenHash = $1, expires = $2
+			WHERE sessionID = $3
+		`,
+			refreshTokenHash,
+			expires.UTC(),
+			sessionID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to update session: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errSessionNotFound
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: updateSessionRefreshToken transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) revokeSession(ctx context.Context, sessionID string) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE sessions
+			SET revoked = $1
+			WHERE sessionID = $2 AND revoked IS NULL
+		`,
+			time.Now().UTC(),
+			sessionID,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to revoke session: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errSessionNotFound
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: revokeSession transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) getRevokedSessionIDs(ctx context.Context, revokedAfter time.Time) ([]string, error) {
+	sessionIDs := []string{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT sessionID
+			FROM sessions
+			WHERE revoked >= $1
+		`,
+			revokedAfter.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve session rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var sessionID string
+			if err := rows.Scan(&sessionID); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan session row: %w", err)
+			}
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last session row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getRevokedSessionIDs transaction failed: %w", err)
+	}
+
+	return sessionIDs, nil
+}
+
+func (s *sqlDB) revokeUserSessions(ctx context.Context, username string) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := s.exec(ctx, tx, `
+			UPDATE sessions
+			SET revoked = $1
+			WHERE username = $2 AND revoked IS NULL
+		`,
+			time.Now().UTC(),
+			username,
+		); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to revoke sessions: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: revokeUserSessions transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) insertCredentials(ctx context.Context, credential credential) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var count int
+		if err := s.queryRow(ctx, tx, `
+			SELECT count(*)
+			FROM credentials
+			WHERE username = $1
+		`,
+			credential.username,
+		).Scan(&count); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to check username: %w", err)
+		}
+		if count > 0 {
+			return errUsernameTaken
+		}
+
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO credentials (username, password, role, disabled)
+			VALUES ($1, $2, $3, $4)
+		`,
+			credential.username,
+			credential.password,
+			string(credential.role),
+			credential.disabled,
+		); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to insert credential into db: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: insertCredentials transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) getCredentials(ctx context.Context) (map[string]credential, error) {
+	credentials := map[string]credential{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT username, password, role, disabled
+			FROM credentials
+		`)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve credential rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var cred credential
+			if err := rows.Scan(
+				&cred.username,
+				&cred.password,
+				&cred.role,
+				&cred.disabled,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan credential row: %w", err)
+			}
+
+			credentials[cred.username] = cred
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last credential row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getCredentials transaction failed: %w", err)
+	}
+
+	return credentials, nil
+}
+
+func (s *sqlDB) updateCredentialPassword(ctx context.Context, username string, passwordHash string) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE credentials
+			SET password = $1
+			WHERE username = $2
+		`,
+			passwordHash,
+			username,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to update password: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errUserNotFound
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: updateCredentialPassword transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) updateCredentialRole(ctx context.Context, username string, userRole role) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE credentials
+			SET role = $1
+			WHERE username = $2
+		`,
+			string(userRole),
+			username,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to update role: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errUserNotFound
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: updateCredentialRole transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) updateCredentialDisabled(ctx context.Context, username string, disabled bool) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE credentials
+			SET disabled = $1
+			WHERE username = $2
+		`,
+			disabled,
+			username,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to update disabled state: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errUserNotFound
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: updateCredentialDisabled transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) deleteCredentials(ctx context.Context, username string) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			DELETE FROM credentials
+			WHERE username = $1
+		`,
+			username,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to delete credential from db: %w", err)
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errUserNotFound
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: deleteCredentials transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) insertAuditRecord(ctx context.Context, record auditRecord) error {
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO auditEvents ("timestamp", username, sourceIP, method, path, payload, status, result)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`,
+			record.Timestamp.UTC(),
+			record.Username,
+			record.SourceIP,
+			record.Method,
+			record.Path,
+			record.Payload,
+			record.Status,
+			record.Result,
+		); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to insert audit record into db: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("server: SQLdb: insertAuditRecord transaction failed: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) getAuditRecords(ctx context.Context, filter auditFilter) ([]auditRecord, error) {
+	records := []auditRecord{}
+	if err := s.TransactContext(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := s.query(ctx, tx, `
+			SELECT auditEventID, "timestamp", username, sourceIP, method, path, payload, status, result
+			FROM auditEvents
+			WHERE "timestamp" >= $1 AND "timestamp" <= $2
+				AND (CAST($3 AS TEXT) = '' OR username = CAST($3 AS TEXT))
+				AND (CAST($4 AS TEXT) = '' OR substr(path, 1, length(CAST($4 AS TEXT))) = CAST($4 AS TEXT))
+			ORDER BY auditEventID DESC
+			LIMIT $5
+		`,
+			filter.From.UTC(),
+			filter.To.UTC(),
+			filter.Username,
+			filter.Path,
+			filter.Limit,
+		)
+		if err != nil {
+			return fmt.Errorf("server: SQLdb: failed to retrieve audit rows: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var record auditRecord
+			if err := rows.Scan(
+				&record.AuditEventID,
+				&record.Timestamp,
+				&record.Username,
+				&record.SourceIP,
+				&record.Method,
+				&record.Path,
+				&record.Payload,
+				&record.Status,
+				&record.Result,
+			); err != nil {
+				return fmt.Errorf("server: SQLdb: failed to scan audit row: %w", err)
+			}
+			records = append(records, record)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("server: SQLdb: failed to scan last audit row: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("server: SQLdb: getAuditRecords transaction failed: %w", err)
+	}
+
+	return records, nil
+}
+
+func (s *sqlDB) ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("server: SQLdb: failed to ping db: %w", err)
+	}
+	return nil
 }
 
-func (s *SQLiteDB) Close() error {
+func (s *sqlDB) Close() error {
 	if err := s.db.Close(); err != nil {
-		return fmt.Errorf("server: SQLdb: failed to close sqlite db: %w", err)
+		return fmt.Errorf("server: SQLdb: failed to close db: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+/*
+	Versioned API for scripts and tools (see client/ for the generated Go client).
+	Unlike the unversioned routes used by the webpage, requests and responses are JSON objects
+	and every route is described by the OpenAPI spec at GET /api/v1/openapi.json.
+	Breaking changes need a new version, the unversioned routes stay as they are for the webpage.
+*/
+const apiV1Prefix = "/api/v1"
+
+type apiRoute struct {
+	method      string
+	path        string // relative to apiV1Prefix
+	operationID string
+	summary     string
+	role        role // minimum role of the user, empty for public routes
+	query       []apiQueryParameter
+	request     interface{} // value of the request body type, nil if there is no body
+	response    interface{} // value of the response body type, nil if there is no body
+	status      int         // of successful responses, 200 if not set
+	handler     http.HandlerFunc
+}
+
+type apiQueryParameter struct {
+	name        string
+	description string
+	value       interface{} // value of the parameter type
+}
+
+type driveDistanceRequest struct {
+	Distance int `json:"distance"` // cm
+}
+
+type driveAngleRequest struct {
+	Angle int `json:"angle"` // degrees, multiple of 90, positive angles turn right
+}
+
+func (req driveDistanceRequest) validate() error {
+	return validateDistance(req.Distance)
+}
+
+func (req driveAngleRequest) validate() error {
+	return validateAngle(req.Angle)
+}
+
+type saveMapRequest struct {
+	Name string `json:"name"`
+}
+
+func (req saveMapRequest) validate() error {
+	return validateMapName(req.Name)
+}
+
+type mapIDResponse struct {
+	MapID int `json:"mapID"`
+}
+
+type roverStatus struct {
+	MQTTConnected bool    `json:"mqttConnected"`
+	Autonomous    bool    `json:"autonomous"`
+	Rover         rover   `json:"rover"`
+	Energy        energy  `json:"energy"`
+	Mission       mission `json:"mission"`
+}
+
+type liveMap struct {
+	Rows  int   `json:"rows"`
+	Cols  int   `json:"cols"`
+	Tiles []int `json:"layout"`
+	Rover rover `json:"rover"`
+}
+
+type feedResponse struct {
+	Events []feedEvent `json:"events"`
+	LastID int         `json:"lastID"` // ID of the latest event, pass as after to get newer events
+}
+
+const (
+	defaultFeedLimit = 100
+	maxFeedLimit     = maxFeedEvents
+)
+
+func (h *HttpServer) apiV1Routes(ctx context.Context) []apiRoute {
+	return []apiRoute{
+		// Public
+		{method: http.MethodPost, path: "/auth/login", operationID: "login", summary: "Logs in and returns an access and a refresh token",
+			request: loginRequest{}, response: tokenResponse{}, handler: h.login(ctx)},
+		{method: http.MethodPost, path: "/auth/refresh", operationID: "refreshTokens", summary: "Returns new tokens for a refresh token",
+			request: refreshRequest{}, response: tokenResponse{}, handler: h.refreshTokens(ctx)},
+		{method: http.MethodPost, path: "/auth/logout", operationID: "logout", summary: "Revokes the session of a refresh token",
+			request: refreshRequest{}, handler: h.logout(ctx)},
+
+		// Viewer
+		{method: http.MethodGet, path: "/status", operationID: "getStatus", summary: "Returns the connection, rover pose, battery and mission",
+			role: roleViewer, response: roverStatus{}, handler: h.getAPIStatus},
+		{method: http.MethodGet, path: "/map", operationID: "getLiveMap", summary: "Returns the live map and the rover pose",
+			role: roleViewer, response: liveMap{}, handler: h.getLiveMap},
+		{method: http.MethodGet, path: "/feed", operationID: "getFeed", summary: "Returns feed events oldest first",
+			role: roleViewer, response: feedResponse{}, handler: h.getFeedEvents,
+			query: []apiQueryParameter{
+				{"after", "Only events with a greater ID", 0},
+				{"limit", "Maximum number of events (default 100)", 0},
+			}},
+		{method: http.MethodGet, path: "/maps", operationID: "listMaps", summary: "Lists the saved maps without their layout",
+			role: roleViewer, response: []savedMap{}, handler: h.getMaps(ctx)},
+		{method: http.MethodGet, path: "/maps/{id}", operationID: "getMap", summary: "Returns a saved map",
+			role: roleViewer, response: savedMap{}, handler: h.getMap(ctx)},
+		{method: http.MethodGet, path: "/missions", operationID: "listMissions", summary: "Lists all missions",
+			role: roleViewer, response: []mission{}, handler: h.getMissions(ctx)},
+
+		// Operator
+		{method: http.MethodPost, path: "/drive/distance", operationID: "driveDistance", summary: "Drives forward",
+			role: roleOperator, request: driveDistanceRequest{}, handler: h.driveDistance},
+		{method: http.MethodPost, path: "/drive/angle", operationID: "driveAngle", summary: "Turns on the spot",
+			role: roleOperator, request: driveAngleRequest{}, handler: h.driveAngle},
+		{method: http.MethodPost, path: "/drive/target", operationID: "driveToTarget", summary: "Drives to a tile (mode 0: simple, 1: full discovery, 2: destination discovery)",
+			role: roleOperator, request: coordinates{}, handler: h.driveToTarget},
+		{method: http.MethodPost, path: "/autonomy/start", operationID: "startAutonomy", summary: "Starts exploring the map autonomously",
+			role: roleOperator, handler: h.startAutonomy},
+		{method: http.MethodPost, path: "/autonomy/stop", operationID: "stopAutonomy", summary: "Stops autonomous mode after the current drive instructions",
+			role: roleOperator, handler: h.stopAutonomy},
+		{method: http.MethodPost, path: "/map/reset", operationID: "resetMap", summary: "Resets the live map and starts a new mission",
+			role: roleOperator, handler: h.resetMap(ctx)},
+		{method: http.MethodPost, path: "/maps", operationID: "saveMap", summary: "Saves the live map under a new name",
+			role: roleOperator, request: saveMapRequest{}, response: mapIDResponse{}, status: http.StatusCreated, handler: h.saveMap(ctx)},
+		{method: http.MethodPost, path: "/maps/{id}/load", operationID: "loadMap", summary: "Replaces the live map and rover pose with a saved map",
+			role: roleOperator, response: savedMap{}, handler: h.loadSavedMap(ctx)},
+		{method: http.MethodDelete, path: "/maps/{id}", operationID: "deleteMap", summary: "Deletes a saved map",
+			role: roleOperator, handler: h.deleteMap(ctx)},
+	}
+}
+
+// Mounts the routes under apiV1Prefix, each role gets its own group of private routes
+func (h *HttpServer) routesV1(ctx context.Context) {
+	routes := h.apiV1Routes(ctx)
+
+	h.router.Route(apiV1Prefix, func(r chi.Router) {
+		r.Get("/openapi.json", h.getOpenAPISpec)
+
+		for _, required := range []role{"", roleViewer, roleOperator} {
+			required := required
+			r.Group(func(r chi.Router) {
+				if required != "" {
+					h.private(ctx, r, authPasswordOrClientCert, required)
+				} else {
+					r.Use(h.auditTrail(ctx))
+				}
+				if required == roleOperator {
+					r.Use(h.rejectDuringReplay)
+				}
+				for _, route := range routes {
+					if route.role == required {
+						r.Method(route.method, route.path, route.handler)
+					}
+				}
+			})
+		}
+	})
+}
+
+func (h *HttpServer) getAPIStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, http.StatusOK, roverStatus{
+		MQTTConnected: h.mqtt.getIsConnected(),
+		Autonomous:    !stopAutonomous,
+		Rover:         Rover,
+		Energy:        currentEnergy,
+		Mission:       currentMission,
+	})
+}
+
+func (h *HttpServer) getLiveMap(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, http.StatusOK, liveMap{
+		Rows:  Map.Rows,
+		Cols:  Map.Cols,
+		Tiles: Map.Tiles,
+		Rover: Rover,
+	})
+}
+
+func (h *HttpServer) getFeedEvents(w http.ResponseWriter, r *http.Request) {
+	after, err := queryInt(r, "after", 0)
+	if err != nil || after < 0 {
+		h.writeValidationError(w, r, &validationError{"after", "must be a non-negative event id"})
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultFeedLimit)
+	if err != nil || limit < 1 || limit > maxFeedLimit {
+		h.writeValidationError(w, r, &validationError{"limit", "must be between 1 and " + strconv.Itoa(maxFeedLimit)})
+		return
+	}
+
+	events, lastID := getFeedEvents(after, limit)
+	h.writeJSON(w, r, http.StatusOK, feedResponse{
+		Events: events,
+		LastID: lastID,
+	})
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (h *HttpServer) driveDistance(w http.ResponseWriter, r *http.Request) {
+	var req driveDistanceRequest
+	if !h.decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := driveForward(r.Context(), h.mqtt, req.Distance); err != nil {
+		h.writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HttpServer) driveAngle(w http.ResponseWriter, r *http.Request) {
+	var req driveAngleRequest
+	if !h.decodeRequest(w, r, &req) {
+		return
+	}
+
+	turn(r.Context(), h.mqtt, req.Angle)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HttpServer) driveToTarget(w http.ResponseWriter, r *http.Request) {
+	var req coordinates
+	if !h.decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := driveToTarget(r.Context(), h.mqtt, req); err != nil {
+		h.writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HttpServer) startAutonomy(w http.ResponseWriter, r *http.Request) {
+	startAutonomousMode(r.Context(), h.mqtt)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HttpServer) stopAutonomy(w http.ResponseWriter, r *http.Request) {
+	stopAutonomousMode()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HttpServer) saveMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req saveMapRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
+
+		mapID, err := saveLiveMap(ctx, h.db, req.Name)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		h.requestLogger(r).Info("saved map", zap.String("name", req.Name), zap.Int("mapID", mapID))
+
+		h.writeJSON(w, r, http.StatusCreated, mapIDResponse{MapID: mapID})
+	}
+}
+
+func (h *HttpServer) loadSavedMap(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, "invalid map id")
+			return
+		}
+
+		m, err := loadSavedMap(ctx, h.db, mapID)
+		if err != nil {
+			h.writeError(w, r, mapStorageErrorStatus(err), err.Error())
+			return
+		}
+
+		if err := recordMapRevisions(ctx, h.db); err != nil {
+			h.requestLogger(r).Error("server: api_v1: loadSavedMap: failed to record map revisions", zap.Error(err))
+		}
+
+		h.requestLogger(r).Info("loaded map", zap.String("name", m.Name), zap.Int("mapID", mapID))
+
+		h.writeJSON(w, r, http.StatusOK, m)
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// Server with an operator (password "Lab-password-1") and a viewer, drive instructions aren't published
+func newAPITestServer(t *testing.T) *httptest.Server {
+	server, _ := newAPITestServerWithDB(t)
+	return server
+}
+
+func newAPITestServerWithDB(t *testing.T) (*httptest.Server, DB) {
+	ctx := context.Background()
+	db, err := OpenDB(ctx, zap.NewNop(), t.TempDir()+"/serverDB.db")
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, user := range []struct {
+		username string
+		role     role
+	}{{"operator", roleOperator}, {"viewer", roleViewer}} {
+		if err := createUser(ctx, db, user.username, "Lab-password-1", user.role); err != nil {
+			t.Fatalf("failed to create user %v: %v", user.username, err)
+		}
+	}
+
+	h := OpenHttpServer(ctx, zap.NewNop(), chi.NewRouter(), db, &replayMQTT{logger: zap.NewNop()}, DefaultConfig())
+	if err := h.routes(ctx); err != nil {
+		t.Fatalf("failed to set up routes: %v", err)
+	}
+
+	server := httptest.NewServer(h.router)
+	t.Cleanup(server.Close)
+	return server, db
+}
+
+func TestAPIV1Client(t *testing.T) {
+	ctx := context.Background()
+	server := newAPITestServer(t)
+
+	c := client.New(server.URL)
+	tokens, err := c.Login(ctx, client.LoginRequest{Username: "operator", Password: "Lab-password-1"})
+	if err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+	c.SetBearerToken(tokens.AccessToken)
+
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if status.Mission.MissionID == 0 {
+		t.Errorf("Status has no mission: %+v", status)
+	}
+
+	liveMap, err := c.GetLiveMap(ctx)
+	if err != nil {
+		t.Fatalf("failed to get live map: %v", err)
+	}
+	if len(liveMap.Layout) != liveMap.Rows*liveMap.Cols {
+		t.Errorf("Live map layout has %v tiles, expected %v", len(liveMap.Layout), liveMap.Rows*liveMap.Cols)
+	}
+
+	saved, err := c.SaveMap(ctx, client.SaveMapRequest{Name: "lab"})
+	if err != nil {
+		t.Fatalf("failed to save map: %v", err)
+	}
+	maps, err := c.ListMaps(ctx)
+	if err != nil {
+		t.Fatalf("failed to list maps: %v", err)
+	}
+	if len(maps) != 1 || maps[0].MapID != saved.MapID || maps[0].Name != "lab" {
+		t.Errorf("Saved maps not equal to expected maps.\nOutput: %+v\nExpected: map %v named lab", maps, saved.MapID)
+	}
+	loaded, err := c.LoadMap(ctx, saved.MapID)
+	if err != nil {
+		t.Fatalf("failed to load map: %v", err)
+	}
+	if len(loaded.Layout) != liveMap.Rows*liveMap.Cols {
+		t.Errorf("Loaded map layout has %v tiles, expected %v", len(loaded.Layout), liveMap.Rows*liveMap.Cols)
+	}
+
+	if err := c.DriveDistance(ctx, client.DriveDistanceRequest{Distance: 10}); err != nil {
+		t.Errorf("failed to drive: %v", err)
+	}
+
+	feed, err := c.GetFeed(ctx, client.GetFeedParams{})
+	if err != nil {
+		t.Fatalf("failed to get feed: %v", err)
+	}
+	if len(feed.Events) == 0 || feed.LastID != feed.Events[len(feed.Events)-1].ID {
+		t.Errorf("Feed has no events or wrong last ID: %+v", feed)
+	}
+	feed, err = c.GetFeed(ctx, client.GetFeedParams{After: feed.LastID})
+	if err != nil {
+		t.Fatalf("failed to get feed: %v", err)
+	}
+	if len(feed.Events) != 0 {
+		t.Errorf("Feed after the last ID has events: %+v", feed.Events)
+	}
+}
+
+func TestAPIV1Errors(t *testing.T) {
+	ctx := context.Background()
+	server := newAPITestServer(t)
+
+	type test struct {
+		name          string
+		call          func() error
+		expected      int
+		expectedCode  string
+		expectedField string
+	}
+
+	viewer := client.New(server.URL, client.WithBasicAuth("viewer", "Lab-password-1"))
+	operator := client.New(server.URL, client.WithBasicAuth("operator", "Lab-password-1"))
+	tests := []test{
+		{"wrong password", func() error {
+			_, err := client.New(server.URL, client.WithBasicAuth("viewer", "wrong")).GetStatus(ctx)
+			return err
+		}, http.StatusUnauthorized, "unauthorized", ""},
+		{"viewer drives", func() error {
+			return viewer.DriveDistance(ctx, client.DriveDistanceRequest{Distance: 10})
+		}, http.StatusForbidden, "forbidden", ""},
+		{"missing map", func() error {
+			_, err := operator.GetMap(ctx, 42)
+			return err
+		}, http.StatusNotFound, "not_found", ""},
+		{"feed limit", func() error {
+			_, err := operator.GetFeed(ctx, client.GetFeedParams{Limit: 5000})
+			return err
+		}, http.StatusBadRequest, "invalid_value", "limit"},
+		{"invalid angle", func() error {
+			return operator.DriveAngle(ctx, client.DriveAngleRequest{Angle: 45})
+		}, http.StatusBadRequest, "invalid_value", "angle"},
+		{"target outside map", func() error {
+			return operator.DriveToTarget(ctx, client.Coordinates{X: 100, Y: 1})
+		}, http.StatusBadRequest, "invalid_value", "x"},
+		{"empty map name", func() error {
+			_, err := operator.SaveMap(ctx, client.SaveMapRequest{})
+			return err
+		}, http.StatusBadRequest, "invalid_value", "name"},
+	}
+
+	for _, test := range tests {
+		err := test.call()
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != test.expected || apiErr.Code != test.expectedCode || apiErr.Field != test.expectedField {
+			t.Errorf("%v returned %v, expected status %v with code %v and field %q", test.name, err, test.expected, test.expectedCode, test.expectedField)
+			continue
+		}
+		if apiErr.RequestID == "" {
+			t.Errorf("%v returned error without request ID", test.name)
+		}
+	}
+}
+
+func TestAPIV1OpenAPISpec(t *testing.T) {
+	server := newAPITestServer(t)
+
+	resp, err := http.Get(server.URL + apiV1Prefix + "/openapi.json")
+	if err != nil {
+		t.Fatalf("failed to get spec: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET openapi.json returned %v", resp.StatusCode)
+	}
+
+	var doc openAPIDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode spec: %v", err)
+	}
+
+	routes := (&HttpServer{}).apiV1Routes(context.Background())
+	for _, route := range routes {
+		op, ok := doc.Paths[route.path][strings.ToLower(route.method)]
+		if !ok {
+			t.Errorf("Spec is missing %v %v", route.method, route.path)
+			continue
+		}
+		if op.OperationID != route.operationID {
+			t.Errorf("Operation ID of %v %v is %q, expected %q", route.method, route.path, op.OperationID, route.operationID)
+		}
+	}
+	for _, name := range []string{"SavedMap", "RoverStatus", "FeedResponse"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("Spec is missing schema %v", name)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"go.uber.org/zap"
+)
+
+// Logs a security relevant event (e.g. a denied request) together with the user and request that caused it
+func (h *HttpServer) auditEvent(r *http.Request, event string, fields ...zap.Field) {
+	fields = append([]zap.Field{
+		zap.String("event", event),
+		zap.String("username", getUsername(r)),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("remoteAddr", r.RemoteAddr),
+		zap.String("requestID", getRequestID(r.Context())),
+	}, fields...)
+
+	h.requestLogger(r).Named("audit").Warn("audit event", fields...)
+}
+
+/*
+	Audit trail of state-changing API calls (driving, map edits, user management, logins, ...).
+	Every call is recorded in the append-only auditEvents table after it was handled,
+	including calls that failed authentication or were denied.
+	The payload is only recorded for authenticated calls. Passwords and tokens are redacted,
+	payloads that aren't JSON or are too long are recorded by size and hash and long results are truncated.
+*/
+type auditRecord struct {
+	AuditEventID int       `json:"auditEventID"`
+	Timestamp    time.Time `json:"timestamp"`
+	Username     string    `json:"username"`
+	SourceIP     string    `json:"sourceIP"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Payload      string    `json:"payload"`
+	Status       int       `json:"status"`
+	Result       string    `json:"result"`
+}
+
+const (
+	maxAuditPayloadSize = 4 << 10
+	maxAuditResultSize  = 1 << 10
+
+	defaultAuditLimit = 1000
+	maxAuditLimit     = 10000
+)
+
+// Empty fields don't filter, records are returned newest first
+type auditFilter struct {
+	Username string
+	Path     string // prefix
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// Set by the authentication middleware and the login handlers once they know who made a request
+type auditUser struct {
+	username      string
+	authenticated bool
+}
+
+const auditUserContextKey contextKey = "auditUser"
+
+// Records the user of a request in its audit record (no-op if the request is not audited)
+func setAuditUsername(r *http.Request, username string) {
+	if user, ok := r.Context().Value(auditUserContextKey).(*auditUser); ok {
+		user.username = username
+	}
+}
+
+// Like setAuditUsername but also records the payload of the request, only used once the user was authenticated
+func setAuditAuthenticated(r *http.Request, username string) {
+	if user, ok := r.Context().Value(auditUserContextKey).(*auditUser); ok {
+		user.username = username
+		user.authenticated = true
+	}
+}
+
+// Keeps the start of a request body and the size and hash of everything the handler read
+type auditBody struct {
+	io.ReadCloser
+	start limitedBuffer
+	hash  hash.Hash
+	size  int
+}
+
+func newAuditBody(body io.ReadCloser) *auditBody {
+	return &auditBody{
+		ReadCloser: body,
+		start:      limitedBuffer{limit: maxAuditPayloadSize},
+		hash:       sha256.New(),
+	}
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.start.Write(p[:n])
+	b.hash.Write(p[:n])
+	b.size += n
+	return n, err
+}
+
+func (b *auditBody) payload() string {
+	if b.size == 0 {
+		return ""
+	}
+	if !b.start.truncated {
+		if payload, ok := redactAuditPayload(b.start.Bytes()); ok {
+			return payload
+		}
+	}
+	return fmt.Sprintf("[%d bytes, sha256 %x]", b.size, b.hash.Sum(nil))
+}
+
+// Records state-changing requests, must be used before an authentication middleware so that failed authentication is recorded
+func (h *HttpServer) auditTrail(ctx context.Context) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The body is only read by the handler, so nothing is read before the user was authenticated
+			body := newAuditBody(r.Body)
+			r.Body = body
+
+			result := &limitedBuffer{limit: maxAuditResultSize}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(result)
+
+			user := &auditUser{}
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditUserContextKey, user)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			record := auditRecord{
+				Timestamp: time.Now().UTC(),
+				Username:  user.username,
+				SourceIP:  clientIP(r),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    status,
+				Result:    auditResult(status, result),
+			}
+			if user.authenticated {
+				record.Payload = body.payload()
+			}
+			if err := h.db.insertAuditRecord(ctx, record); err != nil {
+				h.requestLogger(r).Error("server: audit: failed to insert audit record", zap.Error(err), zap.String("path", record.Path))
+			}
+		})
+	}
+}
+
+// Keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if free := b.limit - b.Len(); free < len(p) {
+		b.truncated = true
+		if free > 0 {
+			b.Buffer.Write(p[:free])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// Error responses are recorded with their message, successful ones only with their status text
+func auditResult(status int, body *limitedBuffer) string {
+	if status < http.StatusBadRequest {
+		return http.StatusText(status)
+	}
+
+	result := strings.TrimSpace(body.String())
+	if body.truncated {
+		result += " [truncated]"
+	}
+	return result
+}
+
+// Fields whose name contains one of these are redacted
+var auditSecretFields = []string{"password", "token"}
+
+func isAuditSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range auditSecretFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Replaces values of JSON object fields whose name contains "password" or "token", also in nested objects and arrays.
+	Returns false if the payload isn't JSON as it can't tell where a secret would be.
+*/
+func redactAuditPayload(payload []byte) (string, bool) {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return "", false
+	}
+
+	if !redactAuditValue(value) {
+		return string(payload), true
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Returns whether anything was redacted
+func redactAuditValue(value interface{}) bool {
+	redacted := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isAuditSecret(key) {
+				v[key] = "[redacted]"
+				redacted = true
+			} else if redactAuditValue(field) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			if redactAuditValue(element) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// Parses the username, path, from, to (RFC3339) and limit query parameters
+func parseAuditFilter(r *http.Request) (auditFilter, error) {
+	query := r.URL.Query()
+
+	filter := auditFilter{
+		Username: query.Get("username"),
+		Path:     query.Get("path"),
+		To:       time.Now().UTC(),
+		Limit:    defaultAuditLimit,
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return auditFilter{}, fmt.Errorf("server: audit: invalid from %q: must be an RFC3339 timestamp", from)
+		}
+		filter.From = t.UTC()
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return auditFilter{}, fmt.Errorf("server: audit: invalid to %q: must be an RFC3339 timestamp", to)
+		}
+		filter.To = t.UTC()
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return auditFilter{}, fmt.Errorf("server: audit: invalid limit %q: must be between 1 and %v", limit, maxAuditLimit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+func writeAuditCSV(w io.Writer, records []auditRecord) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"auditEventID", "timestamp", "username", "sourceIP", "method", "path", "payload", "status", "result"}); err != nil {
+		return fmt.Errorf("server: audit: failed to write csv header: %w", err)
+	}
+	for _, record := range records {
+		if err := writer.Write([]string{
+			strconv.Itoa(record.AuditEventID),
+			record.Timestamp.UTC().Format(time.RFC3339),
+			record.Username,
+			record.SourceIP,
+			record.Method,
+			record.Path,
+			record.Payload,
+			strconv.Itoa(record.Status),
+			record.Result,
+		}); err != nil {
+			return fmt.Errorf("server: audit: failed to write csv record: %w", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
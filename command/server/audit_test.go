@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+)
+
+func TestRedactAuditPayload(t *testing.T) {
+	type test struct {
+		payload    string
+		expected   string
+		expectedOK bool
+	}
+
+	tests := []test{
+		{`10`, `10`, true},
+		{`{"x":3,"y":4,"mode":1}`, `{"x":3,"y":4,"mode":1}`, true},
+		{`{"username":"alice","password":"Rover-Drive7","role":"viewer"}`, `{"password":"[redacted]","role":"viewer","username":"alice"}`, true},
+		{`{"newPassword":"Rover-Drive7"}`, `{"newPassword":"[redacted]"}`, true},
+		{`{"password":"Rover-Drive7"`, ``, false},
+		{`{"user":{"name":"alice","password":"Rover-Drive7"}}`, `{"user":{"name":"alice","password":"[redacted]"}}`, true},
+		{`[{"password":"Rover-Drive7"},{"x":1}]`, `[{"password":"[redacted]"},{"x":1}]`, true},
+		{`{"refreshToken":"session.secret"}`, `{"refreshToken":"[redacted]"}`, true},
+	}
+
+	for _, test := range tests {
+		output, ok := redactAuditPayload([]byte(test.payload))
+		if output != test.expected || ok != test.expectedOK {
+			t.Errorf("Redacted payload not equal to expected payload.\nOutput payload: %v %v\nExpected payload: %v %v", output, ok, test.expected, test.expectedOK)
+		}
+	}
+}
+
+// Payloads that aren't JSON or are too long to be parsed are recorded by size and hash
+func TestAuditBodyPayload(t *testing.T) {
+	type test struct {
+		body     string
+		expected string
+	}
+
+	long := strings.Repeat("a", maxAuditPayloadSize+1)
+	tests := []test{
+		{``, ``},
+		{`{"x":3,"password":"Rover-Drive7"}`, `{"password":"[redacted]","x":3}`},
+		{`password=Rover-Drive7`, fmt.Sprintf("[21 bytes, sha256 %x]", sha256.Sum256([]byte(`password=Rover-Drive7`)))},
+		{long, fmt.Sprintf("[%d bytes, sha256 %x]", len(long), sha256.Sum256([]byte(long)))},
+	}
+
+	for _, test := range tests {
+		body := newAuditBody(ioutil.NopCloser(strings.NewReader(test.body)))
+		if data, err := ioutil.ReadAll(body); err != nil || string(data) != test.body {
+			t.Fatalf("Reading the audited body returned %q, %v, expected the body", data, err)
+		}
+
+		if output := body.payload(); output != test.expected {
+			t.Errorf("Payload not equal to expected payload.\nOutput payload: %v\nExpected payload: %v", output, test.expected)
+		}
+	}
+}
+
+func TestAuditResult(t *testing.T) {
+	type test struct {
+		status   int
+		body     string
+		expected string
+	}
+
+	tests := []test{
+		{200, `{"mapID":1}`, "OK"},
+		{201, ``, "Created"},
+		{404, "map does not exist\n", "map does not exist"},
+		{400, strings.Repeat("e", maxAuditResultSize+1), strings.Repeat("e", maxAuditResultSize) + " [truncated]"},
+	}
+
+	for _, test := range tests {
+		body := &limitedBuffer{limit: maxAuditResultSize}
+		body.Write([]byte(test.body))
+
+		output := auditResult(test.status, body)
+		if output != test.expected {
+			t.Errorf("Audit result of status %v not equal to expected result.\nOutput result: %v\nExpected result: %v", test.status, output, test.expected)
+		}
+	}
+}
+
+// Logins, logouts and requests that fail authentication are audited
+func TestAuditTrail(t *testing.T) {
+	ctx := context.Background()
+	server, db := newAPITestServerWithDB(t)
+
+	tokens, err := client.New(server.URL).Login(ctx, client.LoginRequest{Username: "operator", Password: "Lab-password-1"})
+	if err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+	if _, err := client.New(server.URL).Login(ctx, client.LoginRequest{Username: "operator", Password: "wrong"}); err == nil {
+		t.Fatalf("login with wrong password returned no error")
+	}
+	var apiErr *client.Error
+	err = client.New(server.URL, client.WithBasicAuth("operator", "wrong")).DriveDistance(ctx, client.DriveDistanceRequest{Distance: 10})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("drive with wrong password returned %v, expected status %v", err, http.StatusUnauthorized)
+	}
+	if err := client.New(server.URL).Logout(ctx, client.RefreshRequest{RefreshToken: tokens.RefreshToken}); err != nil {
+		t.Fatalf("failed to log out: %v", err)
+	}
+
+	records, err := db.getAuditRecords(ctx, auditFilter{To: time.Now().Add(time.Minute), Limit: defaultAuditLimit})
+	if err != nil {
+		t.Fatalf("getAuditRecords returned error: %v", err)
+	}
+
+	type expectedRecord struct {
+		username string
+		path     string
+		status   int
+	}
+	expected := []expectedRecord{
+		{"operator", apiV1Prefix + "/auth/logout", http.StatusOK},
+		{"", apiV1Prefix + "/drive/distance", http.StatusUnauthorized},
+		{"", apiV1Prefix + "/auth/login", http.StatusUnauthorized},
+		{"operator", apiV1Prefix + "/auth/login", http.StatusOK},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Audit trail has %v records, expected %v: %+v", len(records), len(expected), records)
+	}
+	for i, record := range records {
+		if record.Username != expected[i].username || record.Path != expected[i].path || record.Status != expected[i].status {
+			t.Errorf("Audit record not equal to expected record.\nOutput record: %+v\nExpected record: %+v", record, expected[i])
+		}
+		if strings.Contains(record.Payload, "Lab-password-1") || strings.Contains(record.Payload, tokens.RefreshToken) {
+			t.Errorf("Audit record contains a secret: %v", record.Payload)
+		}
+		if record.Status == http.StatusUnauthorized && record.Payload != "" {
+			t.Errorf("Audit record of a request that failed authentication contains a payload: %v", record.Payload)
+		}
+		if record.Status == http.StatusOK && !strings.Contains(record.Payload, "[redacted]") {
+			t.Errorf("Audit record of an authenticated request does not contain the redacted payload: %v", record.Payload)
+		}
+	}
+}
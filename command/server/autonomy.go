@@ -6,7 +6,6 @@ package server
 
 import (
 	"container/list"
-	"fmt"
 )
 
 const tileMapUnknownVal = 1
@@ -106,8 +105,6 @@ func getUndiscoveredRectangles(tileMap tileMap) []rectangle {
 							// Add current rectangle to finished
 							finishedRectangles = append(finishedRectangles, *currentRectangle)
 
-							fmt.Println(currentRectangle)
-
 							// Remove current rectangle from unfinished
 							nextListEntry := currentListEntry.Next()
 							unfinishedRectangles.Remove(currentListEntry)
@@ -0,0 +1,170 @@
+/*
+	Package client is a typed Go client of the versioned API of the command server (/api/v1).
+	The request and response types and one method per operation are generated from the OpenAPI spec
+	into client_gen.go (go generate in command/server), this file only contains the transport.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Value of the X-Requested-With header that the server requires for non-GET requests authenticated with basic auth
+	requestedWith = "spacexpp-client"
+
+	requestIDHeader = "X-Request-ID"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	username   string
+	password   string
+	token      string
+}
+
+type Option func(c *Client)
+
+// Uses the given HTTP client instead of http.DefaultClient (e.g. for TLS client certificates)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// Access token of Login, takes precedence over basic auth
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+/*
+	Returns a client of the server at serverURL (e.g. https://localhost:3000).
+	The /api/v1 prefix is added by the client.
+*/
+func New(serverURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(serverURL, "/") + basePath,
+		httpClient: http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Sets the access token used by later requests (e.g. after RefreshTokens)
+func (c *Client) SetBearerToken(token string) {
+	c.token = token
+}
+
+// Returned for responses with a non-2xx status
+type Error struct {
+	StatusCode int
+	Code       string // e.g. invalid_value, see the error codes of the server
+	Message    string
+	Field      string // request field that failed validation
+	RequestID  string // for finding the request in the server logs
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("client: server returned %v", e.StatusCode)
+	}
+	if e.Code == "" {
+		return fmt.Sprintf("client: server returned %v: %v", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("client: server returned %v (%v): %v", e.StatusCode, e.Code, e.Message)
+}
+
+// Error of a response, the body is used as the message if it isn't an ErrorResponse (e.g. from a proxy)
+func responseError(resp *http.Response) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(requestIDHeader),
+	}
+
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body ErrorResponse
+	if err := json.Unmarshal(data, &body); err != nil || body.Code == "" {
+		e.Message = strings.TrimSpace(string(data))
+		return e
+	}
+
+	e.Code = body.Code
+	e.Message = body.Message
+	e.Field = body.Field
+	if body.RequestID != "" {
+		e.RequestID = body.RequestID
+	}
+	return e
+}
+
+// Sends a request with body encoded as JSON and decodes the JSON response into out (both optional)
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("client: failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return fmt.Errorf("client: failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if method != http.MethodGet {
+		req.Header.Set("X-Requested-With", requestedWith)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("client: %v %v failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("client: failed to decode response of %v %v: %w", method, path, err)
+	}
+	return nil
+}
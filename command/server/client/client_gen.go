@@ -0,0 +1,239 @@
+// Code generated by apigen from the OpenAPI spec of the command server. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Path of the API on the server
+const basePath = "/api/v1"
+
+type Coordinates struct {
+	X    int `json:"x"`
+	Y    int `json:"y"`
+	Mode int `json:"mode"`
+}
+
+type DriveAngleRequest struct {
+	Angle int `json:"angle"`
+}
+
+type DriveDistanceRequest struct {
+	Distance int `json:"distance"`
+}
+
+type Energy struct {
+	StateOfCharge int `json:"stateOfCharge"`
+	StateOfHealth int `json:"stateOfHealth"`
+	ErrorInCells  int `json:"errorInCells"`
+}
+
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+type FeedEvent struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type FeedResponse struct {
+	Events []FeedEvent `json:"events"`
+	LastID int         `json:"lastID"`
+}
+
+type LiveMap struct {
+	Rows   int   `json:"rows"`
+	Cols   int   `json:"cols"`
+	Layout []int `json:"layout"`
+	Rover  Rover `json:"rover"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type MapIDResponse struct {
+	MapID int `json:"mapID"`
+}
+
+type Mission struct {
+	MissionID int       `json:"missionID"`
+	Started   time.Time `json:"started"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type Rover struct {
+	X        int `json:"x"`
+	Y        int `json:"y"`
+	Rotation int `json:"rotation"`
+}
+
+type RoverStatus struct {
+	MqttConnected bool    `json:"mqttConnected"`
+	Autonomous    bool    `json:"autonomous"`
+	Rover         Rover   `json:"rover"`
+	Energy        Energy  `json:"energy"`
+	Mission       Mission `json:"mission"`
+}
+
+type SaveMapRequest struct {
+	Name string `json:"name"`
+}
+
+type SavedMap struct {
+	MapID         int       `json:"mapID"`
+	Name          string    `json:"name"`
+	Rows          int       `json:"rows"`
+	Cols          int       `json:"cols"`
+	RoverIndx     int       `json:"roverIndx"`
+	RoverRotation int       `json:"roverRotation"`
+	MissionID     int       `json:"missionID"`
+	Created       time.Time `json:"created"`
+	Updated       time.Time `json:"updated"`
+	Layout        []int     `json:"layout,omitempty"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+	Role         string `json:"role"`
+}
+
+// Deletes a saved map (DELETE /maps/{id})
+func (c *Client) DeleteMap(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/maps/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+// Turns on the spot (POST /drive/angle)
+func (c *Client) DriveAngle(ctx context.Context, body DriveAngleRequest) error {
+	return c.do(ctx, http.MethodPost, "/drive/angle", nil, body, nil)
+}
+
+// Drives forward (POST /drive/distance)
+func (c *Client) DriveDistance(ctx context.Context, body DriveDistanceRequest) error {
+	return c.do(ctx, http.MethodPost, "/drive/distance", nil, body, nil)
+}
+
+// Drives to a tile (mode 0: simple, 1: full discovery, 2: destination discovery) (POST /drive/target)
+func (c *Client) DriveToTarget(ctx context.Context, body Coordinates) error {
+	return c.do(ctx, http.MethodPost, "/drive/target", nil, body, nil)
+}
+
+// Query parameters of GetFeed
+type GetFeedParams struct {
+	After int // Only events with a greater ID
+	Limit int // Maximum number of events (default 100)
+}
+
+// Returns feed events oldest first (GET /feed)
+func (c *Client) GetFeed(ctx context.Context, params GetFeedParams) (FeedResponse, error) {
+	query := url.Values{}
+	if params.After != 0 {
+		query.Set("after", strconv.Itoa(params.After))
+	}
+	if params.Limit != 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	var out FeedResponse
+	err := c.do(ctx, http.MethodGet, "/feed", query, nil, &out)
+	return out, err
+}
+
+// Returns the live map and the rover pose (GET /map)
+func (c *Client) GetLiveMap(ctx context.Context) (LiveMap, error) {
+	var out LiveMap
+	err := c.do(ctx, http.MethodGet, "/map", nil, nil, &out)
+	return out, err
+}
+
+// Returns a saved map (GET /maps/{id})
+func (c *Client) GetMap(ctx context.Context, id int) (SavedMap, error) {
+	var out SavedMap
+	err := c.do(ctx, http.MethodGet, "/maps/"+strconv.Itoa(id), nil, nil, &out)
+	return out, err
+}
+
+// Returns the connection, rover pose, battery and mission (GET /status)
+func (c *Client) GetStatus(ctx context.Context) (RoverStatus, error) {
+	var out RoverStatus
+	err := c.do(ctx, http.MethodGet, "/status", nil, nil, &out)
+	return out, err
+}
+
+// Lists the saved maps without their layout (GET /maps)
+func (c *Client) ListMaps(ctx context.Context) ([]SavedMap, error) {
+	var out []SavedMap
+	err := c.do(ctx, http.MethodGet, "/maps", nil, nil, &out)
+	return out, err
+}
+
+// Lists all missions (GET /missions)
+func (c *Client) ListMissions(ctx context.Context) ([]Mission, error) {
+	var out []Mission
+	err := c.do(ctx, http.MethodGet, "/missions", nil, nil, &out)
+	return out, err
+}
+
+// Replaces the live map and rover pose with a saved map (POST /maps/{id}/load)
+func (c *Client) LoadMap(ctx context.Context, id int) (SavedMap, error) {
+	var out SavedMap
+	err := c.do(ctx, http.MethodPost, "/maps/"+strconv.Itoa(id)+"/load", nil, nil, &out)
+	return out, err
+}
+
+// Logs in and returns an access and a refresh token (POST /auth/login)
+func (c *Client) Login(ctx context.Context, body LoginRequest) (TokenResponse, error) {
+	var out TokenResponse
+	err := c.do(ctx, http.MethodPost, "/auth/login", nil, body, &out)
+	return out, err
+}
+
+// Revokes the session of a refresh token (POST /auth/logout)
+func (c *Client) Logout(ctx context.Context, body RefreshRequest) error {
+	return c.do(ctx, http.MethodPost, "/auth/logout", nil, body, nil)
+}
+
+// Returns new tokens for a refresh token (POST /auth/refresh)
+func (c *Client) RefreshTokens(ctx context.Context, body RefreshRequest) (TokenResponse, error) {
+	var out TokenResponse
+	err := c.do(ctx, http.MethodPost, "/auth/refresh", nil, body, &out)
+	return out, err
+}
+
+// Resets the live map and starts a new mission (POST /map/reset)
+func (c *Client) ResetMap(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/map/reset", nil, nil, nil)
+}
+
+// Saves the live map under a new name (POST /maps)
+func (c *Client) SaveMap(ctx context.Context, body SaveMapRequest) (MapIDResponse, error) {
+	var out MapIDResponse
+	err := c.do(ctx, http.MethodPost, "/maps", nil, body, &out)
+	return out, err
+}
+
+// Starts exploring the map autonomously (POST /autonomy/start)
+func (c *Client) StartAutonomy(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/autonomy/start", nil, nil, nil)
+}
+
+// Stops autonomous mode after the current drive instructions (POST /autonomy/stop)
+func (c *Client) StopAutonomy(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/autonomy/stop", nil, nil, nil)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"gopkg.in/yaml.v2"
+)
+
+/*
+	Optional mutual TLS for lab machines.
+	The HTTP server asks clients for a certificate and verifies it against the configured client CA.
+	Verified certificates are mapped to a user and role by their subject, using a YAML users file:
+		- subject: "CN=lab-pc-1,OU=Lab,O=SpaceXpp"
+		  username: lab-pc-1
+		  role: operator
+	Subjects are written like pkix.Name.String() (RFC 2253). Certificates of other subjects don't authenticate anyone.
+	Certificate users are independent of the users in the credentials table.
+	Modes:
+		- off: clients are not asked for a certificate
+		- optional: clients may present a certificate, routes that don't accept certificates still need a password
+		- required: the TLS handshake fails without a valid certificate
+*/
+const (
+	ClientCertOff      = "off"
+	ClientCertOptional = "optional"
+	ClientCertRequired = "required"
+)
+
+type clientCertUser struct {
+	Subject  string `yaml:"subject"`
+	Username string `yaml:"username"`
+	Role     role   `yaml:"role"`
+}
+
+type clientCertAuth struct {
+	required  bool
+	clientCAs *x509.CertPool
+	users     map[string]clientCertUser // by subject
+}
+
+// Enables client certificate authentication, does nothing in mode off
+func (h *HttpServer) SetClientCertAuth(mode string, caFileName string, usersFileName string) error {
+	switch mode {
+	case ClientCertOff:
+		h.clientCerts = nil
+		return nil
+	case ClientCertOptional, ClientCertRequired:
+	default:
+		return fmt.Errorf("server: client_certs: unknown client certificate mode %q (off, optional or required)", mode)
+	}
+
+	ca, err := ioutil.ReadFile(caFileName)
+	if err != nil {
+		return fmt.Errorf("server: client_certs: failed to read client CA certificate: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("server: client_certs: no certificates found in %v", caFileName)
+	}
+
+	data, err := ioutil.ReadFile(usersFileName)
+	if err != nil {
+		return fmt.Errorf("server: client_certs: failed to read client certificate users: %w", err)
+	}
+	users, err := parseClientCertUsers(data)
+	if err != nil {
+		return fmt.Errorf("server: client_certs: invalid client certificate users in %v: %w", usersFileName, err)
+	}
+
+	h.clientCerts = &clientCertAuth{
+		required:  mode == ClientCertRequired,
+		clientCAs: clientCAs,
+		users:     users,
+	}
+	return nil
+}
+
+func parseClientCertUsers(data []byte) (map[string]clientCertUser, error) {
+	var list []clientCertUser
+	if err := yaml.UnmarshalStrict(data, &list); err != nil {
+		return nil, fmt.Errorf("server: client_certs: failed to parse users: %w", err)
+	}
+
+	users := make(map[string]clientCertUser)
+	for _, user := range list {
+		if user.Subject == "" || user.Username == "" {
+			return nil, errors.New("server: client_certs: every user needs a subject and a username")
+		}
+		if _, err := parseRole(string(user.Role)); err != nil {
+			return nil, fmt.Errorf("server: client_certs: invalid role of %v: %w", user.Subject, err)
+		}
+		if _, ok := users[user.Subject]; ok {
+			return nil, fmt.Errorf("server: client_certs: duplicate subject %v", user.Subject)
+		}
+		users[user.Subject] = user
+	}
+	return users, nil
+}
+
+// TLS config of the HTTP server, nil if client certificates are not used
+func (c *clientCertAuth) tlsConfig() *tls.Config {
+	if c == nil {
+		return nil
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if c.required {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &tls.Config{
+		ClientAuth: clientAuth,
+		ClientCAs:  c.clientCAs,
+	}
+}
+
+// Returns the user of the verified client certificate of the request
+func (c *clientCertAuth) user(r *http.Request) (clientCertUser, bool) {
+	if c == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return clientCertUser{}, false
+	}
+
+	user, ok := c.users[r.TLS.VerifiedChains[0][0].Subject.String()]
+	return user, ok
+}
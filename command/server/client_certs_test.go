@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestParseClientCertUsers(t *testing.T) {
+	type test struct {
+		data        string
+		expected    map[string]clientCertUser
+		expectError bool
+	}
+
+	tests := []test{
+		{
+			"- subject: \"CN=lab-pc-1,O=SpaceXpp\"\n  username: lab-pc-1\n  role: operator\n",
+			map[string]clientCertUser{"CN=lab-pc-1,O=SpaceXpp": {"CN=lab-pc-1,O=SpaceXpp", "lab-pc-1", roleOperator}},
+			false,
+		},
+		{"", map[string]clientCertUser{}, false},
+		{"- subject: \"CN=lab-pc-1\"\n  username: lab-pc-1\n  role: pilot\n", nil, true},
+		{"- subject: \"CN=lab-pc-1\"\n  role: viewer\n", nil, true},
+		{"- subject: \"CN=lab-pc-1\"\n  username: lab-pc-1\n  role: viewer\n  password: secret\n", nil, true},
+		{"- subject: \"CN=a\"\n  username: a\n  role: viewer\n- subject: \"CN=a\"\n  username: b\n  role: viewer\n", nil, true},
+	}
+
+	for _, test := range tests {
+		output, err := parseClientCertUsers([]byte(test.data))
+		if (err != nil) != test.expectError {
+			t.Errorf("parseClientCertUsers(%q) returned error %v, expected error: %v", test.data, err, test.expectError)
+			continue
+		}
+		if test.expectError {
+			continue
+		}
+
+		if len(output) != len(test.expected) {
+			t.Errorf("Users of %q not equal to expected users.\nOutput users: %v\nExpected users: %v", test.data, output, test.expected)
+			continue
+		}
+		for subject, user := range test.expected {
+			if output[subject] != user {
+				t.Errorf("User of subject %v not equal to expected user.\nOutput user: %v\nExpected user: %v", subject, output[subject], user)
+			}
+		}
+	}
+}
+
+func TestClientCertAuthPolicy(t *testing.T) {
+	type test struct {
+		subject  string
+		policy   authPolicy
+		expected int
+	}
+
+	tests := []test{
+		{"CN=lab-pc-1,O=SpaceXpp", authPasswordOrClientCert, http.StatusOK},
+		{"CN=lab-pc-1,O=SpaceXpp", authPassword, http.StatusUnauthorized},
+		{"CN=lab-pc-2,O=SpaceXpp", authPasswordOrClientCert, http.StatusUnauthorized},
+		{"", authPasswordOrClientCert, http.StatusUnauthorized},
+	}
+
+	h := &HttpServer{
+		logger: zap.NewNop(),
+		clientCerts: &clientCertAuth{
+			users: map[string]clientCertUser{
+				"CN=lab-pc-1,O=SpaceXpp": {"CN=lab-pc-1,O=SpaceXpp", "lab-pc-1", roleOperator},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var username string
+		var userRole role
+		handler := h.auth("test", test.policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username = getUsername(r)
+			userRole = getRole(r)
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/map/getMap", nil)
+		if test.subject != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: "lab-pc-1", Organization: []string{"SpaceXpp"}}}
+			if test.subject != cert.Subject.String() {
+				cert.Subject.CommonName = "lab-pc-2"
+			}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expected {
+			t.Errorf("Status of request with certificate %q and policy %v not equal to expected status.\nOutput status: %v\nExpected status: %v", test.subject, test.policy, w.Code, test.expected)
+			continue
+		}
+		if w.Code == http.StatusOK && (username != "lab-pc-1" || userRole != roleOperator) {
+			t.Errorf("Certificate user not equal to expected user.\nOutput user: %v (%v)\nExpected user: lab-pc-1 (operator)", username, userRole)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+// Parts of the OpenAPI spec that the client is generated from
+type spec struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"responses"`
+
+	method string
+	path   string
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *schema            `json:"items"`
+}
+
+const (
+	schemaRefPrefix = "#/components/schemas/"
+	jsonMediaType   = "application/json"
+)
+
+// Keeps track of the imports that the generated code needs
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+	err     error
+}
+
+// Returns the formatted Go source of the client types and methods
+func generate(data []byte, packageName string) ([]byte, error) {
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("apigen: failed to parse spec: %w", err)
+	}
+	if len(s.Servers) == 0 {
+		return nil, errors.New("apigen: spec has no server url")
+	}
+
+	g := &generator{imports: map[string]bool{"context": true, "net/http": true}}
+
+	// Types
+	for _, name := range sortedSchemaNames(s.Components.Schemas) {
+		g.writeType(name, s.Components.Schemas[name])
+	}
+
+	// Methods
+	for _, op := range sortedOperations(s.Paths) {
+		g.writeOperation(op)
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by apigen from the OpenAPI spec of the command server. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %v\n\n", packageName)
+	out.WriteString("import (\n")
+	for _, path := range sortedKeys(g.imports) {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n\n")
+	fmt.Fprintf(&out, "// Path of the API on the server\nconst basePath = %q\n\n", s.Servers[0].URL)
+	out.Write(g.buf.Bytes())
+
+	code, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("apigen: failed to format generated code: %w", err)
+	}
+	return code, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) fail(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = fmt.Errorf("apigen: "+format, args...)
+	}
+}
+
+func (g *generator) writeType(name string, s *schema) {
+	if s.Type != "object" {
+		g.fail("schema %v is not an object", name)
+		return
+	}
+
+	g.printf("type %v struct {\n", name)
+	for _, property := range propertyOrder(s) {
+		tag := property
+		if !contains(s.Required, property) {
+			tag += ",omitempty"
+		}
+		g.printf("%v %v `json:\"%v\"`\n", fieldName(property), g.goType(s.Properties[property]), tag)
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) goType(s *schema) string {
+	if s == nil {
+		g.fail("missing schema")
+		return ""
+	}
+	if s.Ref != "" {
+		if !strings.HasPrefix(s.Ref, schemaRefPrefix) {
+			g.fail("unsupported reference %v", s.Ref)
+		}
+		return strings.TrimPrefix(s.Ref, schemaRefPrefix)
+	}
+
+	switch s.Type {
+	case "integer":
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "string":
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			return "time.Time"
+		}
+		return "string"
+	case "array":
+		return "[]" + g.goType(s.Items)
+	}
+	g.fail("unsupported schema type %q", s.Type)
+	return ""
+}
+
+func (g *generator) writeOperation(op operation) {
+	name := exported(op.OperationID)
+
+	// Parameters
+	args := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", op.path)
+	var queryParams []parameter
+	for _, param := range op.Parameters {
+		switch param.In {
+		case "path":
+			arg := param.Name
+			args = append(args, arg+" "+g.goType(param.Schema))
+			pathExpr = strings.Replace(pathExpr, "{"+param.Name+"}", `"+`+g.formatValue(arg, param.Schema)+`+"`, 1)
+		case "query":
+			queryParams = append(queryParams, param)
+		default:
+			g.fail("unsupported parameter location %v of %v", param.In, op.OperationID)
+		}
+	}
+	pathExpr = strings.Replace(pathExpr, `+""`, "", -1)
+
+	if len(queryParams) > 0 {
+		g.printf("// Query parameters of %v\n", name)
+		g.printf("type %vParams struct {\n", name)
+		for _, param := range queryParams {
+			g.printf("%v %v // %v\n", fieldName(param.Name), g.goType(param.Schema), param.Description)
+		}
+		g.printf("}\n\n")
+		args = append(args, "params "+name+"Params")
+	}
+
+	requestType := ""
+	if op.RequestBody != nil {
+		requestType = g.goType(op.RequestBody.Content[jsonMediaType].Schema)
+		args = append(args, "body "+requestType)
+	}
+
+	responseType := ""
+	if response := successResponse(op); response != nil {
+		responseType = g.goType(response)
+	}
+
+	// Signature
+	g.printf("// %v (%v %v)\n", op.Summary, op.method, op.path)
+	if responseType == "" {
+		g.printf("func (c *Client) %v(%v) error {\n", name, strings.Join(args, ", "))
+	} else {
+		g.printf("func (c *Client) %v(%v) (%v, error) {\n", name, strings.Join(args, ", "), responseType)
+	}
+
+	// Body
+	queryArg := "nil"
+	if len(queryParams) > 0 {
+		g.imports["net/url"] = true
+		queryArg = "query"
+		g.printf("query := url.Values{}\n")
+		for _, param := range queryParams {
+			field := "params." + fieldName(param.Name)
+			g.printf("if %v != %v {\n", field, zeroValue(param.Schema))
+			g.printf("query.Set(%q, %v)\n", param.Name, g.formatValue(field, param.Schema))
+			g.printf("}\n")
+		}
+	}
+	bodyArg := "nil"
+	if requestType != "" {
+		bodyArg = "body"
+	}
+
+	method := "http.Method" + exported(strings.ToLower(op.method))
+	if responseType == "" {
+		g.printf("return c.do(ctx, %v, %v, %v, %v, nil)\n", method, pathExpr, queryArg, bodyArg)
+	} else {
+		g.printf("var out %v\n", responseType)
+		g.printf("err := c.do(ctx, %v, %v, %v, %v, &out)\n", method, pathExpr, queryArg, bodyArg)
+		g.printf("return out, err\n")
+	}
+	g.printf("}\n\n")
+}
+
+// Go expression that formats a parameter value as a string
+func (g *generator) formatValue(expr string, s *schema) string {
+	switch s.Type {
+	case "integer":
+		g.imports["strconv"] = true
+		return "strconv.Itoa(" + expr + ")"
+	case "boolean":
+		g.imports["strconv"] = true
+		return "strconv.FormatBool(" + expr + ")"
+	case "string":
+		g.imports["net/url"] = true
+		return "url.PathEscape(" + expr + ")"
+	}
+	g.fail("unsupported parameter type %q", s.Type)
+	return expr
+}
+
+func zeroValue(s *schema) string {
+	switch s.Type {
+	case "integer":
+		return "0"
+	case "boolean":
+		return "false"
+	}
+	return `""`
+}
+
+// Schema of the JSON body of the first successful response, nil if it has no body
+func successResponse(op operation) *schema {
+	var statuses []string
+	for status := range op.Responses {
+		if strings.HasPrefix(status, "2") {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+	if len(statuses) == 0 {
+		return nil
+	}
+	return op.Responses[statuses[0]].Content[jsonMediaType].Schema
+}
+
+func sortedOperations(paths map[string]map[string]operation) []operation {
+	var ops []operation
+	for path, methods := range paths {
+		for method, op := range methods {
+			op.method = strings.ToUpper(method)
+			op.path = path
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].OperationID < ops[j].OperationID
+	})
+	return ops
+}
+
+func sortedSchemaNames(schemas map[string]*schema) []string {
+	var names []string
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Required properties in the order of the spec, then optional properties sorted by name
+func propertyOrder(s *schema) []string {
+	order := append([]string{}, s.Required...)
+	var optional []string
+	for property := range s.Properties {
+		if !contains(s.Required, property) {
+			optional = append(optional, property)
+		}
+	}
+	sort.Strings(optional)
+	return append(order, optional...)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Go field name of a JSON property (e.g. mapID -> MapID, id -> ID)
+func fieldName(property string) string {
+	if property == "id" {
+		return "ID"
+	}
+	return exported(property)
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
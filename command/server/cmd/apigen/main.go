@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+
+	"github.com/IBricchi/SpaceXpp/command/server"
+)
+
+/*
+	Generates the typed Go client of the versioned API from its OpenAPI spec (run through go generate in command/server):
+		apigen -o client/client_gen.go
+	The spec is taken from the server package unless a spec file (e.g. downloaded from GET /api/v1/openapi.json) is given:
+		apigen -spec openapi.json -o client/client_gen.go
+*/
+func main() {
+	var specFileName = flag.String("spec", "", "OpenAPI spec file (defaults to the spec of the server package)")
+	var outFileName = flag.String("o", "client/client_gen.go", "Output file")
+	var packageName = flag.String("package", "client", "Package name of the generated code")
+	flag.Parse()
+
+	var spec []byte
+	var err error
+	if *specFileName == "" {
+		spec, err = server.OpenAPISpec()
+	} else {
+		spec, err = ioutil.ReadFile(*specFileName)
+	}
+	if err != nil {
+		log.Fatalf("apigen: failed to get spec: %v\n", err)
+	}
+
+	code, err := generate(spec, *packageName)
+	if err != nil {
+		log.Fatalf("apigen: failed to generate client: %v\n", err)
+	}
+
+	if err := ioutil.WriteFile(*outFileName, code, 0644); err != nil {
+		log.Fatalf("apigen: failed to write client: %v\n", err)
+	}
+}
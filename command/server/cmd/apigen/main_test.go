@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/IBricchi/SpaceXpp/command/server"
+)
+
+func TestGeneratedClientUpToDate(t *testing.T) {
+	spec, err := server.OpenAPISpec()
+	if err != nil {
+		t.Fatalf("failed to get spec: %v", err)
+	}
+
+	code, err := generate(spec, "client")
+	if err != nil {
+		t.Fatalf("failed to generate client: %v", err)
+	}
+
+	committed, err := ioutil.ReadFile("../../client/client_gen.go")
+	if err != nil {
+		t.Fatalf("failed to read generated client: %v", err)
+	}
+	if !bytes.Equal(code, committed) {
+		t.Errorf("client/client_gen.go is out of date, run go generate in command/server")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	type test struct {
+		name string
+		spec string
+	}
+
+	tests := []test{
+		{"invalid JSON", `{`},
+		{"no server", `{"servers": []}`},
+		{"unsupported type", `{"servers": [{"url": "/api/v1"}], "components": {"schemas": {"A": {"type": "object", "properties": {"a": {"type": "null"}}}}}}`},
+		{"cookie parameter", `{"servers": [{"url": "/api/v1"}], "paths": {"/a": {"get": {"operationId": "a", "parameters": [{"name": "a", "in": "cookie", "schema": {"type": "string"}}]}}}}`},
+	}
+
+	for _, test := range tests {
+		if _, err := generate([]byte(test.spec), "client"); err == nil {
+			t.Errorf("generate of spec with %v returned no error", test.name)
+		}
+	}
+}
@@ -5,37 +5,221 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/IBricchi/SpaceXpp/command/server"
 	"go.uber.org/zap"
+	"golang.org/x/term"
+)
+
+/*
+	Interactively add users:
+		credentials
+	Manage users:
+		credentials list
+		credentials add -username alice -role operator [-password-stdin]
+		credentials passwd -username alice [-password-stdin]
+		credentials disable -username alice
+		credentials enable -username alice
+		credentials remove -username alice
+	Without -password-stdin the password is asked for twice (without echo on a terminal). With -password-stdin the first line of stdin is used, e.g.
+		echo "$PASSWORD" | credentials -passwordHash argon2id add -username alice -role viewer -password-stdin
+
+	Exit codes:
+		0 success
+		1 failure (e.g. db not reachable)
+		2 invalid command or flags
+		3 invalid username, password or role (see server.PasswordPolicy)
+		4 user does not exist
+		5 username already taken
+*/
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitInvalidUser  = 3
+	exitUserNotFound = 4
+	exitUserExists   = 5
 )
 
 func main() {
-	var serverDBFilePath = flag.String("db", "serverDB.db", "SQLite DB file name")
+	os.Exit(run())
+}
+
+// Runs the command and returns its exit code so that deferred cleanup runs before exiting
+func run() int {
+	var serverDBFilePath = flag.String("db", "serverDB.db", "SQLite DB file name or postgres:// DSN")
+	var passwordHash = flag.String("passwordHash", server.PasswordHashBcrypt, "Hash algorithm for new passwords (bcrypt or argon2id)")
+	var bcryptCost = flag.Int("bcryptCost", server.DefaultBcryptCost, "bcrypt cost for new passwords")
 	flag.Parse()
 
-	dbDSN := "db/" + *serverDBFilePath
+	dbDSN := *serverDBFilePath
+	if !server.IsPostgresDSN(dbDSN) {
+		dbDSN = "db/" + dbDSN
+	}
 
 	ctx := context.Background()
 
 	logger, err := zap.NewDevelopment()
 	if err != nil {
-		log.Fatalf("credentials: failed to create zap logger: %v\n", err)
+		log.Printf("credentials: failed to create zap logger: %v\n", err)
+		return exitFailure
 	}
 	defer logger.Sync()
 
-	db, err := server.OpenSQLiteDB(ctx, logger, dbDSN)
+	if err := server.SetPasswordHashing(*passwordHash, *bcryptCost); err != nil {
+		logger.Error("credentials: invalid password hashing options", zap.Error(err))
+		return exitUsage
+	}
+
+	command := flag.NewFlagSet(flag.Arg(0), flag.ContinueOnError)
+	var username = command.String("username", "", "Username")
+	var userRole = command.String("role", "viewer", "Role of the new user (viewer, operator or admin)")
+	var passwordStdin = command.Bool("password-stdin", false, "Read the password from the first line of stdin instead of asking for it")
+	if flag.NArg() > 0 {
+		if err := command.Parse(flag.Args()[1:]); err != nil {
+			return exitUsage
+		}
+	}
+
+	// The username can also be given as argument, e.g. "credentials remove alice"
+	if *username == "" {
+		*username = command.Arg(0)
+	}
+
+	switch flag.Arg(0) {
+	case "", "list":
+	case "add", "passwd", "disable", "enable", "remove":
+		if *username == "" {
+			logger.Error("credentials: -username required", zap.String("command", flag.Arg(0)))
+			return exitUsage
+		}
+	default:
+		logger.Error("credentials: unknown command (list, add, passwd, disable, enable or remove)", zap.String("command", flag.Arg(0)))
+		return exitUsage
+	}
+
+	var password string
+	if flag.Arg(0) == "add" || flag.Arg(0) == "passwd" {
+		password, err = readPassword(*passwordStdin)
+		if err != nil {
+			logger.Error("credentials: failed to read password", zap.Error(err))
+			return exitInvalidUser
+		}
+	}
+
+	db, err := server.OpenDB(ctx, logger, dbDSN)
 	if err != nil {
-		logger.Fatal("credentials: failed to open SQLite server database", zap.Error(err))
+		return exitCode(logger, "credentials: failed to open server database", err)
 	}
 	defer db.Close()
-	logger.Info("credentials: opened sqlite3 DB")
 
-	if err := server.AddCredential(ctx, db); err != nil {
-		logger.Fatal("credentials: failed to add credentials", zap.Error(err))
+	switch flag.Arg(0) {
+	case "":
+		if err := server.AddCredential(ctx, db); err != nil {
+			return exitCode(logger, "credentials: failed to add credentials", err)
+		}
+		logger.Info("credentials: finished adding credentials")
+	case "list":
+		if err := server.ListUsers(ctx, db, os.Stdout); err != nil {
+			return exitCode(logger, "credentials: failed to list users", err)
+		}
+	case "add":
+		if err := server.AddUser(ctx, db, *username, *userRole, password); err != nil {
+			return exitCode(logger, "credentials: failed to add user", err)
+		}
+		logger.Info("credentials: user added", zap.String("username", *username), zap.String("role", *userRole))
+	case "passwd":
+		if err := server.ResetPassword(ctx, db, *username, password); err != nil {
+			return exitCode(logger, "credentials: failed to change password", err)
+		}
+		logger.Info("credentials: password changed", zap.String("username", *username))
+	case "disable":
+		if err := server.DisableUser(ctx, db, *username); err != nil {
+			return exitCode(logger, "credentials: failed to disable user", err)
+		}
+		logger.Info("credentials: user disabled", zap.String("username", *username))
+	case "enable":
+		if err := server.EnableUser(ctx, db, *username); err != nil {
+			return exitCode(logger, "credentials: failed to enable user", err)
+		}
+		logger.Info("credentials: user enabled", zap.String("username", *username))
+	case "remove":
+		if err := server.DeleteUser(ctx, db, *username); err != nil {
+			return exitCode(logger, "credentials: failed to remove user", err)
+		}
+		logger.Info("credentials: user removed", zap.String("username", *username))
+	}
+
+	return 0
+}
+
+// Logs the error and returns the exit code of the error
+func exitCode(logger *zap.Logger, msg string, err error) int {
+	logger.Error(msg, zap.Error(err))
+
+	switch {
+	case server.IsInvalidUser(err):
+		return exitInvalidUser
+	case server.IsUserNotFound(err):
+		return exitUserNotFound
+	case server.IsUsernameTaken(err):
+		return exitUserExists
+	}
+	return exitFailure
+}
+
+/*
+	Reads a password from the first line of stdin or asks for it twice.
+	When stdin is a terminal the password is not echoed.
+*/
+func readPassword(fromStdin bool) (string, error) {
+	stdin := bufio.NewReader(os.Stdin)
+
+	readLine := func() (string, error) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && !(err == io.EOF && line != "") {
+			return "", fmt.Errorf("no password given: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if fromStdin {
+		return readLine()
+	}
+
+	stdinFd := int(os.Stdin.Fd())
+	if term.IsTerminal(stdinFd) {
+		readLine = func() (string, error) {
+			password, err := term.ReadPassword(stdinFd)
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return "", fmt.Errorf("no password given: %w", err)
+			}
+			return string(password), nil
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, server.PasswordPolicy)
+	fmt.Fprint(os.Stderr, "Enter password: ")
+	password, err := readLine()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeated, err := readLine()
+	if err != nil {
+		return "", err
 	}
-	logger.Info("credentials: finished adding credentials")
+	if password != repeated {
+		return "", fmt.Errorf("passwords do not match")
+	}
+
+	return password, nil
 }
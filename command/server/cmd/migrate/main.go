@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/IBricchi/SpaceXpp/command/server"
+	"go.uber.org/zap"
+)
+
+/*
+	Show applied and pending migrations:
+		migrate status
+	Apply all pending migrations (or up to a version):
+		migrate up [-to 5]
+	Roll back the latest migration (or down to a version):
+		migrate down [-to 3]
+*/
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("migrate: %v\n", err)
+	}
+}
+
+// Returns the error instead of exiting so that the db is closed before exiting
+func run() error {
+	var serverDBFilePath = flag.String("db", "serverDB.db", "SQLite DB file name or postgres:// DSN")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		return errors.New("command required (status, up or down)")
+	}
+
+	dbDSN := *serverDBFilePath
+	if !server.IsPostgresDSN(dbDSN) {
+		dbDSN = "db/" + dbDSN
+	}
+
+	ctx := context.Background()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return fmt.Errorf("failed to create zap logger: %w", err)
+	}
+	defer logger.Sync()
+
+	db, err := server.OpenDBWithoutMigration(ctx, logger, dbDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open server database: %w", err)
+	}
+	defer db.Close()
+
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	command := flag.NewFlagSet(flag.Arg(0), flag.ContinueOnError)
+	var target = command.Int("to", -1, "Target schema version")
+	if err := command.Parse(flag.Args()[1:]); err != nil {
+		return err
+	}
+
+	switch flag.Arg(0) {
+	case "status":
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get migration status: %w", err)
+		}
+
+		fmt.Printf("Schema version %d (latest %d)\n", current, server.LatestSchemaVersion())
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  %3d  %-50s %s\n", s.Version, s.Description, applied)
+		}
+	case "up":
+		if *target < 0 {
+			*target = server.LatestSchemaVersion()
+		}
+		if err := db.MigrateUp(ctx, *target); err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		logger.Info("migrate: db migrated", zap.Int("from", current), zap.Int("to", *target))
+	case "down":
+		if *target < 0 {
+			*target = current - 1
+		}
+		if err := db.MigrateDown(ctx, *target); err != nil {
+			return fmt.Errorf("failed to roll back migrations: %w", err)
+		}
+		logger.Info("migrate: db rolled back", zap.Int("from", current), zap.Int("to", *target))
+	default:
+		return fmt.Errorf("unknown command %q (status, up or down)", flag.Arg(0))
+	}
+
+	return nil
+}
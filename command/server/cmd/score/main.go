@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/IBricchi/SpaceXpp/command/server"
+	"go.uber.org/zap"
+)
+
+/*
+	Register a ground truth:
+		score -register arena1 -file arena1.csv
+	Compare a saved map against a ground truth:
+		score -map run3 -truth arena1
+*/
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("score: %v\n", err)
+	}
+}
+
+// Returns the error instead of exiting so that the db is closed before exiting
+func run() error {
+	var serverDBFilePath = flag.String("db", "serverDB.db", "SQLite DB file name or postgres:// DSN")
+	var register = flag.String("register", "", "Name of ground truth to register")
+	var file = flag.String("file", "", "Ground truth map file (json, csv, png or ros zip)")
+	var format = flag.String("format", "", "Ground truth map format (defaults to the file extension)")
+	var mapName = flag.String("map", "", "Name of saved map to score")
+	var truth = flag.String("truth", "", "Name of ground truth to score against")
+	flag.Parse()
+
+	if *register == "" && (*mapName == "" || *truth == "") {
+		return errors.New("-map and -truth are required when not registering a ground truth")
+	}
+
+	dbDSN := *serverDBFilePath
+	if !server.IsPostgresDSN(dbDSN) {
+		dbDSN = "db/" + dbDSN
+	}
+
+	ctx := context.Background()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return fmt.Errorf("failed to create zap logger: %w", err)
+	}
+	defer logger.Sync()
+
+	db, err := server.OpenDB(ctx, logger, dbDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open server database: %w", err)
+	}
+	defer db.Close()
+
+	if *register != "" {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("failed to read ground truth file: %w", err)
+		}
+
+		if *format == "" {
+			*format = strings.TrimPrefix(filepath.Ext(*file), ".")
+			if *format == "zip" {
+				*format = "ros"
+			}
+		}
+
+		if err := server.RegisterGroundTruth(ctx, db, *register, *format, data); err != nil {
+			return fmt.Errorf("failed to register ground truth: %w", err)
+		}
+		logger.Info("score: registered ground truth", zap.String("name", *register))
+		return nil
+	}
+
+	report, err := server.CompareMapToGroundTruth(ctx, db, *mapName, *truth)
+	if err != nil {
+		return fmt.Errorf("failed to compare map to ground truth: %w", err)
+	}
+	fmt.Print(report)
+	return nil
+}
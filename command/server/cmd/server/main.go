@@ -7,8 +7,11 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/IBricchi/SpaceXpp/command/server"
 	"github.com/go-chi/chi"
@@ -17,42 +20,50 @@ import (
 
 func main() {
 
-	fmt.Println("Loading Server")
-
-	var httpPort = flag.String("httpPort", "3000", "Port for serving http server")
-	var httpServerTLSCertFileName = flag.String("httpServerTLSCertFileName", "cert/server.crt", "File path of TLS HTTP server certificate")
-	var httpServerTLSKeyFileName = flag.String("httpServerTLSKeyFileName", "cert/server.key", "File path of TLS HTTP server key")
-	var serverDBFilePath = flag.String("db", "serverDB.db", "SQLite DB file path")
-	var mqttBrokerURL = flag.String("mqttBrokerURL", "ssl://18.130.239.157:8883", "URL of MQTT Broker")
-	var mqttUsername = flag.String("mqttUsername", "", "MQTT Username")
-	var mqttPassword = flag.String("mqttPassword", "", "MQTT Password")
+	var configFileName = flag.String("config", os.Getenv("SPACEXPP_CONFIG"), "YAML config file (see config.example.yaml), settings can be overridden by SPACEXPP_* environment variables and flags")
+	configFlags := server.NewConfigFlags(flag.CommandLine)
 	flag.Parse()
 
-	serverDBDSN := "db/" + *serverDBFilePath
-
-	// Context
-
-	ctx := context.Background()
+	// The logger is configured by the config, so config errors can't be logged with it
+	config, err := configFlags.Load(*configFileName)
+	if err != nil {
+		log.Fatalf("server: failed to load config: %v\n", err)
+	}
 
 	// Logging
 
-	logger, err := zap.NewDevelopment()
+	logger, err := server.NewLogger(config.Log)
 	if err != nil {
 		log.Fatalf("server: failed to create zap logger: %v\n", err)
 	}
 	defer logger.Sync()
 
-	// SQL lite database
+	logger.Info("server: loading server", zap.String("config", *configFileName))
 
-	serverDB, err := server.OpenSQLiteDB(ctx, logger, serverDBDSN)
+	// Context, cancelled once the server has shut down
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// SIGINT and SIGTERM start a graceful shutdown, a second signal kills the server
+	signalCtx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	if err := server.SetPasswordHashing(config.Passwords.Hash, config.Passwords.BcryptCost); err != nil {
+		logger.Fatal("server: invalid password hashing options", zap.Error(err))
+	}
+
+	// Database (SQLite or PostgreSQL)
+
+	serverDB, err := server.OpenDB(ctx, logger, config.DB.DSN)
 	if err != nil {
-		logger.Fatal("server: failed to open SQLite server database", zap.Error(err))
+		logger.Fatal("server: failed to open server database", zap.Error(err))
 	}
-	logger.Info("server: opened server sqlite3 DB")
+	logger.Info("server: opened server DB")
 
 	// Mosquito
 
-	mqttClient, err := server.InitMQTT(ctx, logger, serverDB, *mqttBrokerURL, *mqttUsername, *mqttPassword)
+	mqttClient, err := server.InitMQTT(ctx, logger, serverDB, config.MQTT)
 	if err != nil {
 		logger.Fatal("server: failed to init MQTT client", zap.Error(err))
 	}
@@ -60,18 +71,78 @@ func main() {
 	if err := mqttClient.Connect(); err != nil {
 		logger.Fatal("server: MQTT client failed to connect to broker", zap.Error(err))
 	}
-	defer mqttClient.Disconnect()
 
 	// HTTP server
 
 	r := chi.NewRouter()
 
-	httpServer := server.OpenHttpServer(ctx, logger, r, serverDB, mqttClient)
-	defer httpServer.Close()
+	httpServer := server.OpenHttpServer(ctx, logger, r, serverDB, mqttClient, config)
+
+	if err := httpServer.SetAllowedOrigins(config.HTTP.AllowedOrigins); err != nil {
+		logger.Fatal("server: invalid allowed origins", zap.Error(err))
+	}
+
+	if err := httpServer.SetClientCertAuth(config.HTTP.ClientCertMode, config.HTTP.ClientCAFileName, config.HTTP.ClientCertUsersFileName); err != nil {
+		logger.Fatal("server: invalid client certificate options", zap.Error(err))
+	}
 
 	logger.Info("server: opened http server")
 
-	if err := httpServer.Serve(ctx, *httpPort, *httpServerTLSCertFileName, *httpServerTLSKeyFileName); err != nil {
-		logger.Fatal("server: failed to serve http server", zap.Error(err))
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(ctx, config.HTTP.Port, config.HTTP.TLSCertFileName, config.HTTP.TLSKeyFileName)
+	}()
+
+	failed := false
+	select {
+	case err := <-serveErr:
+		logger.Error("server: failed to serve http server", zap.Error(err))
+		failed = true
+	case <-signalCtx.Done():
+		logger.Info("server: received signal, shutting down")
 	}
+	stopSignals()
+
+	shutdown(logger, config.Shutdown, cancel, httpServer, mqttClient)
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+/*
+	Shuts down in order within the configured deadline:
+		1.) stop autonomous mode and drain in-flight HTTP requests
+		2.) drain in-flight MQTT publishes and message handlers (and their DB writes)
+		3.) optionally make the rover drop its queued drive instructions
+		4.) disconnect from the MQTT broker
+		5.) cancel the context and close the DB
+*/
+func shutdown(logger *zap.Logger, config server.ShutdownConfig, cancel context.CancelFunc, httpServer *server.HttpServer, mqttClient *server.MQTTClient) {
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), time.Duration(config.TimeoutSeconds)*time.Second)
+	defer cancelTimeout()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error("server: failed to shut down http server", zap.Error(err))
+	}
+
+	if err := mqttClient.Drain(ctx); err != nil {
+		logger.Error("server: failed to drain MQTT client", zap.Error(err))
+	}
+
+	if config.StopRover {
+		if err := mqttClient.StopRover(ctx); err != nil {
+			logger.Error("server: failed to stop rover", zap.Error(err))
+		}
+	}
+
+	mqttClient.Disconnect()
+
+	cancel()
+
+	if err := httpServer.Close(); err != nil {
+		logger.Error("server: failed to close http server", zap.Error(err))
+	}
+
+	logger.Info("server: shut down")
 }
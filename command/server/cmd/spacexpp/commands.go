@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+)
+
+type cli struct {
+	client   *client.Client
+	out      io.Writer
+	server   string
+	username string
+	password string
+
+	// Tokens used for bearer authentication, refreshed when the access token expired
+	tokens    storedTokens
+	tokenFile string // empty if tokens are not stored
+}
+
+// Traverse modes of target by name
+var traverseModes = map[string]int{
+	"simple":      0,
+	"full":        1,
+	"destination": 2,
+}
+
+// Number of events per feed request
+const feedPageSize = 100
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usagef("command required")
+	}
+
+	command, args := args[0], args[1:]
+
+	var run func(ctx context.Context, args []string) error
+	switch command {
+	case "login":
+		return c.login(ctx, args)
+	case "feed":
+		// Refreshes the access token per request so that -follow does not print events twice
+		return c.feed(ctx, args)
+	case "status":
+		run = c.status
+	case "map":
+		run = c.printMap
+	case "drive":
+		run = c.drive
+	case "turn":
+		run = c.turn
+	case "target":
+		run = c.target
+	case "autonomy":
+		run = c.autonomy
+	case "maps":
+		run = c.maps
+	default:
+		return usagef("unknown command %q", command)
+	}
+
+	// Every other command makes a single request, a request that failed authentication was not executed
+	return c.authorized(ctx, func() error {
+		return run(ctx, args)
+	})
+}
+
+// Calls the server and, if the access token expired, refreshes it and calls the server again
+func (c *cli) authorized(ctx context.Context, call func() error) error {
+	err := call()
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || c.tokens.RefreshToken == "" {
+		return err
+	}
+	if refreshErr := c.refreshTokens(ctx); refreshErr != nil {
+		return fmt.Errorf("access token expired and refreshing it failed (run spacexpp login): %w", refreshErr)
+	}
+	return call()
+}
+
+func (c *cli) refreshTokens(ctx context.Context) error {
+	// The refresh endpoint is public, the expired access token is not sent along
+	c.client.SetBearerToken("")
+	tokens, err := c.client.RefreshTokens(ctx, client.RefreshRequest{RefreshToken: c.tokens.RefreshToken})
+	if err != nil {
+		return err
+	}
+
+	c.client.SetBearerToken(tokens.AccessToken)
+	c.tokens.AccessToken = tokens.AccessToken
+	c.tokens.RefreshToken = tokens.RefreshToken
+	return c.saveTokens()
+}
+
+func (c *cli) saveTokens() error {
+	if c.tokenFile == "" {
+		return nil
+	}
+	return saveTokens(c.tokenFile, c.tokens)
+}
+
+/*
+	Stores the tokens in the token file so that later calls don't need the password and can refresh the access token.
+	The access token is printed as well for SPACEXPP_TOKEN.
+*/
+func (c *cli) login(ctx context.Context, args []string) error {
+	if err := expectArgs(args, 0); err != nil {
+		return err
+	}
+	if c.username == "" {
+		return usagef("login requires -username")
+	}
+
+	tokens, err := c.client.Login(ctx, client.LoginRequest{Username: c.username, Password: c.password})
+	if err != nil {
+		return err
+	}
+
+	c.tokens = storedTokens{
+		Server:       c.server,
+		Username:     c.username,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}
+	if err := c.saveTokens(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out, tokens.AccessToken)
+	return nil
+}
+
+func (c *cli) status(ctx context.Context, args []string) error {
+	if err := expectArgs(args, 0); err != nil {
+		return err
+	}
+
+	status, err := c.client.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MQTT connected:\t%v\n", yesNo(status.MqttConnected))
+	fmt.Fprintf(w, "Autonomous:\t%v\n", yesNo(status.Autonomous))
+	fmt.Fprintf(w, "Rover:\tx %v, y %v, facing %v (%v°)\n", status.Rover.X, status.Rover.Y, headingName(status.Rover.Rotation), status.Rover.Rotation)
+	fmt.Fprintf(w, "Battery:\tcharge %v%%, health %v%%, cell errors %v\n", status.Energy.StateOfCharge, status.Energy.StateOfHealth, status.Energy.ErrorInCells)
+	fmt.Fprintf(w, "Mission:\t%v (started %v)\n", status.Mission.MissionID, status.Mission.Started.Local().Format(time.RFC3339))
+	return w.Flush()
+}
+
+func (c *cli) printMap(ctx context.Context, args []string) error {
+	if err := expectArgs(args, 0); err != nil {
+		return err
+	}
+
+	liveMap, err := c.client.GetLiveMap(ctx)
+	if err != nil {
+		return err
+	}
+
+	return renderMap(c.out, liveMap)
+}
+
+// Drives forward by the distance in cm
+func (c *cli) drive(ctx context.Context, args []string) error {
+	if err := expectArgs(args, 1); err != nil {
+		return err
+	}
+	distance, err := intArg("distance", args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.client.DriveDistance(ctx, client.DriveDistanceRequest{Distance: distance})
+}
+
+// Turns by the angle in degrees, positive angles turn right
+func (c *cli) turn(ctx context.Context, args []string) error {
+	if err := expectArgs(args, 1); err != nil {
+		return err
+	}
+	angle, err := intArg("angle", args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.client.DriveAngle(ctx, client.DriveAngleRequest{Angle: angle})
+}
+
+func (c *cli) target(ctx context.Context, args []string) error {
+	flags := newFlagSet("target")
+	var mode = flags.String("mode", "simple", "Traverse mode: simple, full (discovery) or destination (discovery)")
+	if err := flags.Parse(args); err != nil {
+		return usagef("target: %v", err)
+	}
+	if err := expectArgs(flags.Args(), 2); err != nil {
+		return err
+	}
+
+	x, err := intArg("x", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	y, err := intArg("y", flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	modeValue, ok := traverseModes[*mode]
+	if !ok {
+		return usagef("unknown traverse mode %q (simple, full or destination)", *mode)
+	}
+
+	return c.client.DriveToTarget(ctx, client.Coordinates{X: x, Y: y, Mode: modeValue})
+}
+
+func (c *cli) autonomy(ctx context.Context, args []string) error {
+	if err := expectArgs(args, 1); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "start":
+		return c.client.StartAutonomy(ctx)
+	case "stop":
+		return c.client.StopAutonomy(ctx)
+	}
+	return usagef("autonomy: unknown action %q (start or stop)", args[0])
+}
+
+func (c *cli) maps(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usagef("maps: action required (list, save or load)")
+	}
+
+	action, args := args[0], args[1:]
+	switch action {
+	case "list":
+		if err := expectArgs(args, 0); err != nil {
+			return err
+		}
+		maps, err := c.client.ListMaps(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSIZE\tMISSION\tUPDATED")
+		for _, m := range maps {
+			fmt.Fprintf(w, "%v\t%v\t%vx%v\t%v\t%v\n", m.MapID, m.Name, m.Cols, m.Rows, m.MissionID, m.Updated.Local().Format(time.RFC3339))
+		}
+		return w.Flush()
+	case "save":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+		saved, err := c.client.SaveMap(ctx, client.SaveMapRequest{Name: args[0]})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Saved map %v as %v\n", args[0], saved.MapID)
+		return nil
+	case "load":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+		mapID, err := intArg("map id", args[0])
+		if err != nil {
+			return err
+		}
+		m, err := c.client.LoadMap(ctx, mapID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Loaded map %v (%v)\n", m.MapID, m.Name)
+		return nil
+	}
+	return usagef("maps: unknown action %q (list, save or load)", action)
+}
+
+/*
+	Prints the feed events after -after.
+	With -follow the feed is polled for new events until the command is interrupted.
+*/
+func (c *cli) feed(ctx context.Context, args []string) error {
+	flags := newFlagSet("feed")
+	var after = flags.Int("after", 0, "Only print events with a greater ID")
+	var follow = flags.Bool("follow", false, "Keep printing new events")
+	var interval = flags.Duration("interval", 2*time.Second, "Polling interval of -follow")
+	if err := flags.Parse(args); err != nil {
+		return usagef("feed: %v", err)
+	}
+	if err := expectArgs(flags.Args(), 0); err != nil {
+		return err
+	}
+
+	lastID := *after
+	for {
+		// All pages of events that are available now
+		for {
+			var feed client.FeedResponse
+			err := c.authorized(ctx, func() error {
+				var err error
+				feed, err = c.client.GetFeed(ctx, client.GetFeedParams{After: lastID, Limit: feedPageSize})
+				return err
+			})
+			if err != nil {
+				if errors.Is(ctx.Err(), context.Canceled) {
+					return nil
+				}
+				return err
+			}
+			for _, event := range feed.Events {
+				fmt.Fprintf(c.out, "%v  #%v  %v\n", event.Time.Local().Format("15:04:05"), event.ID, feedText(event.Message))
+			}
+			if len(feed.Events) == 0 {
+				break
+			}
+			lastID = feed.Events[len(feed.Events)-1].ID
+			if len(feed.Events) < feedPageSize {
+				break
+			}
+		}
+
+		if !*follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Feed messages are written for the web page, e.g. "<br> <br> Exiting autonomous mode", parts separated by line breaks are joined with "; "
+func feedText(message string) string {
+	var parts []string
+	for _, part := range htmlTag.Split(message, -1) {
+		if part = strings.Join(strings.Fields(html.UnescapeString(part)), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard) // errors are returned as usageError
+	return flags
+}
+
+func expectArgs(args []string, n int) error {
+	if len(args) != n {
+		return usagef("expected %v arguments, got %v", n, len(args))
+	}
+	return nil
+}
+
+func intArg(name string, value string) (int, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, usagef("%v must be an integer, got %q", name, value)
+	}
+	return i, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
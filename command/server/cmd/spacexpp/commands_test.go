@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+)
+
+// Fake API that records the request bodies and serves a feed with 150 events, the access token "expired" is rejected
+func newFakeServer(t *testing.T, requests *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*requests = append(*requests, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+
+		if r.Header.Get("Authorization") == "Bearer expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code": "unauthorized", "message": "Invalid access token"}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/auth/login":
+			json.NewEncoder(w).Encode(client.TokenResponse{AccessToken: "access", RefreshToken: "refresh"})
+			return
+		case "/api/v1/auth/refresh":
+			json.NewEncoder(w).Encode(client.TokenResponse{AccessToken: "refreshed-access", RefreshToken: "refreshed"})
+			return
+		case "/api/v1/drive/target":
+			var target client.Coordinates
+			json.Unmarshal(body, &target)
+			if target.X > 11 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"code": "invalid_value", "message": "invalid x", "field": "x"}`)
+				return
+			}
+		case "/api/v1/feed":
+			after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			feed := client.FeedResponse{Events: []client.FeedEvent{}, LastID: 150}
+			for id := after + 1; id <= 150 && len(feed.Events) < limit; id++ {
+				feed.Events = append(feed.Events, client.FeedEvent{ID: id, Time: time.Now(), Message: " event " + strconv.Itoa(id)})
+			}
+			json.NewEncoder(w).Encode(feed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCommands(t *testing.T) {
+	type test struct {
+		args             []string
+		expectedRequests []string
+		expectedOutput   string // contained in the output
+		expectedErrCode  int    // exit code of the error, 0 if successful
+	}
+
+	tests := []test{
+		{[]string{"drive", "30"}, []string{`POST /api/v1/drive/distance {"distance":30}`}, "", 0},
+		{[]string{"turn", "-90"}, []string{`POST /api/v1/drive/angle {"angle":-90}`}, "", 0},
+		{[]string{"target", "-mode", "full", "4", "7"}, []string{`POST /api/v1/drive/target {"x":4,"y":7,"mode":1}`}, "", 0},
+		{[]string{"target", "40", "7"}, []string{`POST /api/v1/drive/target {"x":40,"y":7,"mode":0}`}, "", exitRejected},
+		{[]string{"autonomy", "stop"}, []string{"POST /api/v1/autonomy/stop "}, "", 0},
+		{[]string{"feed", "-after", "120"}, []string{"GET /api/v1/feed "}, "#150  event 150\n", 0},
+		{[]string{"feed"}, []string{"GET /api/v1/feed ", "GET /api/v1/feed "}, "#101  event 101\n", 0},
+		{[]string{}, nil, "", exitUsage},
+		{[]string{"fly"}, nil, "", exitUsage},
+		{[]string{"drive"}, nil, "", exitUsage},
+		{[]string{"turn", "left"}, nil, "", exitUsage},
+		{[]string{"target", "-mode", "fast", "4", "7"}, nil, "", exitUsage},
+		{[]string{"autonomy", "pause"}, nil, "", exitUsage},
+		{[]string{"login"}, nil, "", exitUsage},
+	}
+
+	for _, test := range tests {
+		var requests []string
+		server := newFakeServer(t, &requests)
+
+		var out bytes.Buffer
+		c := &cli{client: client.New(server.URL), out: &out}
+		err := c.run(context.Background(), test.args)
+
+		if errCode := exitCode(err); errCode != test.expectedErrCode {
+			t.Errorf("%q returned error %v (exit code %v), expected exit code %v", test.args, err, errCode, test.expectedErrCode)
+			continue
+		}
+		if strings.Join(requests, "\n") != strings.Join(test.expectedRequests, "\n") {
+			t.Errorf("Requests of %q not equal to expected requests.\nOutput: %q\nExpected: %q", test.args, requests, test.expectedRequests)
+		}
+		if !strings.Contains(out.String(), test.expectedOutput) {
+			t.Errorf("Output of %q doesn't contain %q:\n%v", test.args, test.expectedOutput, out.String())
+		}
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	var requests []string
+	server := newFakeServer(t, &requests)
+	tokenFile := filepath.Join(t.TempDir(), "spacexpp", "tokens.json")
+
+	var out bytes.Buffer
+	c := &cli{client: client.New(server.URL), out: &out, server: server.URL, username: "lab", password: "Lab-password-1", tokenFile: tokenFile}
+	if err := c.run(context.Background(), []string{"login"}); err != nil {
+		t.Fatalf("login returned error: %v", err)
+	}
+	if out.String() != "access\n" {
+		t.Errorf("login printed %q, expected the access token", out.String())
+	}
+	if stored, err := loadTokens(tokenFile); err != nil || stored != (storedTokens{server.URL, "lab", "access", "refresh"}) {
+		t.Errorf("Stored tokens are %+v (error: %v), expected the tokens of the login", stored, err)
+	}
+
+	// The access token expired, the command is repeated with a refreshed one
+	requests = nil
+	c = &cli{client: client.New(server.URL, client.WithBearerToken("expired")), out: &out, server: server.URL, tokens: storedTokens{server.URL, "lab", "expired", "refresh"}, tokenFile: tokenFile}
+	if err := c.run(context.Background(), []string{"drive", "30"}); err != nil {
+		t.Fatalf("drive returned error: %v", err)
+	}
+	expected := []string{
+		`POST /api/v1/drive/distance {"distance":30}`,
+		`POST /api/v1/auth/refresh {"refreshToken":"refresh"}`,
+		`POST /api/v1/drive/distance {"distance":30}`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Requests not equal to expected requests.\nOutput: %q\nExpected: %q", requests, expected)
+	}
+	if stored, err := loadTokens(tokenFile); err != nil || stored != (storedTokens{server.URL, "lab", "refreshed-access", "refreshed"}) {
+		t.Errorf("Stored tokens are %+v (error: %v), expected the refreshed tokens", stored, err)
+	}
+
+	// Without a refresh token the error is returned
+	c = &cli{client: client.New(server.URL, client.WithBearerToken("expired")), out: &out}
+	if err := c.run(context.Background(), []string{"drive", "30"}); exitCode(err) != exitUnauthorized {
+		t.Errorf("drive with expired token returned error %v, expected exit code %v", err, exitUnauthorized)
+	}
+}
+
+func TestFeedText(t *testing.T) {
+	type test struct {
+		message  string
+		expected string
+	}
+
+	tests := []test{
+		{"Obstruction identified", "Obstruction identified"},
+		{"<br> <br> Exiting autonomous mode", "Exiting autonomous mode"},
+		{" <br> <br> Instruction : forward:30 : Sucsessful", "Instruction : forward:30 : Sucsessful"},
+		{"<br> <br> Stopped due to obstruction <br> <br> Computing new shortest path ", "Stopped due to obstruction; Computing new shortest path"},
+		{"<br> <br> Saved map loaded: lab &amp; arena", "Saved map loaded: lab & arena"},
+	}
+
+	for _, test := range tests {
+		output := feedText(test.message)
+		if output != test.expected {
+			t.Errorf("Feed text of %q not equal to expected text.\nOutput: %q\nExpected: %q", test.message, output, test.expected)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+)
+
+/*
+	Operates the rover through the versioned API of the command server:
+		spacexpp login                          stores the tokens in the token file and prints the access token
+		spacexpp status                         connection, rover pose, battery and mission
+		spacexpp map                            live map as ASCII with the rover heading
+		spacexpp drive 30                       drives forward 30 cm
+		spacexpp turn -90                       turns left by 90 degrees
+		spacexpp target -mode full 4 7          drives to tile (4, 7) (modes: simple, full, destination)
+		spacexpp autonomy start|stop
+		spacexpp maps list|save NAME|load ID
+		spacexpp feed [-follow] [-after ID]     prints feed events, -follow keeps polling for new ones
+	Credentials are taken from the flags or the SPACEXPP_* environment variables, e.g. in a test script:
+		export SPACEXPP_SERVER=https://rover-lab:3000 SPACEXPP_USERNAME=lab
+		echo "$PASSWORD" | spacexpp -password-stdin login > /dev/null
+		spacexpp drive 30 && spacexpp turn 90 && spacexpp map
+	After login the tokens in the token file are used and the access token is refreshed when it expired.
+	An access token given with -token or SPACEXPP_TOKEN takes precedence, it is refreshed with the stored refresh token.
+
+	Exit codes:
+		0 success
+		1 failure (e.g. server not reachable)
+		2 invalid command or arguments
+		3 request rejected by the server (e.g. target outside of the map)
+		4 not logged in or missing role
+*/
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitRejected     = 3
+	exitUnauthorized = 4
+)
+
+// Invalid command line, printed together with the usage
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	var serverURL = flag.String("server", envOrDefault("SPACEXPP_SERVER", "https://localhost:3000"), "URL of the command server (SPACEXPP_SERVER)")
+	var username = flag.String("username", os.Getenv("SPACEXPP_USERNAME"), "Username (SPACEXPP_USERNAME)")
+	var passwordStdin = flag.Bool("password-stdin", false, "Read the password from the first line of stdin instead of SPACEXPP_PASSWORD")
+	var token = flag.String("token", os.Getenv("SPACEXPP_TOKEN"), "Access token of spacexpp login, used instead of the password (SPACEXPP_TOKEN)")
+	var tokenFileName = flag.String("token-file", envOrDefault("SPACEXPP_TOKEN_FILE", defaultTokenFileName()), "File that spacexpp login stores the tokens in (SPACEXPP_TOKEN_FILE)")
+	var caFileName = flag.String("ca", os.Getenv("SPACEXPP_CA"), "CA certificate of the server if it isn't trusted by the system (SPACEXPP_CA)")
+	var certFileName = flag.String("cert", os.Getenv("SPACEXPP_CERT"), "Client certificate for mutual TLS (SPACEXPP_CERT)")
+	var keyFileName = flag.String("key", os.Getenv("SPACEXPP_KEY"), "Key of the client certificate (SPACEXPP_KEY)")
+	var timeout = flag.Duration("timeout", 10*time.Second, "Timeout of a single request")
+	flag.Usage = usage
+	flag.Parse()
+
+	password := os.Getenv("SPACEXPP_PASSWORD")
+	if *passwordStdin {
+		var err error
+		if password, err = readLine(os.Stdin); err != nil {
+			exit(fmt.Errorf("failed to read password: %w", err))
+		}
+	}
+
+	httpClient, err := newHTTPClient(*caFileName, *certFileName, *keyFileName, *timeout)
+	if err != nil {
+		exit(err)
+	}
+
+	// Tokens of an earlier login to the same server (and user if one is given)
+	stored, err := loadTokens(*tokenFileName)
+	if err != nil {
+		exit(err)
+	}
+	if stored.Server != *serverURL || (*username != "" && stored.Username != *username) {
+		stored = storedTokens{}
+	}
+
+	var tokens storedTokens
+	options := []client.Option{client.WithHTTPClient(httpClient)}
+	switch {
+	case *token != "":
+		tokens = stored
+		tokens.AccessToken = *token
+		options = append(options, client.WithBearerToken(*token))
+	case stored.AccessToken != "":
+		tokens = stored
+		options = append(options, client.WithBearerToken(stored.AccessToken))
+	case *username != "":
+		options = append(options, client.WithBasicAuth(*username, password))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &cli{
+		client:    client.New(*serverURL, options...),
+		out:       os.Stdout,
+		server:    *serverURL,
+		username:  *username,
+		password:  password,
+		tokens:    tokens,
+		tokenFile: *tokenFileName,
+	}
+	if err := c.run(ctx, flag.Args()); err != nil {
+		exit(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(flag.CommandLine.Output(), "Usage: spacexpp [flags] login|status|map|drive|turn|target|autonomy|maps|feed [arguments]")
+	flag.PrintDefaults()
+}
+
+// Prints the error and exits with its exit code
+func exit(err error) {
+	code := exitCode(err)
+
+	fmt.Fprintf(os.Stderr, "spacexpp: %v\n", err)
+	if code == exitUsage {
+		usage()
+	}
+	os.Exit(code)
+}
+
+func exitCode(err error) int {
+	var usageErr *usageError
+	var apiErr *client.Error
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+		return exitUnauthorized
+	case errors.As(err, &apiErr) && apiErr.StatusCode < 500:
+		return exitRejected
+	}
+	return exitFailure
+}
+
+func envOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		return "", fmt.Errorf("no line given: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// HTTP client that trusts the CA (system CAs if empty) and presents the client certificate (if given)
+func newHTTPClient(caFileName string, certFileName string, keyFileName string, timeout time.Duration) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFileName != "" {
+		caCert, err := ioutil.ReadFile(caFileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %v", caFileName)
+		}
+	}
+
+	if certFileName != "" || keyFileName != "" {
+		cert, err := tls.LoadX509KeyPair(certFileName, keyFileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+)
+
+// Characters of the tile values of the server (see tileLegend in map_formats.go)
+var tileChars = map[int]byte{
+	1:  '?', // Unknown
+	2:  '.', // Empty
+	3:  '#', // Border
+	4:  '.', // Rover (drawn with its heading instead)
+	5:  'X', // Unknown obstruction
+	6:  'B', // Blue ball
+	7:  'R', // Red ball
+	8:  'Y', // Yellow ball
+	9:  'T', // Teal ball
+	10: 'V', // Violet ball
+	11: '!', // No-go zone
+}
+
+const mapLegend = "? unknown  . empty  # border  X obstruction  B/R/Y/T/V ball  ! no-go  >v<^ rover"
+
+func tileChar(value int) byte {
+	if c, ok := tileChars[value]; ok {
+		return c
+	}
+	return '*'
+}
+
+// Rover character of the rotation (0° = east, clockwise)
+func headingChar(rotation int) byte {
+	switch ((rotation % 360) + 360) % 360 {
+	case 0:
+		return '>'
+	case 90:
+		return 'v'
+	case 180:
+		return '<'
+	case 270:
+		return '^'
+	}
+	return '@'
+}
+
+func headingName(rotation int) string {
+	switch ((rotation % 360) + 360) % 360 {
+	case 0:
+		return "east"
+	case 90:
+		return "south"
+	case 180:
+		return "west"
+	case 270:
+		return "north"
+	}
+	return "unknown"
+}
+
+/*
+	Writes one line per map row (row 0 at the top) with the last digit of the x and y coordinates on the axes, e.g.
+		  0123
+		0 ####
+		1 #>?#
+		2 ####
+*/
+func renderMap(out io.Writer, m client.LiveMap) error {
+	if m.Rows <= 0 || m.Cols <= 0 || len(m.Layout) != m.Rows*m.Cols {
+		return fmt.Errorf("map with %v rows and %v cols has %v tiles", m.Rows, m.Cols, len(m.Layout))
+	}
+
+	w := bufio.NewWriter(out)
+
+	w.WriteString("  ")
+	for x := 0; x < m.Cols; x++ {
+		w.WriteByte(byte('0' + x%10))
+	}
+	w.WriteByte('\n')
+
+	for y := 0; y < m.Rows; y++ {
+		w.WriteByte(byte('0' + y%10))
+		w.WriteByte(' ')
+		for x := 0; x < m.Cols; x++ {
+			if x == m.Rover.X && y == m.Rover.Y {
+				w.WriteByte(headingChar(m.Rover.Rotation))
+			} else {
+				w.WriteByte(tileChar(m.Layout[x+y*m.Cols]))
+			}
+		}
+		w.WriteByte('\n')
+	}
+
+	w.WriteString(mapLegend + "\n")
+	return w.Flush()
+}
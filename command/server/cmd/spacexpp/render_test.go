@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/IBricchi/SpaceXpp/command/server/client"
+)
+
+func TestRenderMap(t *testing.T) {
+	type test struct {
+		m           client.LiveMap
+		expected    string
+		expectError bool
+	}
+
+	tests := []test{
+		{
+			client.LiveMap{Rows: 3, Cols: 4, Layout: []int{3, 3, 3, 3, 3, 2, 1, 3, 3, 3, 3, 3}, Rover: client.Rover{X: 1, Y: 1, Rotation: 0}},
+			"  0123\n0 ####\n1 #>?#\n2 ####\n" + mapLegend + "\n",
+			false,
+		},
+		{
+			client.LiveMap{Rows: 2, Cols: 3, Layout: []int{6, 11, 5, 2, 2, 42}, Rover: client.Rover{X: 1, Y: 1, Rotation: 270}},
+			"  012\n0 B!X\n1 .^*\n" + mapLegend + "\n",
+			false,
+		},
+		{
+			client.LiveMap{Rows: 1, Cols: 2, Layout: []int{2, 2}, Rover: client.Rover{X: 0, Y: 0, Rotation: -90}},
+			"  01\n0 ^.\n" + mapLegend + "\n",
+			false,
+		},
+		{
+			client.LiveMap{Rows: 2, Cols: 2, Layout: []int{2, 2, 2}},
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := renderMap(&out, test.m)
+		if (err != nil) != test.expectError {
+			t.Errorf("renderMap of %+v returned error %v, expected error: %v", test.m, err, test.expectError)
+			continue
+		}
+		if out.String() != test.expected {
+			t.Errorf("Rendered map not equal to expected map.\nOutput:\n%v\nExpected:\n%v", out.String(), test.expected)
+		}
+	}
+}
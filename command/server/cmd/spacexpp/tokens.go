@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+/*
+	Tokens of the last spacexpp login, stored in the token file so that later calls are authenticated
+	and can get a new access token with the refresh token once the access token expired.
+	The file is only readable by the user as the refresh token is as good as the password until it expires.
+*/
+type storedTokens struct {
+	Server       string `json:"server"`
+	Username     string `json:"username"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// $XDG_CONFIG_HOME/spacexpp/tokens.json or the equivalent of the OS, empty if there is no config directory
+func defaultTokenFileName() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "spacexpp", "tokens.json")
+}
+
+// Returns empty tokens if the file does not exist
+func loadTokens(fileName string) (storedTokens, error) {
+	var tokens storedTokens
+	if fileName == "" {
+		return tokens, nil
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return tokens, fmt.Errorf("failed to read token file: %w", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return tokens, fmt.Errorf("failed to decode token file %v: %w", fileName, err)
+	}
+	return tokens, nil
+}
+
+// Replaces the token file atomically so that an interrupted write doesn't lose the refresh token
+func saveTokens(fileName string, tokens storedTokens) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("failed to encode tokens: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return fmt.Errorf("failed to create token file directory: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), ".tokens-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		return fmt.Errorf("failed to replace token file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+	Configuration of cmd/server. Every setting is taken from the first of these that sets it:
+		1.) command line flag (e.g. -mqttBrokerURL)
+		2.) environment variable (e.g. SPACEXPP_MQTT_BROKER_URL)
+		3.) YAML config file given by -config or SPACEXPP_CONFIG (e.g. mqtt: brokerURL: ...), see config.example.yaml
+		4.) default value (see DefaultConfig)
+	The config is validated at startup and admins can read it (without secrets) through GET /config.
+*/
+type Config struct {
+	HTTP      HTTPConfig      `yaml:"http" json:"http"`
+	MQTT      MQTTConfig      `yaml:"mqtt" json:"mqtt"`
+	DB        DBConfig        `yaml:"db" json:"db"`
+	Passwords PasswordsConfig `yaml:"passwords" json:"passwords"`
+	Map       MapConfig       `yaml:"map" json:"map"`
+	Autonomy  AutonomyConfig  `yaml:"autonomy" json:"autonomy"`
+	Shutdown  ShutdownConfig  `yaml:"shutdown" json:"shutdown"`
+	Log       LogConfig       `yaml:"log" json:"log"`
+}
+
+type HTTPConfig struct {
+	Port                    string   `yaml:"port" json:"port"`
+	TLSCertFileName         string   `yaml:"tlsCertFileName" json:"tlsCertFileName"`
+	TLSKeyFileName          string   `yaml:"tlsKeyFileName" json:"tlsKeyFileName"`
+	AllowedOrigins          []string `yaml:"allowedOrigins" json:"allowedOrigins"`
+	ClientCertMode          string   `yaml:"clientCertMode" json:"clientCertMode"`
+	ClientCAFileName        string   `yaml:"clientCAFileName" json:"clientCAFileName"`
+	ClientCertUsersFileName string   `yaml:"clientCertUsersFileName" json:"clientCertUsersFileName"`
+}
+
+type MQTTConfig struct {
+	BrokerURL  string `yaml:"brokerURL" json:"brokerURL"`
+	Username   string `yaml:"username" json:"username"`
+	Password   string `yaml:"password" json:"password"`
+	ClientID   string `yaml:"clientID" json:"clientID"`
+	CAFileName string `yaml:"caFileName" json:"caFileName"`
+}
+
+type DBConfig struct {
+	DSN string `yaml:"dsn" json:"dsn"` // SQLite DB file path or postgres:// DSN
+}
+
+type PasswordsConfig struct {
+	Hash       string `yaml:"hash" json:"hash"`
+	BcryptCost int    `yaml:"bcryptCost" json:"bcryptCost"`
+}
+
+type MapConfig struct {
+	Rows      int `yaml:"rows" json:"rows"`
+	Cols      int `yaml:"cols" json:"cols"`
+	TileWidth int `yaml:"tileWidth" json:"tileWidth"` // cm
+}
+
+type AutonomyConfig struct {
+	TraverseMode          int  `yaml:"traverseMode" json:"traverseMode"` // 0: simple, 1: full discovery, 2: destination discovery
+	StopWhenAllBallsFound bool `yaml:"stopWhenAllBallsFound" json:"stopWhenAllBallsFound"`
+}
+
+type ShutdownConfig struct {
+	TimeoutSeconds int  `yaml:"timeoutSeconds" json:"timeoutSeconds"` // deadline for draining requests and messages
+	StopRover      bool `yaml:"stopRover" json:"stopRover"`           // make the rover drop its queued drive instructions
+}
+
+type LogConfig struct {
+	Format string `yaml:"format" json:"format"` // production (JSON) or development (console)
+	Level  string `yaml:"level" json:"level"`   // debug, info, warn or error
+}
+
+const (
+	configEnvPrefix = "SPACEXPP_"
+
+	maxMapSize   = 1000
+	maxTileWidth = 1000
+
+	maxShutdownTimeoutSeconds = 600
+)
+
+func DefaultConfig() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Port:                    "3000",
+			TLSCertFileName:         "cert/server.crt",
+			TLSKeyFileName:          "cert/server.key",
+			AllowedOrigins:          []string{"https://spacexpp.co.uk"},
+			ClientCertMode:          ClientCertOff,
+			ClientCAFileName:        "cert/client_ca.crt",
+			ClientCertUsersFileName: "cert/client_users.yaml",
+		},
+		MQTT: MQTTConfig{
+			ClientID:   "SpaceXpp_server",
+			CAFileName: "cert/mqtt_ca_cert.pem",
+		},
+		DB: DBConfig{
+			DSN: "db/serverDB.db",
+		},
+		Passwords: PasswordsConfig{
+			Hash:       PasswordHashBcrypt,
+			BcryptCost: DefaultBcryptCost,
+		},
+		Map: MapConfig{
+			Rows:      12,
+			Cols:      12,
+			TileWidth: 30,
+		},
+		Autonomy: AutonomyConfig{
+			TraverseMode:          int(fullDiscovery),
+			StopWhenAllBallsFound: true,
+		},
+		Shutdown: ShutdownConfig{
+			TimeoutSeconds: 30,
+			StopRover:      true,
+		},
+		Log: LogConfig{
+			Format: LogFormatDevelopment,
+			Level:  "info",
+		},
+	}
+}
+
+// Setting that can be overridden by an environment variable and a flag
+type configSetting struct {
+	env   string // without configEnvPrefix
+	flag  string
+	usage string
+	value interface{} // *string, *int, *bool or *[]string
+}
+
+// The flag names are the ones cmd/server used before it had a config file
+func (c *Config) settings() []configSetting {
+	return []configSetting{
+		{"HTTP_PORT", "httpPort", "Port for serving http server", &c.HTTP.Port},
+		{"HTTP_TLS_CERT_FILE_NAME", "httpServerTLSCertFileName", "File path of TLS HTTP server certificate", &c.HTTP.TLSCertFileName},
+		{"HTTP_TLS_KEY_FILE_NAME", "httpServerTLSKeyFileName", "File path of TLS HTTP server key", &c.HTTP.TLSKeyFileName},
+		{"HTTP_ALLOWED_ORIGINS", "allowedOrigins", "Comma separated origins of websites that may use the API from a browser", &c.HTTP.AllowedOrigins},
+		{"HTTP_CLIENT_CERT_MODE", "clientCertMode", "Client certificate authentication (off, optional or required)", &c.HTTP.ClientCertMode},
+		{"HTTP_CLIENT_CA_FILE_NAME", "clientCAFileName", "File path of the CA certificate that client certificates must be signed by", &c.HTTP.ClientCAFileName},
+		{"HTTP_CLIENT_CERT_USERS_FILE_NAME", "clientCertUsersFileName", "File path of the YAML file mapping client certificate subjects to users and roles", &c.HTTP.ClientCertUsersFileName},
+		{"MQTT_BROKER_URL", "mqttBrokerURL", "URL of MQTT Broker (e.g. ssl://broker:8883)", &c.MQTT.BrokerURL},
+		{"MQTT_USERNAME", "mqttUsername", "MQTT Username", &c.MQTT.Username},
+		{"MQTT_PASSWORD", "mqttPassword", "MQTT Password", &c.MQTT.Password},
+		{"MQTT_CLIENT_ID", "mqttClientID", "MQTT client ID", &c.MQTT.ClientID},
+		{"MQTT_CA_FILE_NAME", "mqttCAFileName", "File path of the CA certificate of the MQTT broker", &c.MQTT.CAFileName},
+		{"DB_DSN", "db", "SQLite DB file path or postgres:// DSN", &c.DB.DSN},
+		{"PASSWORDS_HASH", "passwordHash", "Hash algorithm for passwords set through the HTTP API (bcrypt or argon2id)", &c.Passwords.Hash},
+		{"PASSWORDS_BCRYPT_COST", "bcryptCost", "bcrypt cost for passwords set through the HTTP API", &c.Passwords.BcryptCost},
+		{"MAP_ROWS", "mapRows", "Number of rows of the map (including the border)", &c.Map.Rows},
+		{"MAP_COLS", "mapCols", "Number of columns of the map (including the border)", &c.Map.Cols},
+		{"MAP_TILE_WIDTH", "tileWidth", "Height/width of a map tile in cm", &c.Map.TileWidth},
+		{"AUTONOMY_TRAVERSE_MODE", "autonomyTraverseMode", "Traversal mode of autonomous mode (0: simple, 1: full discovery, 2: destination discovery)", &c.Autonomy.TraverseMode},
+		{"AUTONOMY_STOP_WHEN_ALL_BALLS_FOUND", "autonomyStopWhenAllBallsFound", "Stop autonomous mode once all balls were found", &c.Autonomy.StopWhenAllBallsFound},
+		{"SHUTDOWN_TIMEOUT_SECONDS", "shutdownTimeout", "Seconds to wait for in-flight requests and MQTT messages when shutting down", &c.Shutdown.TimeoutSeconds},
+		{"SHUTDOWN_STOP_ROVER", "shutdownStopRover", "Make the rover drop its queued drive instructions when shutting down", &c.Shutdown.StopRover},
+		{"LOG_FORMAT", "logFormat", "Log encoding (production: JSON, development: console)", &c.Log.Format},
+		{"LOG_LEVEL", "logLevel", "Minimum log level (debug, info, warn or error)", &c.Log.Level},
+	}
+}
+
+// Flags of all settings, the values of the flags are only used if they are set
+type ConfigFlags struct {
+	flagSet *flag.FlagSet
+	values  Config
+}
+
+// Registers a flag for every setting, must be called before parsing the flag set
+func NewConfigFlags(flagSet *flag.FlagSet) *ConfigFlags {
+	f := &ConfigFlags{
+		flagSet: flagSet,
+		values:  DefaultConfig(),
+	}
+
+	for _, setting := range f.values.settings() {
+		switch value := setting.value.(type) {
+		case *string:
+			flagSet.StringVar(value, setting.flag, *value, setting.usage)
+		case *int:
+			flagSet.IntVar(value, setting.flag, *value, setting.usage)
+		case *bool:
+			flagSet.BoolVar(value, setting.flag, *value, setting.usage)
+		case *[]string:
+			flagSet.Var((*stringListFlag)(value), setting.flag, setting.usage)
+		}
+	}
+
+	return f
+}
+
+// Comma separated list
+type stringListFlag []string
+
+func (l *stringListFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringListFlag) Set(value string) error {
+	*l = splitList(value)
+	return nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+/*
+	Loads the config from the defaults, the config file (skipped if fileName is empty),
+	the environment and the flags that were set, in that order. The flag set must be parsed.
+	Returns an error if the config is invalid.
+*/
+func (f *ConfigFlags) Load(fileName string) (Config, error) {
+	config := DefaultConfig()
+
+	if fileName != "" {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return Config{}, fmt.Errorf("server: config: failed to read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			return Config{}, fmt.Errorf("server: config: failed to parse config file %v: %w", fileName, err)
+		}
+	}
+
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	settings := config.settings()
+	flagValues := f.values.settings()
+	f.flagSet.Visit(func(fl *flag.Flag) {
+		for i, setting := range settings {
+			if setting.flag == fl.Name {
+				copySetting(setting.value, flagValues[i].value)
+			}
+		}
+	})
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) error {
+	for _, setting := range c.settings() {
+		env, ok := lookupEnv(configEnvPrefix + setting.env)
+		if !ok {
+			continue
+		}
+
+		switch value := setting.value.(type) {
+		case *string:
+			*value = env
+		case *int:
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return fmt.Errorf("server: config: %v%v must be an integer: %w", configEnvPrefix, setting.env, err)
+			}
+			*value = n
+		case *bool:
+			b, err := strconv.ParseBool(env)
+			if err != nil {
+				return fmt.Errorf("server: config: %v%v must be true or false: %w", configEnvPrefix, setting.env, err)
+			}
+			*value = b
+		case *[]string:
+			*value = splitList(env)
+		}
+	}
+	return nil
+}
+
+func copySetting(dst interface{}, src interface{}) {
+	switch dst := dst.(type) {
+	case *string:
+		*dst = *src.(*string)
+	case *int:
+		*dst = *src.(*int)
+	case *bool:
+		*dst = *src.(*bool)
+	case *[]string:
+		*dst = append([]string{}, *src.(*[]string)...)
+	}
+}
+
+// Returns all problems of the config in one error
+func (c Config) Validate() error {
+	var problems []string
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 1 || port > 65535 {
+		invalid("http.port %q must be between 1 and 65535", c.HTTP.Port)
+	}
+	if c.HTTP.TLSCertFileName == "" || c.HTTP.TLSKeyFileName == "" {
+		invalid("http.tlsCertFileName and http.tlsKeyFileName are required")
+	}
+	if _, err := parseAllowedOrigins(c.HTTP.AllowedOrigins); err != nil {
+		invalid("http.allowedOrigins: %v", err)
+	}
+	switch c.HTTP.ClientCertMode {
+	case ClientCertOff:
+	case ClientCertOptional, ClientCertRequired:
+		if c.HTTP.ClientCAFileName == "" || c.HTTP.ClientCertUsersFileName == "" {
+			invalid("http.clientCAFileName and http.clientCertUsersFileName are required for client certificate mode %v", c.HTTP.ClientCertMode)
+		}
+	default:
+		invalid("http.clientCertMode %q must be off, optional or required", c.HTTP.ClientCertMode)
+	}
+
+	if u, err := url.Parse(c.MQTT.BrokerURL); c.MQTT.BrokerURL == "" || err != nil || u.Scheme == "" || u.Host == "" {
+		invalid("mqtt.brokerURL %q must be a URL like ssl://broker:8883", c.MQTT.BrokerURL)
+	}
+	if c.MQTT.ClientID == "" {
+		invalid("mqtt.clientID is required")
+	}
+	if c.MQTT.CAFileName == "" {
+		invalid("mqtt.caFileName is required")
+	}
+
+	if c.DB.DSN == "" {
+		invalid("db.dsn is required")
+	}
+
+	switch c.Passwords.Hash {
+	case PasswordHashBcrypt:
+		if c.Passwords.BcryptCost < bcrypt.MinCost || c.Passwords.BcryptCost > bcrypt.MaxCost {
+			invalid("passwords.bcryptCost must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordHashArgon2id:
+	default:
+		invalid("passwords.hash %q must be bcrypt or argon2id", c.Passwords.Hash)
+	}
+
+	// Needs at least one tile inside of the border
+	if c.Map.Rows < 3 || c.Map.Rows > maxMapSize || c.Map.Cols < 3 || c.Map.Cols > maxMapSize {
+		invalid("map.rows and map.cols must be between 3 and %v", maxMapSize)
+	}
+	if c.Map.TileWidth < 1 || c.Map.TileWidth > maxTileWidth {
+		invalid("map.tileWidth must be between 1 and %v cm", maxTileWidth)
+	}
+
+	if _, err := value2Mode(c.Autonomy.TraverseMode); err != nil {
+		invalid("autonomy.traverseMode must be 0, 1 or 2")
+	}
+
+	if c.Shutdown.TimeoutSeconds < 1 || c.Shutdown.TimeoutSeconds > maxShutdownTimeoutSeconds {
+		invalid("shutdown.timeoutSeconds must be between 1 and %v", maxShutdownTimeoutSeconds)
+	}
+
+	if c.Log.Format != LogFormatProduction && c.Log.Format != LogFormatDevelopment {
+		invalid("log.format %q must be production or development", c.Log.Format)
+	}
+	if _, err := parseLogLevel(c.Log.Level); err != nil {
+		invalid("log.level %q must be debug, info, warn or error", c.Log.Level)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("server: config: invalid config: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Copy of the config without secrets
+func (c Config) redacted() Config {
+	if c.MQTT.Password != "" {
+		c.MQTT.Password = "[redacted]"
+	}
+	if IsPostgresDSN(c.DB.DSN) {
+		u, err := url.Parse(c.DB.DSN)
+		if err != nil {
+			c.DB.DSN = "[redacted]"
+			return c
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+		}
+		if query := u.Query(); query.Get("password") != "" {
+			query.Set("password", "redacted")
+			u.RawQuery = query.Encode()
+		}
+		c.DB.DSN = u.String()
+	}
+	return c
+}
@@ -7,82 +7,284 @@ package server
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 
-	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+var (
+	errUserNotFound  = errors.New("server: credentials: user does not exist")
+	errUsernameTaken = errors.New("server: credentials: a user with this name already exists")
+	errInvalidUser   = errors.New("server: credentials: invalid user")
 )
 
 type credential struct {
 	username string
-	password string
+	password string // bcrypt or argon2id hash (see passwords.go)
+	role     role
+	disabled bool
 }
 
-func AddCredential(ctx context.Context, db DB) error {
-	quitStr := "#"
+// Minimum length of usernames, passwords follow the password policy (see passwords.go)
+const minCredentialLength = 3
 
-	fmt.Println("Adding new user (Enter # to quit):")
-	fmt.Println("Enter username: ")
-	username, quit := validateCredentialStringInput(quitStr)
-	if quit {
-		return nil
+func validateCredentialString(name string, value string) error {
+	if len(value) < minCredentialLength {
+		return fmt.Errorf("%w: %s must contain at least %v characters", errInvalidUser, name, minCredentialLength)
 	}
+	return nil
+}
 
-	// Want to guarantee unique usernames
-	creds, err := db.getCredentials(ctx)
-	if err != nil {
-		return fmt.Errorf("server: auth: failed to get creds: %w", err)
+func createUser(ctx context.Context, db DB, username string, password string, userRole role) error {
+	if err := validateCredentialString("username", username); err != nil {
+		return err
 	}
-	if _, exists := creds[username]; exists {
-		fmt.Println("Username already exists. Please try again.")
-		return AddCredential(ctx, db)
+	if err := validatePassword(username, password); err != nil {
+		return err
 	}
-
-	fmt.Println("Enter password: ")
-	password, quit := validateCredentialStringInput(quitStr)
-	if quit {
-		return nil
+	if _, err := parseRole(string(userRole)); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidUser, err)
 	}
 
-	// Hash with salt
-	bytePassword := []byte(password)
-	passwordHash, err := bcrypt.GenerateFromPassword(bytePassword, bcrypt.MinCost)
+	passwordHash, err := hashPassword(password)
 	if err != nil {
-		return fmt.Errorf("server: credentials: failed to encrypt password: %w", err)
+		return err
 	}
 
 	if err := db.insertCredentials(ctx, credential{
 		username: username,
-		password: string(passwordHash),
+		password: passwordHash,
+		role:     userRole,
 	}); err != nil {
 		return fmt.Errorf("server: credentials: failed to insert credentials into db: %w", err)
 	}
+	return nil
+}
+
+// Existing sessions of the user are revoked so that the old password can't be used to stay logged in
+func resetPassword(ctx context.Context, db DB, username string, password string) error {
+	if err := validatePassword(username, password); err != nil {
+		return err
+	}
 
-	// keep asking to add more credentials until quit
-	return AddCredential(ctx, db)
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := db.updateCredentialPassword(ctx, username, passwordHash); err != nil {
+		return fmt.Errorf("server: credentials: failed to update password: %w", err)
+	}
+	if err := db.revokeUserSessions(ctx, username); err != nil {
+		return fmt.Errorf("server: credentials: failed to revoke sessions: %w", err)
+	}
+	return nil
 }
 
-// Returns a 'true' boolean and empty string if quit. Returns a valid user input otherwise.
-func validateCredentialStringInput(quitStr string) (string, bool) {
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	input := scanner.Text()
+func setUserRole(ctx context.Context, db DB, username string, userRole role) error {
+	if _, err := parseRole(string(userRole)); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidUser, err)
+	}
+
+	if err := db.updateCredentialRole(ctx, username, userRole); err != nil {
+		return fmt.Errorf("server: credentials: failed to update role: %w", err)
+	}
+	return nil
+}
 
-	if input == quitStr {
-		return "", true
+func setUserDisabled(ctx context.Context, db DB, username string, disabled bool) error {
+	if err := db.updateCredentialDisabled(ctx, username, disabled); err != nil {
+		return fmt.Errorf("server: credentials: failed to update disabled state: %w", err)
+	}
+	if disabled {
+		if err := db.revokeUserSessions(ctx, username); err != nil {
+			return fmt.Errorf("server: credentials: failed to revoke sessions: %w", err)
+		}
 	}
+	return nil
+}
 
-	// Don't accept empty string
-	if input == "" {
-		fmt.Print("A value is required. Please try again: ")
-		return validateCredentialStringInput(quitStr)
+func deleteUser(ctx context.Context, db DB, username string) error {
+	if err := db.deleteCredentials(ctx, username); err != nil {
+		return fmt.Errorf("server: credentials: failed to delete credentials: %w", err)
+	}
+	if err := db.revokeUserSessions(ctx, username); err != nil {
+		return fmt.Errorf("server: credentials: failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// Interactively adds users until quit
+func AddCredential(ctx context.Context, db DB) error {
+	quitStr := "#"
+
+	for {
+		fmt.Println("Adding new user (Enter # to quit):")
+		fmt.Println("Enter username: ")
+		username, quit := validateCredentialStringInput(quitStr)
+		if quit {
+			return nil
+		}
+
+		fmt.Println(PasswordPolicy)
+		fmt.Println("Enter password: ")
+		password, quit := validatePasswordInput(quitStr)
+		if quit {
+			return nil
+		}
+
+		fmt.Println("Enter role (viewer, operator or admin): ")
+		userRole, quit := validateRoleInput(quitStr)
+		if quit {
+			return nil
+		}
+
+		if err := createUser(ctx, db, username, password, userRole); err != nil {
+			switch {
+			case errors.Is(err, errUsernameTaken):
+				fmt.Println("Username already exists. Please try again.")
+			case errors.Is(err, errInvalidUser):
+				fmt.Printf("%v. Please try again.\n", err)
+			default:
+				return err
+			}
+		}
 	}
+}
+
+func AddUser(ctx context.Context, db DB, username string, userRole string, password string) error {
+	return createUser(ctx, db, username, password, role(userRole))
+}
 
-	// Minimum length requirement
-	if len(input) < 3 {
-		fmt.Print("Input must contain at least three characters. Please try again: ")
+// Prints all users with their role and state
+func ListUsers(ctx context.Context, db DB, w io.Writer) error {
+	creds, err := db.getCredentials(ctx)
+	if err != nil {
+		return fmt.Errorf("server: credentials: failed to get credentials: %w", err)
+	}
+
+	usernames := make([]string, 0, len(creds))
+	for username := range creds {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	for _, username := range usernames {
+		state := "enabled"
+		if creds[username].disabled {
+			state = "disabled"
+		}
+		fmt.Fprintf(w, "%-30s %-10s %s\n", username, creds[username].role, state)
+	}
+	return nil
+}
+
+func DisableUser(ctx context.Context, db DB, username string) error {
+	return setUserDisabled(ctx, db, username, true)
+}
+
+func EnableUser(ctx context.Context, db DB, username string) error {
+	return setUserDisabled(ctx, db, username, false)
+}
+
+func DeleteUser(ctx context.Context, db DB, username string) error {
+	return deleteUser(ctx, db, username)
+}
+
+func ResetPassword(ctx context.Context, db DB, username string, password string) error {
+	return resetPassword(ctx, db, username, password)
+}
+
+// Errors of the user management functions, used by cmd/credentials for its exit codes
+
+func IsUserNotFound(err error) bool {
+	return errors.Is(err, errUserNotFound)
+}
+
+func IsUsernameTaken(err error) bool {
+	return errors.Is(err, errUsernameTaken)
+}
+
+func IsInvalidUser(err error) bool {
+	return errors.Is(err, errInvalidUser)
+}
+
+// A single scanner so that input that was read ahead is not lost between prompts
+var stdinScanner = bufio.NewScanner(os.Stdin)
+
+// Returns a 'true' boolean and empty string if quit. Returns a valid user input otherwise.
+func validateCredentialStringInput(quitStr string) (string, bool) {
+	return readCredentialInput(quitStr, func() (string, bool) {
+		if !stdinScanner.Scan() {
+			return "", false
+		}
+		return stdinScanner.Text(), true
+	})
+}
+
+// Like validateCredentialStringInput but the password isn't echoed if stdin is a terminal
+func validatePasswordInput(quitStr string) (string, bool) {
+	stdinFd := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdinFd) {
 		return validateCredentialStringInput(quitStr)
 	}
 
-	return input, false
+	return readCredentialInput(quitStr, func() (string, bool) {
+		password, err := term.ReadPassword(stdinFd)
+		fmt.Println()
+		if err != nil {
+			return "", false
+		}
+		return string(password), true
+	})
+}
+
+// Reads lines until one is valid, readLine returns false at the end of input
+func readCredentialInput(quitStr string, readLine func() (string, bool)) (string, bool) {
+	for {
+		input, ok := readLine()
+		if !ok { // end of input
+			return "", true
+		}
+
+		if input == quitStr {
+			return "", true
+		}
+
+		// Don't accept empty string
+		if input == "" {
+			fmt.Print("A value is required. Please try again: ")
+			continue
+		}
+
+		// Minimum length requirement
+		if len(input) < minCredentialLength {
+			fmt.Print("Input must contain at least three characters. Please try again: ")
+			continue
+		}
+
+		return input, false
+	}
+}
+
+// Returns a 'true' boolean and empty role if quit. Returns a valid role otherwise.
+func validateRoleInput(quitStr string) (role, bool) {
+	for {
+		input, quit := validateCredentialStringInput(quitStr)
+		if quit {
+			return "", true
+		}
+
+		userRole, err := parseRole(input)
+		if err != nil {
+			fmt.Print("Role must be viewer, operator or admin. Please try again: ")
+			continue
+		}
+
+		return userRole, false
+	}
 }
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+	Credentials are looked up on every authentication.
+	They are cached for credentialsCacheTTL so that not every request queries the db.
+	Changes made through the HTTP API invalidate the cache immediately,
+	changes made with cmd/credentials (a different process) take effect once the cache expires.
+*/
+const credentialsCacheTTL = 10 * time.Second
+
+type credentialStore struct {
+	db  DB
+	ttl time.Duration
+
+	mu     sync.Mutex
+	creds  map[string]credential
+	loaded time.Time
+}
+
+func newCredentialStore(db DB, ttl time.Duration) *credentialStore {
+	return &credentialStore{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// Returns all credentials (including disabled users). The returned map must not be modified.
+func (c *credentialStore) getAll(ctx context.Context) (map[string]credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.creds != nil && time.Since(c.loaded) < c.ttl {
+		return c.creds, nil
+	}
+
+	creds, err := c.db.getCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server: credentials_store: failed to get credentials: %w", err)
+	}
+
+	c.creds = creds
+	c.loaded = time.Now()
+
+	return creds, nil
+}
+
+// Returns the credential of an enabled user. ok is false if the user does not exist or is disabled.
+func (c *credentialStore) lookup(ctx context.Context, username string) (cred credential, ok bool, err error) {
+	creds, err := c.getAll(ctx)
+	if err != nil {
+		return credential{}, false, err
+	}
+
+	cred, exists := creds[username]
+	if !exists || cred.disabled {
+		return credential{}, false, nil
+	}
+
+	return cred, true, nil
+}
+
+func (c *credentialStore) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.creds = nil
+}
@@ -7,6 +7,9 @@ package server
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -14,20 +17,102 @@ import (
 type DB interface {
 	getLogger() *zap.Logger
 
-	saveMapName(ctx context.Context, name string) error
-	saveRover(ctx context.Context, mapID int, roverIndex int) error
-	insertMap(ctx context.Context, tiles []int, mapID int) error
-	retriveMap(ctx context.Context, mapID int) error
-	retriveRover(ctx context.Context, mapID int) error
+	insertMap(ctx context.Context, m savedMap) (int, error)
+	insertMapSnapshot(ctx context.Context, m savedMap, stats discoveryStats, zones []keepOutZone) (int, error)
+	insertImportedMap(ctx context.Context, m savedMap) (int, int, error)
+	getMap(ctx context.Context, mapID int) (savedMap, error)
+	getMaps(ctx context.Context) ([]savedMap, error)
+	updateMap(ctx context.Context, m savedMap) error
+	deleteMap(ctx context.Context, mapID int) error
 	getMapID(ctx context.Context, name string) (int, error)
-	getLatestMapID(ctx context.Context) (int, error)
-	storeInstruction(ctx context.Context, instruction string, value int) error
-	retriveInstruction(ctx context.Context, mapID int) error
-	resetInstructions(ctx context.Context, mapID int) error
+	insertMission(ctx context.Context, started time.Time) (int, error)
+	getMissions(ctx context.Context) ([]mission, error)
+	storeInstruction(ctx context.Context, missionID int, instruction string, value int) error
+	getInstructions(ctx context.Context, missionID int) ([]driveInstruction, error)
+	insertGroundTruth(ctx context.Context, name string, groundTruth tileMap) error
+	getGroundTruth(ctx context.Context, name string) (tileMap, error)
+	getGroundTruthNames(ctx context.Context) ([]string, error)
+	saveDiscoveryStats(ctx context.Context, mapID int, stats discoveryStats) error
+	getDiscoveryStats(ctx context.Context, mapID int) (discoveryStats, error)
+	insertTileRevisions(ctx context.Context, revisions []tileRevision) error
+	getTileRevisions(ctx context.Context, afterRevisionID int, toRevisionID int) ([]tileRevision, error)
+	getLatestResetRevisionID(ctx context.Context, revisionID int) (int, error)
+	getRevisionIDAtTime(ctx context.Context, t time.Time) (int, error)
+	getLatestRevisionID(ctx context.Context) (int, error)
+	insertTelemetry(ctx context.Context, missionID int, topic string, payload string) error
+	getTelemetry(ctx context.Context, missionID int) ([]telemetryRecord, error)
+	insertAnnotation(ctx context.Context, annotation annotation) (int, error)
+	getAnnotations(ctx context.Context) ([]annotation, error)
+	deleteAnnotation(ctx context.Context, annotationID int) error
+	getKeepOutZones(ctx context.Context, mapID int) ([]keepOutZone, error)
+	insertLiveKeepOutZone(ctx context.Context, zone keepOutZone) (int, error)
+	getLiveKeepOutZones(ctx context.Context) ([]keepOutZone, error)
+	deleteLiveKeepOutZone(ctx context.Context, zoneID int) error
+	replaceLiveKeepOutZones(ctx context.Context, zones []keepOutZone) ([]keepOutZone, error)
+	insertSession(ctx context.Context, s session) error
+	getSession(ctx context.Context, sessionID string) (session, error)
+	updateSessionRefreshToken(ctx context.Context, sessionID string, refreshTokenHash string, expires time.Time) error
+	revokeSession(ctx context.Context, sessionID string) error
+	getRevokedSessionIDs(ctx context.Context, revokedAfter time.Time) ([]string, error)
+	revokeUserSessions(ctx context.Context, username string) error
 	insertCredentials(ctx context.Context, credential credential) error
-	getCredentials(ctx context.Context) (map[string]string, error)
+	getCredentials(ctx context.Context) (map[string]credential, error)
+	updateCredentialPassword(ctx context.Context, username string, passwordHash string) error
+	updateCredentialRole(ctx context.Context, username string, userRole role) error
+	updateCredentialDisabled(ctx context.Context, username string, disabled bool) error
+	deleteCredentials(ctx context.Context, username string) error
+	insertAuditRecord(ctx context.Context, record auditRecord) error
+	getAuditRecords(ctx context.Context, filter auditFilter) ([]auditRecord, error)
 
 	migrate(ctx context.Context) error
 	TransactContext(ctx context.Context, f func(ctx context.Context, tx *sql.Tx) error) (err error)
+	ping(ctx context.Context) error
 	Close() error
 }
+
+// Schema migration commands shared by all db backends (see SQLMigrations.go)
+type SchemaMigrator interface {
+	SchemaVersion(ctx context.Context) (int, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	MigrateUp(ctx context.Context, target int) error
+	MigrateDown(ctx context.Context, target int) error
+	Close() error
+}
+
+// PostgreSQL DSNs are URLs with a postgres scheme, everything else is treated as a SQLite file
+func IsPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// Opens the db backend chosen by the DSN scheme and migrates it to the latest schema version
+func OpenDB(ctx context.Context, logger *zap.Logger, dsn string) (DB, error) {
+	if IsPostgresDSN(dsn) {
+		db, err := OpenPostgresDB(ctx, logger, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("server: db: failed to open postgres db: %w", err)
+		}
+		return db, nil
+	}
+
+	db, err := OpenSQLiteDB(ctx, logger, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("server: db: failed to open sqlite db: %w", err)
+	}
+	return db, nil
+}
+
+func OpenDBWithoutMigration(ctx context.Context, logger *zap.Logger, dsn string) (SchemaMigrator, error) {
+	if IsPostgresDSN(dsn) {
+		db, err := OpenPostgresDBWithoutMigration(ctx, logger, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("server: db: failed to open postgres db: %w", err)
+		}
+		return db, nil
+	}
+
+	db, err := OpenSQLiteDBWithoutMigration(ctx, logger, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("server: db: failed to open sqlite db: %w", err)
+	}
+	return db, nil
+}
@@ -254,6 +254,8 @@ func getTurnInstructionsFromAngle(angle int) ([]driveInstruction, error) {
 func driveTocoords(driveInstruction driveInstruction, tileWidth int) {
 
 	if driveInstruction.Instruction == "forward" {
+		discovery.distance += driveInstruction.Value
+
 		if Rover.Rotation == 0 {
 			end := Rover.X + (driveInstruction.Value / tileWidth)
 			changeTerrainX(Rover.X, Rover.Y, end)
@@ -285,7 +287,7 @@ func changeTerrainX(startX int, y int, endX int) {
 	e := endX + (y * Map.Cols)
 
 	for i := s; i <= e; i++ {
-		Map.Tiles[i] = 2
+		setTile(i, 2, causeDrive, "")
 	}
 }
 
@@ -294,7 +296,7 @@ func changeTerrainY(x int, startY int, endY int) {
 	s := x + (startY * Map.Cols)
 	e := x + (endY * Map.Cols)
 
-	for i := s; i <= e; i = i + 12 {
-		Map.Tiles[i] = 2
+	for i := s; i <= e; i = i + Map.Cols {
+		setTile(i, 2, causeDrive, "")
 	}
 }
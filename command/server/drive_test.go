@@ -543,7 +543,7 @@ func TestPathToDriveInstructions(t *testing.T) {
 	for _, test := range tests {
 		Instructions, err := pathToDriveInstructions(test.path, test.tileWidth, test.initialDirection, test.traverseMode)
 		if err != nil {
-			t.Errorf("pathToDriveInstructions returned error: %w", err)
+			t.Errorf("pathToDriveInstructions returned error: %v", err)
 		}
 		if !reflect.DeepEqual(Instructions, test.expectedInstructions) {
 			t.Errorf("Instructions not equal to expected Instructions.\nOutput Instructions: %v\nExpected Instructions: %v", Instructions, test.expectedInstructions)
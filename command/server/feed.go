@@ -0,0 +1,73 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	The feed tells operators what the server and rover are doing.
+	Messages are added to two places:
+		- feed: HTML string (newest first) that GET /feed returns and clears for the webpage
+		- feed events: numbered messages that GET /api/v1/feed returns without clearing them,
+		  so that several clients can follow the feed by asking for the events after the last one they have seen
+*/
+type feedEvent struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Older events are dropped
+const maxFeedEvents = 1000
+
+var feedEvents struct {
+	sync.Mutex
+	events []feedEvent // oldest first
+	lastID int
+}
+
+// Adds messages separated by "<br>" in the same order as feed (newest first)
+func addToFeed(text string) {
+	feed = text + feed
+
+	parts := strings.Split(text, "<br>")
+	now := time.Now().UTC()
+
+	feedEvents.Lock()
+	defer feedEvents.Unlock()
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		message := strings.TrimSpace(parts[i])
+		if message == "" {
+			continue
+		}
+		feedEvents.lastID++
+		feedEvents.events = append(feedEvents.events, feedEvent{
+			ID:      feedEvents.lastID,
+			Time:    now,
+			Message: message,
+		})
+	}
+	if len(feedEvents.events) > maxFeedEvents {
+		feedEvents.events = append([]feedEvent{}, feedEvents.events[len(feedEvents.events)-maxFeedEvents:]...)
+	}
+}
+
+// Returns up to limit events after the event with ID after (oldest first) and the ID of the latest event
+func getFeedEvents(after int, limit int) ([]feedEvent, int) {
+	feedEvents.Lock()
+	defer feedEvents.Unlock()
+
+	events := []feedEvent{}
+	for _, event := range feedEvents.events {
+		if event.ID > after {
+			events = append(events, event)
+			if len(events) == limit {
+				break
+			}
+		}
+	}
+	return events, feedEvents.lastID
+}
@@ -6,7 +6,12 @@ require (
 	github.com/eclipse/paho.mqtt.golang v1.3.4
 	github.com/go-chi/chi v1.5.4
 	github.com/go-chi/cors v1.1.1
+	github.com/lib/pq v1.10.2
 	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/prometheus/client_golang v1.11.0
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+	Unauthenticated status endpoints for load balancers and monitoring:
+		- GET /healthz: the process is alive and serving requests
+		- GET /readyz: the DB can be reached, the MQTT client is connected and subscribed and the server is not shutting down
+	Both return 200 if everything is fine and 503 otherwise, together with the result of every check.
+*/
+type healthStatus struct {
+	Status string            `json:"status"` // "ok" or "unavailable"
+	Checks map[string]string `json:"checks"` // check => "ok" or the problem
+}
+
+const healthCheckTimeout = 2 * time.Second
+
+func (h *HttpServer) getHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthStatus(w, map[string]string{
+		"server": "ok",
+	})
+}
+
+func (h *HttpServer) getReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]string{
+		"db":               "ok",
+		"mqttConnection":   "ok",
+		"mqttSubscription": "ok",
+		"server":           "ok",
+	}
+
+	// The endpoint is public, so the error (which may contain the host or DSN) is only logged
+	if err := h.db.ping(ctx); err != nil {
+		h.requestLogger(r).Warn("server: health: db ping failed", zap.Error(err))
+		checks["db"] = "unreachable"
+	}
+	if !h.mqtt.getIsConnected() {
+		checks["mqttConnection"] = "not connected to broker"
+	}
+	if !h.mqtt.getIsSubscribed() {
+		checks["mqttSubscription"] = "not subscribed to rover topics"
+	}
+	if h.isShuttingDown() {
+		checks["server"] = "shutting down"
+	}
+
+	writeHealthStatus(w, checks)
+}
+
+func writeHealthStatus(w http.ResponseWriter, checks map[string]string) {
+	health := healthStatus{
+		Status: "ok",
+		Checks: checks,
+	}
+	status := http.StatusOK
+	for _, result := range checks {
+		if result != "ok" {
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
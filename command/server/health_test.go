@@ -0,0 +1,26 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestReadyzHidesDBError(t *testing.T) {
+	server, db := newAPITestServerWithDB(t)
+	db.Close()
+
+	resp, err := http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("failed to get readyz: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var health healthStatus
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Fatalf("failed to decode health status: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || health.Checks["db"] != "unreachable" {
+		t.Errorf("readyz returned status %v and db check %q, expected status %v and db check %q", resp.StatusCode, health.Checks["db"], http.StatusServiceUnavailable, "unreachable")
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+	All output of the server goes through one zap logger (see NewLogger), library code never exits the process.
+	Log lines are correlated by:
+		- requestID: every HTTP request, taken from the X-Request-ID header if the client sent a valid one, returned in the response
+		- sequenceID: every drive instruction sequence published to the rover, carried into the publish logs
+		  and the logs of the rover's feedback to that sequence (together with the requestID of the request that started it)
+*/
+const (
+	LogFormatProduction  = "production"  // JSON
+	LogFormatDevelopment = "development" // console
+)
+
+const requestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type correlationKey int
+
+const requestIDKey correlationKey = 0
+
+func NewLogger(config LogConfig) (*zap.Logger, error) {
+	level, err := parseLogLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var zapConfig zap.Config
+	switch config.Format {
+	case LogFormatProduction:
+		zapConfig = zap.NewProductionConfig()
+	case LogFormatDevelopment:
+		zapConfig = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("server: logging: unknown log format %q (production or development)", config.Format)
+	}
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+
+	logger, err := zapConfig.Build()
+	if err != nil {
+		return nil, fmt.Errorf("server: logging: failed to build logger: %w", err)
+	}
+	return logger, nil
+}
+
+func parseLogLevel(level string) (zapcore.Level, error) {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "warn":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	return 0, fmt.Errorf("server: logging: unknown log level %q (debug, info, warn or error)", level)
+}
+
+// Random ID, falls back to the current time if no randomness is available
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// Empty if the context does not belong to an HTTP request
+func getRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+func correlationFields(requestID string, sequenceID string) []zap.Field {
+	var fields []zap.Field
+	if requestID != "" {
+		fields = append(fields, zap.String("requestID", requestID))
+	}
+	if sequenceID != "" {
+		fields = append(fields, zap.String("sequenceID", sequenceID))
+	}
+	return fields
+}
+
+// Logger of a request, includes its request ID
+func (h *HttpServer) requestLogger(r *http.Request) *zap.Logger {
+	return h.logger.With(correlationFields(getRequestID(r.Context()), "")...)
+}
+
+// Assigns a request ID to every request and logs it once it is done, must be used before all other middleware
+func (h *HttpServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newCorrelationID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		r = r.WithContext(withRequestID(r.Context(), requestID))
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		fields := []zap.Field{
+			zap.String("requestID", requestID),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", status),
+			zap.Int("bytes", ww.BytesWritten()),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("remoteAddr", r.RemoteAddr),
+		}
+		if status >= http.StatusInternalServerError {
+			h.logger.Error("http request", fields...)
+		} else {
+			h.logger.Info("http request", fields...)
+		}
+	})
+}
+
+// Correlation IDs of the drive instruction sequence that the rover is currently executing
+var currentSequence struct {
+	sync.Mutex
+	requestID  string
+	sequenceID string
+}
+
+func setCurrentSequence(requestID string, sequenceID string) {
+	currentSequence.Lock()
+	defer currentSequence.Unlock()
+
+	currentSequence.requestID = requestID
+	currentSequence.sequenceID = sequenceID
+}
+
+func currentSequenceFields() []zap.Field {
+	currentSequence.Lock()
+	defer currentSequence.Unlock()
+
+	return correlationFields(currentSequence.requestID, currentSequence.sequenceID)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogRequests(t *testing.T) {
+	type test struct {
+		requestID     string
+		keepRequestID bool
+	}
+
+	tests := []test{
+		{"", false},
+		{"3f2a-client.1", true},
+		{"contains spaces", false},
+		{"line\nbreak", false},
+	}
+
+	for _, test := range tests {
+		core, logs := observer.New(zap.InfoLevel)
+		h := &HttpServer{logger: zap.New(core)}
+
+		var handlerRequestID string
+		handler := h.logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerRequestID = getRequestID(r.Context())
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/map", nil)
+		if test.requestID != "" {
+			r.Header.Set(requestIDHeader, test.requestID)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		responseRequestID := w.Header().Get(requestIDHeader)
+		if responseRequestID == "" || responseRequestID != handlerRequestID {
+			t.Errorf("Request ID of response %q not equal to request ID of handler %q", responseRequestID, handlerRequestID)
+		}
+		if keptRequestID := responseRequestID == test.requestID; keptRequestID != test.keepRequestID {
+			t.Errorf("Request ID %q was kept: %v, expected: %v", test.requestID, keptRequestID, test.keepRequestID)
+		}
+
+		entries := logs.FilterField(zap.String("requestID", responseRequestID)).FilterField(zap.Int("status", http.StatusTeapot)).All()
+		if len(entries) != 1 {
+			t.Errorf("Request with request ID %q was logged %v times, expected once", test.requestID, len(entries))
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	type test struct {
+		config      LogConfig
+		expectError bool
+	}
+
+	tests := []test{
+		{LogConfig{Format: LogFormatProduction, Level: "info"}, false},
+		{LogConfig{Format: LogFormatDevelopment, Level: "debug"}, false},
+		{LogConfig{Format: "json", Level: "info"}, true},
+		{LogConfig{Format: LogFormatProduction, Level: "fatal"}, true},
+	}
+
+	for _, test := range tests {
+		logger, err := NewLogger(test.config)
+		if (err != nil) != test.expectError {
+			t.Errorf("NewLogger of %+v returned error %v, expected error: %v", test.config, err, test.expectError)
+			continue
+		}
+		if err == nil && logger.Core().Enabled(zap.DebugLevel) != (test.config.Level == "debug") {
+			t.Errorf("Logger of %+v has wrong level", test.config)
+		}
+	}
+}
+
+func TestInstructionFeedbackCorrelation(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenDB(ctx, zap.NewNop(), t.TempDir()+"/serverDB.db")
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	core, logs := observer.New(zap.DebugLevel)
+	mqttClient := &replayMQTT{logger: zap.New(core)}
+
+	setCurrentSequence("request-1", "sequence-1")
+	defer setCurrentSequence("", "")
+
+	// Distance correction of the rover, doesn't change the map
+	handleInstructionFeedback(mqttClient, ctx, db, "B:5")
+
+	entries := logs.FilterMessage("received instruction feedback").
+		FilterField(zap.String("requestID", "request-1")).
+		FilterField(zap.String("sequenceID", "sequence-1")).All()
+	if len(entries) != 1 {
+		t.Errorf("Instruction feedback was logged %v times with the correlation IDs of the current sequence, expected once", len(entries))
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Limits password attempts to slow down brute-force attacks.
+	Failed attempts are counted per client IP and per username (whether or not the user exists).
+	Once more than the allowed number of attempts failed, every further failure locks the IP or username out
+	for twice as long as the previous one (starting at loginBaseLockout, at most loginMaxLockout).
+	Failures are forgotten loginFailureWindow after the last one. A successful login resets the count of the username.
+	At most loginMaxTrackedKeys IPs and usernames are tracked so that spraying random usernames can't grow memory without bound.
+	When full, the IPs and usernames with the oldest failures are forgotten, preferring ones that are not locked out.
+*/
+const (
+	loginFailuresPerUsername = 5
+	loginFailuresPerIP       = 20
+	loginBaseLockout         = time.Second
+	loginMaxLockout          = 15 * time.Minute
+	loginFailureWindow       = time.Hour
+	loginMaxTrackedKeys      = 10000
+)
+
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+type loginLimiter struct {
+	mu          sync.Mutex
+	failures    map[string]*loginFailures
+	lastCleanup time.Time
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{
+		failures: make(map[string]*loginFailures),
+	}
+}
+
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+func loginUsernameKey(username string) string {
+	return "username:" + username
+}
+
+// Returns how long the client has to wait before it may try again, 0 if it may try now
+func (l *loginLimiter) retryAfter(ip string, username string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range []string{loginIPKey(ip), loginUsernameKey(username)} {
+		if f, ok := l.failures[key]; ok && f.lockedUntil.After(now) && f.lockedUntil.Sub(now) > wait {
+			wait = f.lockedUntil.Sub(now)
+		}
+	}
+	return wait
+}
+
+func (l *loginLimiter) failed(ip string, username string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanup(now)
+
+	l.fail(loginIPKey(ip), loginFailuresPerIP, now)
+	l.fail(loginUsernameKey(username), loginFailuresPerUsername, now)
+}
+
+func (l *loginLimiter) fail(key string, allowed int, now time.Time) {
+	f, ok := l.failures[key]
+	if !ok || now.Sub(f.last) > loginFailureWindow {
+		if !ok && len(l.failures) >= loginMaxTrackedKeys {
+			l.evict(now)
+		}
+		f = &loginFailures{}
+		l.failures[key] = f
+	}
+
+	f.count++
+	f.last = now
+
+	if f.count > allowed {
+		f.lockedUntil = now.Add(loginLockout(f.count - allowed))
+	}
+}
+
+func (l *loginLimiter) succeeded(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, loginUsernameKey(username))
+}
+
+// Lockout after the n-th failure over the allowed number of failures
+func loginLockout(n int) time.Duration {
+	lockout := loginBaseLockout
+	for i := 1; i < n; i++ {
+		lockout *= 2
+		if lockout >= loginMaxLockout {
+			return loginMaxLockout
+		}
+	}
+	return lockout
+}
+
+// Forgets old failures, at most once per loginFailureWindow
+func (l *loginLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < loginFailureWindow {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, f := range l.failures {
+		if now.Sub(f.last) > loginFailureWindow {
+			delete(l.failures, key)
+		}
+	}
+}
+
+/*
+	Forgets a tenth of the tracked IPs and usernames, those with the oldest failures first and locked out ones last.
+	Evicting in batches keeps the cost of a failed login constant on average while the limiter is full.
+*/
+func (l *loginLimiter) evict(now time.Time) {
+	keys := make([]string, 0, len(l.failures))
+	for key := range l.failures {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := l.failures[keys[i]], l.failures[keys[j]]
+		if aLocked, bLocked := a.lockedUntil.After(now), b.lockedUntil.After(now); aLocked != bLocked {
+			return bLocked
+		}
+		return a.last.Before(b.last)
+	})
+
+	for _, key := range keys[:len(keys)/10+1] {
+		delete(l.failures, key)
+	}
+}
+
+// IP address of the client without the port
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	type test struct {
+		n        int
+		expected time.Duration
+	}
+
+	tests := []test{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{11, loginMaxLockout},
+		{100, loginMaxLockout},
+	}
+
+	for _, test := range tests {
+		output := loginLockout(test.n)
+		if output != test.expected {
+			t.Errorf("Lockout after failure %v not equal to expected lockout.\nOutput lockout: %v\nExpected lockout: %v", test.n, output, test.expected)
+		}
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	l := newLoginLimiter()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Allowed failures of a username
+	for i := 0; i < loginFailuresPerUsername; i++ {
+		if wait := l.retryAfter("10.0.0.1", "alice", now); wait != 0 {
+			t.Fatalf("retryAfter after %v failures returned %v, expected 0", i, wait)
+		}
+		l.failed("10.0.0.1", "alice", now)
+	}
+
+	// Locked out, from any IP
+	l.failed("10.0.0.1", "alice", now)
+	if wait := l.retryAfter("10.0.0.2", "alice", now); wait != loginBaseLockout {
+		t.Errorf("retryAfter of locked out username returned %v, expected %v", wait, loginBaseLockout)
+	}
+	l.failed("10.0.0.2", "alice", now)
+	if wait := l.retryAfter("10.0.0.2", "alice", now); wait != 2*loginBaseLockout {
+		t.Errorf("retryAfter after another failure returned %v, expected %v", wait, 2*loginBaseLockout)
+	}
+
+	// Other users are not affected
+	if wait := l.retryAfter("10.0.0.2", "bob", now); wait != 0 {
+		t.Errorf("retryAfter of other username returned %v, expected 0", wait)
+	}
+
+	// Lockout ends
+	if wait := l.retryAfter("10.0.0.2", "alice", now.Add(2*loginBaseLockout)); wait != 0 {
+		t.Errorf("retryAfter after lockout returned %v, expected 0", wait)
+	}
+
+	// Success resets the username
+	l.succeeded("alice")
+	l.failed("10.0.0.2", "alice", now)
+	if wait := l.retryAfter("10.0.0.3", "alice", now); wait != 0 {
+		t.Errorf("retryAfter after successful login returned %v, expected 0", wait)
+	}
+
+	// Too many failures from one IP lock out the IP for every username
+	for i := 0; i <= loginFailuresPerIP; i++ {
+		l.failed("10.0.0.4", "user"+string(rune('a'+i)), now)
+	}
+	if wait := l.retryAfter("10.0.0.4", "carol", now); wait != loginBaseLockout {
+		t.Errorf("retryAfter of locked out IP returned %v, expected %v", wait, loginBaseLockout)
+	}
+
+	// Failures are forgotten after the window
+	later := now.Add(loginFailureWindow + time.Minute)
+	l.failed("10.0.0.4", "alice", later)
+	if wait := l.retryAfter("10.0.0.4", "alice", later); wait != 0 {
+		t.Errorf("retryAfter after failure window returned %v, expected 0", wait)
+	}
+}
+
+func TestLoginLimiterTrackedKeys(t *testing.T) {
+	l := newLoginLimiter()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i <= loginFailuresPerUsername; i++ {
+		l.failed("10.0.0.1", "alice", now)
+	}
+
+	// Spraying random usernames from many IPs must not grow the limiter beyond its bound or forget lockouts
+	for i := 0; i < loginMaxTrackedKeys; i++ {
+		l.failed(fmt.Sprintf("10.1.%v.%v", i/256, i%256), fmt.Sprintf("user%v", i), now)
+	}
+	if len(l.failures) > loginMaxTrackedKeys {
+		t.Errorf("Limiter tracks %v keys, expected at most %v", len(l.failures), loginMaxTrackedKeys)
+	}
+	if wait := l.retryAfter("10.0.0.2", "alice", now); wait != loginBaseLockout {
+		t.Errorf("retryAfter of locked out username returned %v, expected %v", wait, loginBaseLockout)
+	}
+}
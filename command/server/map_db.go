@@ -4,10 +4,6 @@
 
 package server
 
-import (
-	"context"
-)
-
 var dbMap = mapDB{
 	Rows: 12,
 	Cols: 12,
@@ -27,9 +23,3 @@ var dbMap = mapDB{
 	RoverIndx:     65,
 	RoverRotation: 0,
 }
-
-func (h *HttpServer) convertAndInsert(ctx context.Context, mapID int) {
-
-	h.db.insertMap(ctx, Map.Tiles, mapID)
-
-}
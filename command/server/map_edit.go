@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Tile that must never be entered (treated as an obstruction by the planner)
+const tileMapNoGoVal = 11
+
+// Tile of the rover in exported maps, the live map tracks the rover separately (see Rover)
+const tileMapRoverVal = 4
+
+// Inclusive rectangle of tiles on the map
+type tileRectangle struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+}
+
+type tileEdit struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Value int `json:"value"`
+}
+
+type rectangleEdit struct {
+	tileRectangle
+	Value int `json:"value"`
+}
+
+type annotation struct {
+	AnnotationID int       `json:"annotationID"`
+	X            int       `json:"x"`
+	Y            int       `json:"y"`
+	Text         string    `json:"text"`
+	Author       string    `json:"author"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+func validateTileCoordinates(x int, y int, tileMap tileMap) error {
+	if x < 0 || x >= tileMap.Cols || y < 0 || y >= tileMap.Rows {
+		return fmt.Errorf("server: map_edit: tile (%v, %v) is outside of the %vx%v map", x, y, tileMap.Cols, tileMap.Rows)
+	}
+	return nil
+}
+
+func validateRectangle(rectangle tileRectangle, tileMap tileMap) error {
+	if rectangle.Left > rectangle.Right || rectangle.Top > rectangle.Bottom {
+		return errors.New("server: map_edit: rectangle left/top must not be greater than right/bottom")
+	}
+	if err := validateTileCoordinates(rectangle.Left, rectangle.Top, tileMap); err != nil {
+		return err
+	}
+	return validateTileCoordinates(rectangle.Right, rectangle.Bottom, tileMap)
+}
+
+// Tile values that can be set manually, the rover can only be moved by driving
+func isEditableTileValue(value int) bool {
+	return value != tileMapRoverVal && isValidTileValue(value)
+}
+
+// The rover tile can only be marked as unknown or empty as the rover is standing on it
+func validateTileEdit(x int, y int, value int, tileMap tileMap) error {
+	if err := validateTileCoordinates(x, y, tileMap); err != nil {
+		return err
+	}
+	if !isEditableTileValue(value) {
+		return fmt.Errorf("server: map_edit: invalid tile value %v", value)
+	}
+	if x == Rover.X && y == Rover.Y && value > 2 {
+		return errors.New("server: map_edit: rover tile can only be set to unknown or empty")
+	}
+	return nil
+}
+
+// Validates the whole rectangle before applying any changes
+func editRectangle(rectangle tileRectangle, value int, author string) error {
+	if err := validateRectangle(rectangle, Map); err != nil {
+		return err
+	}
+	for y := rectangle.Top; y <= rectangle.Bottom; y++ {
+		for x := rectangle.Left; x <= rectangle.Right; x++ {
+			if err := validateTileEdit(x, y, value, Map); err != nil {
+				return err
+			}
+		}
+	}
+
+	for y := rectangle.Top; y <= rectangle.Bottom; y++ {
+		for x := rectangle.Left; x <= rectangle.Right; x++ {
+			setTile(x+(y*Map.Cols), value, causeManual, author)
+		}
+	}
+
+	return nil
+}
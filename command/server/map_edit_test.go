@@ -0,0 +1,60 @@
+package server
+
+import "testing"
+
+func TestValidateRectangle(t *testing.T) {
+	type test struct {
+		rectangle   tileRectangle
+		expectError bool
+	}
+
+	tileMap := tileMap{4, 5, defaultTiles(4, 5)}
+
+	tests := []test{
+		{tileRectangle{Left: 0, Top: 0, Right: 4, Bottom: 3}, false},
+		{tileRectangle{Left: 2, Top: 1, Right: 2, Bottom: 1}, false},
+		{tileRectangle{Left: 3, Top: 0, Right: 2, Bottom: 1}, true},
+		{tileRectangle{Left: 0, Top: 2, Right: 1, Bottom: 1}, true},
+		{tileRectangle{Left: -1, Top: 0, Right: 1, Bottom: 1}, true},
+		{tileRectangle{Left: 0, Top: 0, Right: 5, Bottom: 1}, true},
+		{tileRectangle{Left: 0, Top: 0, Right: 1, Bottom: 4}, true},
+	}
+
+	for _, test := range tests {
+		err := validateRectangle(test.rectangle, tileMap)
+		if (err != nil) != test.expectError {
+			t.Errorf("validateRectangle(%+v) returned error %v, expected error: %v", test.rectangle, err, test.expectError)
+		}
+	}
+}
+
+func TestValidateTileEdit(t *testing.T) {
+	type test struct {
+		x, y        int
+		value       int
+		expectError bool
+	}
+
+	tileMap := tileMap{12, 12, defaultTiles(12, 12)}
+	roverX, roverY := Rover.X, Rover.Y
+	otherX, otherY := (roverX+1)%tileMap.Cols, roverY
+
+	tests := []test{
+		{otherX, otherY, 2, false},
+		{otherX, otherY, 5, false},
+		{otherX, otherY, tileMapNoGoVal, false},
+		{otherX, otherY, tileMapRoverVal, true},
+		{otherX, otherY, 12, true},
+		{roverX, roverY, 2, false},
+		{roverX, roverY, 5, true},
+		{roverX, roverY, tileMapRoverVal, true},
+		{-1, 0, 2, true},
+	}
+
+	for _, test := range tests {
+		err := validateTileEdit(test.x, test.y, test.value, tileMap)
+		if (err != nil) != test.expectError {
+			t.Errorf("validateTileEdit(%v, %v, %v) returned error %v, expected error: %v", test.x, test.y, test.value, err, test.expectError)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package server
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+	Supported map exchange formats:
+	1.) json: {"rows": r, "cols": c, "layout": [...]} (same as the /map/getMap response)
+	2.) csv: one line per map row, tile values separated by commas
+	3.) png: one coloured square per tile followed by a colour legend
+	4.) ros: zip archive containing a ROS map_server occupancy grid (map.pgm + map.yaml)
+
+	The ros format only distinguishes between unknown, free and occupied tiles.
+	Ball colours are therefore lost when exporting to it.
+*/
+const (
+	mapFormatJSON = "json"
+	mapFormatCSV  = "csv"
+	mapFormatPNG  = "png"
+	mapFormatROS  = "ros"
+)
+
+type tileLegendEntry struct {
+	value  int
+	name   string
+	colour color.RGBA
+}
+
+// Colours roughly match the tile atlas used by the webpage
+var tileLegend = []tileLegendEntry{
+	{1, "Unknown", color.RGBA{40, 40, 40, 255}},
+	{2, "Empty", color.RGBA{222, 184, 135, 255}},
+	{3, "Border", color.RGBA{105, 105, 105, 255}},
+	{4, "Rover", color.RGBA{255, 255, 255, 255}},
+	{5, "Unknown obstruction", color.RGBA{0, 0, 0, 255}},
+	{6, "Blue ball", color.RGBA{0, 0, 255, 255}},
+	{7, "Red ball", color.RGBA{255, 0, 0, 255}},
+	{8, "Yellow ball", color.RGBA{255, 255, 0, 255}},
+	{9, "Teal ball", color.RGBA{0, 128, 128, 255}},
+	{10, "Violet ball", color.RGBA{148, 0, 211, 255}},
+	{11, "No-go zone", color.RGBA{255, 140, 0, 255}},
+}
+
+// Side length of a tile and height of a legend row in the png format (pixels)
+const mapPNGTileSize = 16
+const mapPNGLegendRowHeight = 16
+
+/*
+	Limits of decoded maps, checked before anything is allocated as the headers of uploaded files are untrusted.
+	A png may contain at most maxMapPNGPixels pixels (64 MB decoded), e.g. a 250x250 map.
+*/
+const (
+	maxMapPNGPixels    = 1 << 24
+	maxROSMetadataSize = 64 << 10
+	maxROSImageSize    = 8 << 20
+)
+
+// ROS map_server conventions (see http://wiki.ros.org/map_server)
+const (
+	rosOccupiedPixel     = 0
+	rosUnknownPixel      = 205
+	rosFreePixel         = 254
+	rosOccupiedThreshold = 0.65
+	rosFreeThreshold     = 0.196
+	rosImageFileName     = "map.pgm"
+	rosMetadataFileName  = "map.yaml"
+)
+
+type rosMetadata struct {
+	Image          string    `yaml:"image"`
+	Resolution     float64   `yaml:"resolution"` // metres per pixel
+	Origin         []float64 `yaml:"origin"`
+	Negate         int       `yaml:"negate"`
+	OccupiedThresh float64   `yaml:"occupied_thresh"`
+	FreeThresh     float64   `yaml:"free_thresh"`
+}
+
+// Returns the encoded map together with its content type and file extension
+func encodeMap(tileMap tileMap, format string) ([]byte, string, string, error) {
+	if len(tileMap.Tiles) != tileMap.Rows*tileMap.Cols {
+		return nil, "", "", errors.New("server: map_formats: number of tiles does not match map dimensions")
+	}
+
+	switch format {
+	case mapFormatJSON:
+		data, err := json.Marshal(tileMap)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("server: map_formats: failed to encode json map: %w", err)
+		}
+		return data, "application/json; charset=UTF-8", "json", nil
+	case mapFormatCSV:
+		data, err := encodeMapCSV(tileMap)
+		return data, "text/csv; charset=UTF-8", "csv", err
+	case mapFormatPNG:
+		data, err := encodeMapPNG(tileMap)
+		return data, "image/png", "png", err
+	case mapFormatROS:
+		data, err := encodeMapROS(tileMap)
+		return data, "application/zip", "zip", err
+	}
+
+	return nil, "", "", fmt.Errorf("server: map_formats: unknown map format: %v", format)
+}
+
+/*
+	Decodes a map in the given format.
+	rows and cols are only used by formats that do not store the map dimensions (png).
+*/
+func decodeMap(data []byte, format string, rows int, cols int) (tileMap, error) {
+	var decoded tileMap
+	var err error
+
+	if format == mapFormatPNG && (rows <= 0 || cols <= 0 || rows > maxMapSize || cols > maxMapSize) {
+		return tileMap{}, fmt.Errorf("server: map_formats: map must have between 1 and %v rows and cols", maxMapSize)
+	}
+
+	switch format {
+	case mapFormatJSON:
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return tileMap{}, fmt.Errorf("server: map_formats: failed to decode json map: %w", err)
+		}
+	case mapFormatCSV:
+		decoded, err = decodeMapCSV(data)
+	case mapFormatPNG:
+		decoded, err = decodeMapPNG(data, rows, cols)
+	case mapFormatROS:
+		decoded, err = decodeMapROS(data)
+	default:
+		return tileMap{}, fmt.Errorf("server: map_formats: unknown map format: %v", format)
+	}
+	if err != nil {
+		return tileMap{}, err
+	}
+
+	if decoded.Rows <= 0 || decoded.Cols <= 0 || decoded.Rows > maxMapSize || decoded.Cols > maxMapSize || len(decoded.Tiles) != decoded.Rows*decoded.Cols {
+		return tileMap{}, errors.New("server: map_formats: decoded map has invalid dimensions")
+	}
+	for _, tile := range decoded.Tiles {
+		if !isValidTileValue(tile) {
+			return tileMap{}, fmt.Errorf("server: map_formats: decoded map contains invalid tile value %v", tile)
+		}
+	}
+
+	return decoded, nil
+}
+
+func isValidTileValue(value int) bool {
+	for _, entry := range tileLegend {
+		if entry.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeMapCSV(tileMap tileMap) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	for row := 0; row < tileMap.Rows; row++ {
+		record := make([]string, tileMap.Cols)
+		for col := 0; col < tileMap.Cols; col++ {
+			record[col] = strconv.Itoa(tileMap.getTile(row, col))
+		}
+		if err := w.Write(record); err != nil {
+			return nil, fmt.Errorf("server: map_formats: failed to write csv row: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("server: map_formats: failed to flush csv: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeMapCSV(data []byte) (tileMap, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return tileMap{}, fmt.Errorf("server: map_formats: failed to read csv: %w", err)
+	}
+	if len(records) == 0 {
+		return tileMap{}, errors.New("server: map_formats: csv map is empty")
+	}
+
+	decoded := tileMap{
+		Rows: len(records),
+		Cols: len(records[0]),
+	}
+	for _, record := range records {
+		for _, field := range record {
+			value, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return tileMap{}, fmt.Errorf("server: map_formats: invalid csv tile value: %w", err)
+			}
+			decoded.Tiles = append(decoded.Tiles, value)
+		}
+	}
+
+	return decoded, nil
+}
+
+func encodeMapPNG(tileMap tileMap) ([]byte, error) {
+	face := basicfont.Face7x13
+
+	// Legend is drawn below the map with one row per tile value
+	legendWidth := 0
+	for _, entry := range tileLegend {
+		if width := mapPNGLegendRowHeight + 4 + font.MeasureString(face, entry.name).Ceil(); width > legendWidth {
+			legendWidth = width
+		}
+	}
+
+	mapWidth := tileMap.Cols * mapPNGTileSize
+	mapHeight := tileMap.Rows * mapPNGTileSize
+	width := mapWidth
+	if legendWidth > width {
+		width = legendWidth
+	}
+	height := mapHeight + len(tileLegend)*mapPNGLegendRowHeight
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	for row := 0; row < tileMap.Rows; row++ {
+		for col := 0; col < tileMap.Cols; col++ {
+			colour, err := tileValueToColour(tileMap.getTile(row, col))
+			if err != nil {
+				return nil, err
+			}
+			tile := image.Rect(col*mapPNGTileSize, row*mapPNGTileSize, (col+1)*mapPNGTileSize, (row+1)*mapPNGTileSize)
+			draw.Draw(img, tile, &image.Uniform{colour}, image.Point{}, draw.Src)
+		}
+	}
+
+	drawer := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+	}
+	for i, entry := range tileLegend {
+		top := mapHeight + i*mapPNGLegendRowHeight
+		swatch := image.Rect(1, top+1, mapPNGLegendRowHeight-1, top+mapPNGLegendRowHeight-1)
+		draw.Draw(img, swatch, &image.Uniform{entry.colour}, image.Point{}, draw.Src)
+
+		drawer.Dot = fixed.P(mapPNGLegendRowHeight+4, top+mapPNGLegendRowHeight-3)
+		drawer.DrawString(entry.name)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("server: map_formats: failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// The map is read from the top left corner of the image by sampling the centre of each tile
+func decodeMapPNG(data []byte, rows int, cols int) (tileMap, error) {
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return tileMap{}, fmt.Errorf("server: map_formats: failed to decode png header: %w", err)
+	}
+	if config.Width*config.Height > maxMapPNGPixels {
+		return tileMap{}, fmt.Errorf("server: map_formats: png with %vx%v pixels is too large", config.Width, config.Height)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return tileMap{}, fmt.Errorf("server: map_formats: failed to decode png: %w", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() < cols*mapPNGTileSize || bounds.Dy() < rows*mapPNGTileSize {
+		return tileMap{}, fmt.Errorf("server: map_formats: png is too small for a %vx%v map", rows, cols)
+	}
+
+	decoded := tileMap{
+		Rows: rows,
+		Cols: cols,
+	}
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			x := bounds.Min.X + col*mapPNGTileSize + mapPNGTileSize/2
+			y := bounds.Min.Y + row*mapPNGTileSize + mapPNGTileSize/2
+
+			value, err := colourToTileValue(img.At(x, y))
+			if err != nil {
+				return tileMap{}, fmt.Errorf("server: map_formats: tile at row %v col %v: %w", row, col, err)
+			}
+			decoded.Tiles = append(decoded.Tiles, value)
+		}
+	}
+
+	return decoded, nil
+}
+
+func tileValueToColour(value int) (color.RGBA, error) {
+	for _, entry := range tileLegend {
+		if entry.value == value {
+			return entry.colour, nil
+		}
+	}
+	return color.RGBA{}, fmt.Errorf("server: map_formats: no colour for tile value %v", value)
+}
+
+func colourToTileValue(c color.Color) (int, error) {
+	r, g, b, _ := c.RGBA()
+	for _, entry := range tileLegend {
+		er, eg, eb, _ := entry.colour.RGBA()
+		if r == er && g == eg && b == eb {
+			return entry.value, nil
+		}
+	}
+	return 0, errors.New("colour does not match any legend entry")
+}
+
+func encodeMapROS(tileMap tileMap) ([]byte, error) {
+	// Binary PGM (P5): header followed by one byte per pixel
+	var pgm bytes.Buffer
+	fmt.Fprintf(&pgm, "P5\n%d %d\n255\n", tileMap.Cols, tileMap.Rows)
+	for _, tile := range tileMap.Tiles {
+		pgm.WriteByte(tileValueToROSPixel(tile))
+	}
+
+	metadata, err := yaml.Marshal(rosMetadata{
+		Image:          rosImageFileName,
+		Resolution:     float64(tileWidth) / 100,
+		Origin:         []float64{0, 0, 0},
+		Negate:         0,
+		OccupiedThresh: rosOccupiedThreshold,
+		FreeThresh:     rosFreeThreshold,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("server: map_formats: failed to encode ros metadata: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		content []byte
+	}{
+		{rosMetadataFileName, metadata},
+		{rosImageFileName, pgm.Bytes()},
+	} {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("server: map_formats: failed to create %v in zip: %w", file.name, err)
+		}
+		if _, err := f.Write(file.content); err != nil {
+			return nil, fmt.Errorf("server: map_formats: failed to write %v to zip: %w", file.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("server: map_formats: failed to close zip: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeMapROS(data []byte) (tileMap, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return tileMap{}, fmt.Errorf("server: map_formats: failed to open ros zip: %w", err)
+	}
+
+	metadataBytes, err := readZipFile(zr, rosMetadataFileName, maxROSMetadataSize)
+	if err != nil {
+		return tileMap{}, err
+	}
+	var metadata rosMetadata
+	if err := yaml.Unmarshal(metadataBytes, &metadata); err != nil {
+		return tileMap{}, fmt.Errorf("server: map_formats: failed to decode ros metadata: %w", err)
+	}
+
+	pgmBytes, err := readZipFile(zr, metadata.Image, maxROSImageSize)
+	if err != nil {
+		return tileMap{}, err
+	}
+	width, height, maxVal, pixels, err := decodePGM(pgmBytes)
+	if err != nil {
+		return tileMap{}, err
+	}
+
+	decoded := tileMap{
+		Rows: height,
+		Cols: width,
+	}
+	for _, pixel := range pixels {
+		// Probability of a tile being occupied (see map_server documentation)
+		p := float64(maxVal-pixel) / float64(maxVal)
+		if metadata.Negate != 0 {
+			p = float64(pixel) / float64(maxVal)
+		}
+
+		if p > metadata.OccupiedThresh {
+			decoded.Tiles = append(decoded.Tiles, 5)
+		} else if p < metadata.FreeThresh {
+			decoded.Tiles = append(decoded.Tiles, 2)
+		} else {
+			decoded.Tiles = append(decoded.Tiles, tileMapUnknownVal)
+		}
+	}
+
+	return decoded, nil
+}
+
+// Reads a single file of the zip, the sizes in the zip headers are not trusted
+func readZipFile(zr *zip.Reader, name string, limit int64) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("server: map_formats: failed to open %v in zip: %w", name, err)
+		}
+		defer rc.Close()
+
+		content, err := ioutil.ReadAll(io.LimitReader(rc, limit+1))
+		if err != nil {
+			return nil, fmt.Errorf("server: map_formats: failed to read %v in zip: %w", name, err)
+		}
+		if int64(len(content)) > limit {
+			return nil, fmt.Errorf("server: map_formats: %v in zip is larger than %v bytes", name, limit)
+		}
+		return content, nil
+	}
+
+	return nil, fmt.Errorf("server: map_formats: ros zip does not contain %v", name)
+}
+
+func tileValueToROSPixel(value int) byte {
+	if value == tileMapUnknownVal {
+		return rosUnknownPixel
+	} else if value == 2 {
+		return rosFreePixel
+	}
+	return rosOccupiedPixel
+}
+
+// Supports both binary (P5) and plain (P2) PGM files with a max value below 256
+func decodePGM(data []byte) (int, int, int, []int, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	header := make([]int, 0, 3)
+	magic, err := readPGMToken(r)
+	if err != nil {
+		return 0, 0, 0, nil, fmt.Errorf("server: map_formats: failed to read pgm magic number: %w", err)
+	}
+	if magic != "P5" && magic != "P2" {
+		return 0, 0, 0, nil, fmt.Errorf("server: map_formats: unsupported pgm type %v", magic)
+	}
+	for len(header) < 3 {
+		token, err := readPGMToken(r)
+		if err != nil {
+			return 0, 0, 0, nil, fmt.Errorf("server: map_formats: failed to read pgm header: %w", err)
+		}
+		value, err := strconv.Atoi(token)
+		if err != nil {
+			return 0, 0, 0, nil, fmt.Errorf("server: map_formats: invalid pgm header value: %w", err)
+		}
+		header = append(header, value)
+	}
+	width, height, maxVal := header[0], header[1], header[2]
+	if width <= 0 || height <= 0 || width > maxMapSize || height > maxMapSize || maxVal <= 0 || maxVal > 255 {
+		return 0, 0, 0, nil, errors.New("server: map_formats: unsupported pgm dimensions or max value")
+	}
+
+	pixels := make([]int, width*height)
+	if magic == "P5" {
+		raw := make([]byte, len(pixels))
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return 0, 0, 0, nil, fmt.Errorf("server: map_formats: failed to read pgm pixels: %w", err)
+		}
+		for i, b := range raw {
+			pixels[i] = int(b)
+		}
+	} else {
+		for i := range pixels {
+			token, err := readPGMToken(r)
+			if err != nil {
+				return 0, 0, 0, nil, fmt.Errorf("server: map_formats: failed to read pgm pixels: %w", err)
+			}
+			if pixels[i], err = strconv.Atoi(token); err != nil {
+				return 0, 0, 0, nil, fmt.Errorf("server: map_formats: invalid pgm pixel: %w", err)
+			}
+		}
+	}
+	for _, pixel := range pixels {
+		if pixel < 0 || pixel > maxVal {
+			return 0, 0, 0, nil, fmt.Errorf("server: map_formats: pgm pixel %v is not between 0 and the max value %v", pixel, maxVal)
+		}
+	}
+
+	return width, height, maxVal, pixels, nil
+}
+
+// Reads a whitespace separated token while skipping comments. Consumes exactly one whitespace character after the token.
+func readPGMToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+
+		if b == '#' && len(token) == 0 {
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
+			if len(token) > 0 {
+				return string(token), nil
+			}
+			continue
+		}
+
+		token = append(token, b)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeMap(t *testing.T) {
+	type test struct {
+		format      string
+		tileMap     tileMap
+		expectedMap tileMap
+	}
+
+	fullMap := tileMap{3, 4, []int{
+		3, 3, 3, 3,
+		3, 1, 2, 5,
+		6, 7, 8, 9,
+	}}
+
+	tests := []test{
+		{mapFormatJSON, fullMap, fullMap},
+		{mapFormatCSV, fullMap, fullMap},
+		{mapFormatPNG, fullMap, fullMap},
+		// ros only knows unknown, free and occupied tiles
+		{mapFormatROS, fullMap, tileMap{3, 4, []int{
+			5, 5, 5, 5,
+			5, 1, 2, 5,
+			5, 5, 5, 5,
+		}}},
+	}
+
+	for _, test := range tests {
+		data, _, _, err := encodeMap(test.tileMap, test.format)
+		if err != nil {
+			t.Errorf("encodeMap returned error for format %v: %v", test.format, err)
+			continue
+		}
+
+		decodedMap, err := decodeMap(data, test.format, test.tileMap.Rows, test.tileMap.Cols)
+		if err != nil {
+			t.Errorf("decodeMap returned error for format %v: %v", test.format, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(decodedMap, test.expectedMap) {
+			t.Errorf("Decoded map not equal to expected map for format %v.\nOutput map: %v\nExpected map: %v", test.format, decodedMap, test.expectedMap)
+		}
+	}
+}
+
+func TestDecodeMapRejectsInvalidInput(t *testing.T) {
+	type test struct {
+		format string
+		data   string
+	}
+
+	tests := []test{
+		{mapFormatCSV, "1,2\n3"},
+		{mapFormatCSV, "1,2\n3,42"},
+		{mapFormatJSON, `{"rows": 2, "cols": 2, "layout": [1, 2, 3]}`},
+		{mapFormatROS, string(rosZip(t, map[string]string{
+			rosMetadataFileName: "image: map.pgm\noccupied_thresh: 0.65\nfree_thresh: 0.196\n",
+			rosImageFileName:    "P2\n2 2\n100\n0 100\n50 200\n",
+		}))},
+		{"bmp", ""},
+	}
+
+	for _, test := range tests {
+		if _, err := decodeMap([]byte(test.data), test.format, 2, 2); err == nil {
+			t.Errorf("decodeMap did not return error for format %v and data %q", test.format, test.data)
+		}
+	}
+}
+
+// Headers of uploaded maps must not be able to force large allocations
+func TestDecodeMapRejectsOversizedInput(t *testing.T) {
+	type test struct {
+		name   string
+		format string
+		data   []byte
+	}
+
+	tests := []test{
+		{"pgm larger than maxMapSize", mapFormatROS, rosZip(t, map[string]string{
+			rosMetadataFileName: "image: map.pgm\noccupied_thresh: 0.65\nfree_thresh: 0.196\n",
+			rosImageFileName:    "P5\n100000 100000\n255\n",
+		})},
+		{"metadata larger than limit", mapFormatROS, rosZip(t, map[string]string{
+			rosMetadataFileName: "image: map.pgm\n" + strings.Repeat(" ", maxROSMetadataSize),
+			rosImageFileName:    "P2\n1 1\n255\n0\n",
+		})},
+		{"png with too many pixels", mapFormatPNG, pngHeader(1<<13, 1<<13)},
+		{"csv wider than maxMapSize", mapFormatCSV, []byte(strings.Repeat("1,", maxMapSize) + "1\n")},
+	}
+
+	for _, test := range tests {
+		if _, err := decodeMap(test.data, test.format, 2, 2); err == nil {
+			t.Errorf("decodeMap did not return error for %v", test.name)
+		}
+	}
+}
+
+func rosZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %v in zip: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// PNG signature and IHDR chunk of a grayscale image without any pixel data
+func pngHeader(width uint32, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // bit depth
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(ihdr))
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = append(data, 0, 0, 0, 13)
+	data = append(data, ihdr...)
+	return append(data, crc...)
+}
+
+func TestDecodePGM(t *testing.T) {
+	data := []byte("P2\n# plain pgm\n3 2\n255\n0 205 254\n254 254 0\n")
+
+	width, height, maxVal, pixels, err := decodePGM(data)
+	if err != nil {
+		t.Fatalf("decodePGM returned error: %v", err)
+	}
+
+	if width != 3 || height != 2 || maxVal != 255 {
+		t.Errorf("Header not equal to expected header.\nOutput header: %v %v %v\nExpected header: 3 2 255", width, height, maxVal)
+	}
+
+	expectedPixels := []int{0, 205, 254, 254, 254, 0}
+	if !reflect.DeepEqual(pixels, expectedPixels) {
+		t.Errorf("Pixels not equal to expected pixels.\nOutput pixels: %v\nExpected pixels: %v", pixels, expectedPixels)
+	}
+}
@@ -9,12 +9,18 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// Height/width of a tile in cm
 var tileWidth = 30
 
+// Set from the config when the server is opened
+var autonomySettings = DefaultConfig().Autonomy
+
 // Initilising starting map: unknown (1) with boarders (3)
 
 var Map = tileMap{
@@ -43,6 +49,26 @@ var Rover = rover{
 	Rotation: 0, // angle (x-axis = 0°)
 }
 
+// Resizes the map to the configured dimensions (clearing it) and moves the rover to its start
+func applyMapConfig(config MapConfig) {
+	Map.Rows = config.Rows
+	Map.Cols = config.Cols
+	Map.Tiles = defaultTiles(Map.Rows, Map.Cols)
+	tileWidth = config.TileWidth
+
+	resetRover()
+}
+
+func resetRover() {
+	Rover.X, Rover.Y = roverStart(Map.Rows, Map.Cols)
+	Rover.Rotation = 0
+}
+
+// Center of the map (column, row)
+func roverStart(rows int, cols int) (int, int) {
+	return (cols - 1) / 2, (rows - 1) / 2
+}
+
 // Used for case when having to recompute path due to obstruction avoidance
 var previousDestinationRow int
 var previousDestinationCol int
@@ -70,11 +96,17 @@ var currentEnergy = energy{
 	ErrorInCells:  0,
 }
 
-func mapAndDrive(mqtt MQTT, destinationCol int, destinationRow int, mode int) error {
-	mqtt.getLogger().Info("starting map and drive", zap.Int("startRow", Rover.Y), zap.Int("startCol", Rover.X), zap.Int("destinationRow", destinationRow), zap.Int("destinationCol", destinationCol))
+func mapAndDrive(ctx context.Context, mqtt MQTT, destinationCol int, destinationRow int, mode int) error {
+	mqtt.getLogger().Info("starting map and drive", append(correlationFields(getRequestID(ctx), ""), zap.Int("startRow", Rover.Y), zap.Int("startCol", Rover.X), zap.Int("destinationRow", destinationRow), zap.Int("destinationCol", destinationCol))...)
+
+	if isInKeepOutZone(destinationCol, destinationRow, keepOutZones) {
+		return errors.New("server: map_general: mapAndDrive: destination is inside a keep-out zone")
+	}
 
-	// Getting optimum path
-	path, err := getShortedPathFromStartToDestination(Rover.Y, Rover.X, destinationRow, destinationCol, Map)
+	// Getting optimum path (keep-out zones are treated as obstructions)
+	plannerStart := time.Now()
+	path, err := getShortedPathFromStartToDestination(Rover.Y, Rover.X, destinationRow, destinationCol, applyKeepOutZones(Map, keepOutZones, Rover))
+	serverMetrics.observePlanner(time.Since(plannerStart))
 	if err != nil {
 		return fmt.Errorf("server: map_general: mapAndDrive: failed to create path from start to destination: %w", err)
 	}
@@ -94,20 +126,71 @@ func mapAndDrive(mqtt MQTT, destinationCol int, destinationRow int, mode int) er
 		return fmt.Errorf("server: map_general: mapAndDrive: failed to create drive instructions: %w", err)
 	}
 
-	mqtt.publishDriveInstructionSequence(driveInstructions)
+	mqtt.publishDriveInstructionSequence(ctx, driveInstructions)
 
-	feed = "<br> <br> Drive instructions sent to rover <br> <br> Optimum path converted to drive instructions <br> <br> Targets converted to optimum path <br> <br> Targets recived by server " + feed
+	addToFeed("<br> <br> Drive instructions sent to rover <br> <br> Optimum path converted to drive instructions <br> <br> Targets converted to optimum path <br> <br> Targets recived by server ")
 
 	return nil
 }
 
-func autonomousDrive(mqtt MQTT) {
-	available, x, y := getBestNextDestinationCoordinates(Map)
-	allFound := checkBalls()
+func autonomousDrive(ctx context.Context, mqtt MQTT) {
+	available, x, y := getBestNextDestinationCoordinates(applyKeepOutZones(Map, keepOutZones, Rover))
+	allFound := autonomySettings.StopWhenAllBallsFound && checkBalls()
 	if available == false && stopAutonomous == false && allFound == false {
-		mapAndDrive(mqtt, x, y, 1)
+		mapAndDrive(ctx, mqtt, x, y, autonomySettings.TraverseMode)
+	}
+
+}
+
+// Drives forward by distance (cm) unless that would enter a keep-out zone
+func driveForward(ctx context.Context, mqtt MQTT, distance int) error {
+	if err := checkForwardDriveAgainstKeepOutZones(Rover, distance, tileWidth, keepOutZones); err != nil {
+		return err
 	}
 
+	mqtt.publishDriveInstructionSequence(ctx, driveInstructions{{
+		Instruction: "forward",
+		Value:       distance,
+	}})
+	return nil
+}
+
+// Turns by angle (degrees) in steps of 90 degrees, positive angles turn right
+func turn(ctx context.Context, mqtt MQTT, angle int) {
+	instruction := "turnRight"
+	if angle < 0 {
+		instruction = "turnLeft"
+	}
+
+	var instructions driveInstructions
+	for i := 0; i < Abs(angle)/90; i++ {
+		instructions = append(instructions, driveInstruction{
+			Instruction: instruction,
+			Value:       90,
+		})
+	}
+	mqtt.publishDriveInstructionSequence(ctx, instructions)
+}
+
+// Drives to the target, the target is driven to again after the rover stopped for an obstruction
+func driveToTarget(ctx context.Context, mqtt MQTT, target coordinates) error {
+	previousDestinationRow = target.X
+	previousDestinationCol = target.Y
+	previousDestinationMode = target.Mode
+
+	return mapAndDrive(ctx, mqtt, target.X, target.Y, target.Mode)
+}
+
+func startAutonomousMode(ctx context.Context, mqtt MQTT) {
+	addToFeed("<br> <br> Rover is in autonomous mode, exploring the area")
+	stopAutonomous = false
+	autonomousDrive(ctx, mqtt)
+}
+
+// The rover finishes its current drive instructions
+func stopAutonomousMode() {
+	stopAutonomous = true
+	addToFeed("<br> <br> Exiting autonomous mode")
 }
 
 func angle2Direction(angle int) (direction, error) {
@@ -140,15 +223,14 @@ var stashedDriveInstruction driveInstruction
 
 func updateMap(driveInstruction driveInstruction, ctx context.Context, db DB) {
 
-	feed = " <br> <br> Instruction : " + driveInstruction.Instruction + ":" + strconv.Itoa(driveInstruction.Value) + " : Sucsessful" + feed
-
-	fmt.Println("inserting instructions via update map")
+	addToFeed(" <br> <br> Instruction : " + driveInstruction.Instruction + ":" + strconv.Itoa(driveInstruction.Value) + " : Sucsessful")
 
-	if err := db.storeInstruction(ctx, driveInstruction.Instruction, driveInstruction.Value); err != nil {
+	if err := db.storeInstruction(ctx, currentMission.MissionID, driveInstruction.Instruction, driveInstruction.Value); err != nil {
 		db.getLogger().Error("server: map_general: updateMap: failed to store instruction", zap.Error(err))
 	}
 
 	driveTocoords(stashedDriveInstruction, tileWidth)
+	updateDiscoveryStats()
 
 	stashedDriveInstruction = driveInstruction
 
@@ -168,10 +250,11 @@ func updateMap(driveInstruction driveInstruction, ctx context.Context, db DB) {
  */
 
 func stop(mqtt MQTT, ctx context.Context, db DB, distance int, obstructionType string, stopAfterTurn bool) {
-	feed = "Obstruction identified"
+	feed = ""
+	addToFeed("Obstruction identified")
 
 	if stopAfterTurn {
-		feed = "<br> <br> Instruction : " + stashedDriveInstruction.Instruction + ":" + strconv.Itoa(stashedDriveInstruction.Value) + " : Sucsessful <br> <br> Obstruction not on path, continuing to move <br> <br>" + feed
+		addToFeed("<br> <br> Instruction : " + stashedDriveInstruction.Instruction + ":" + strconv.Itoa(stashedDriveInstruction.Value) + " : Sucsessful <br> <br> Obstruction not on path, continuing to move <br> <br>")
 
 		// Complete turn
 		driveTocoords(stashedDriveInstruction, tileWidth)
@@ -181,9 +264,9 @@ func stop(mqtt MQTT, ctx context.Context, db DB, distance int, obstructionType s
 		stashedDriveInstruction.Instruction = "forward"
 		stashedDriveInstruction.Value = distance
 
-		feed = "<br> <br> Adjusted instruction : " + stashedDriveInstruction.Instruction + ":" + strconv.Itoa(stashedDriveInstruction.Value) + " : Sucsessful <br> <br> Obstruction on path, adjusting instruction " + feed
+		addToFeed("<br> <br> Adjusted instruction : " + stashedDriveInstruction.Instruction + ":" + strconv.Itoa(stashedDriveInstruction.Value) + " : Sucsessful <br> <br> Obstruction on path, adjusting instruction ")
 
-		if err := db.storeInstruction(ctx, stashedDriveInstruction.Instruction, stashedDriveInstruction.Value); err != nil {
+		if err := db.storeInstruction(ctx, currentMission.MissionID, stashedDriveInstruction.Instruction, stashedDriveInstruction.Value); err != nil {
 			mqtt.getLogger().Error("server: map_general: stop: failed to store instruction", zap.Error(err))
 		}
 
@@ -198,28 +281,31 @@ func stop(mqtt MQTT, ctx context.Context, db DB, distance int, obstructionType s
 		// Assuming obstruction will only ever be in box in front (when stop after forward instruction)
 		indx := getOneInFront(0)
 
-		Map.Tiles[indx] = obstacleToValue(obstructionType)
+		setTile(indx, obstacleToValue(obstructionType), causeObstacle, "")
+		serverMetrics.obstacleFound(strings.TrimSpace(obstacleToName(obstructionType)))
 
-		feed = "<br> <br> Obstruction identified: " + obstacleToName(obstructionType) + feed
+		addToFeed("<br> <br> Obstruction identified: " + obstacleToName(obstructionType))
 	}
+	updateDiscoveryStats()
+	serverMetrics.replanned()
 
-	feed = "<br> <br> Stopped due to obstruction <br> <br> Computing new shortest path " + feed
-	fmt.Println("Stopped due to obstruction. Computing new shortest path.")
+	addToFeed("<br> <br> Stopped due to obstruction <br> <br> Computing new shortest path ")
+	mqtt.getLogger().Info("stopped due to obstruction, computing new shortest path", currentSequenceFields()...)
 
 	if stopAutonomous == false {
-		autonomousDrive(mqtt)
+		autonomousDrive(ctx, mqtt)
 	} else {
 
-		if err := mapAndDrive(mqtt, previousDestinationRow, previousDestinationCol, previousDestinationMode); err != nil {
+		if err := mapAndDrive(ctx, mqtt, previousDestinationRow, previousDestinationCol, previousDestinationMode); err != nil {
 			// Enough to log error => Error is handled manually by clicking again on map
-			mqtt.getLogger().Error("server: map_general: stop: failed to compute new shortest path")
+			mqtt.getLogger().Error("server: map_general: stop: failed to compute new shortest path", zap.Error(err))
 		}
 	}
 }
 
-func updateMapWithObstructionWhileTurning(obstructionType string) {
+func updateMapWithObstructionWhileTurning(logger *zap.Logger, obstructionType string) {
 	if stashedDriveInstruction.Instruction != "turnRight" && stashedDriveInstruction.Instruction != "turnLeft" {
-		fmt.Println("server: map_general: updateMapWithObstructionWhileTurning fail, not currently turning")
+		logger.Debug("server: map_general: updateMapWithObstructionWhileTurning: not currently turning")
 		return
 	}
 
@@ -234,8 +320,11 @@ func updateMapWithObstructionWhileTurning(obstructionType string) {
 
 	if !(Map.Tiles[indx] == 1 || Map.Tiles[indx] == 2) && obstructionType == "" {
 		// Don't update to prevent removing just detected obstructions
+	} else if obstructionType == "" {
+		setTile(indx, obstacleToValue(obstructionType), causeDrive, "")
 	} else {
-		Map.Tiles[indx] = obstacleToValue(obstructionType)
+		setTile(indx, obstacleToValue(obstructionType), causeObstacle, "")
+		serverMetrics.obstacleFound(strings.TrimSpace(obstacleToName(obstructionType)))
 	}
 }
 
@@ -256,8 +345,7 @@ func obstacleToValue(obstacle string) int {
 		return 10
 	}
 
-	fmt.Println("server: map_general: obstacleToValue: unknown obstacle, returning default value 5")
-	return 5
+	return 5 // Unknown obstacle
 }
 
 func obstacleToName(obstacle string) string {
@@ -277,7 +365,6 @@ func obstacleToName(obstacle string) string {
 		return "Violet ball"
 	}
 
-	fmt.Println("server: map_general: obstacleToValue: unknown obstacle, returning default value 5")
 	return "Unknown obstruction"
 }
 
@@ -298,7 +385,7 @@ func getOneInFront(changeInRotation int) int {
 
 func checkBalls() bool {
 	if ballCount.blue == true && ballCount.red == true && ballCount.teal == true && ballCount.violet == true && ballCount.yellow == true {
-		feed = "<br> <br> All balls found, stopping rover" + feed
+		addToFeed("<br> <br> All balls found, stopping rover")
 
 		return true
 	} else {
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/*
+	Keep-out zones are areas of the map that the rover must not enter although they are not obstructions
+	(e.g. fragile areas or areas reserved for other rovers).
+
+	A zone is either a rectangle of tiles or a polygon.
+	Polygon vertices are given in tile coordinates where tile (x, y) covers the area [x, x+1) x [y, y+1).
+	A tile is part of a polygon zone if its centre lies inside the polygon.
+*/
+const (
+	keepOutZoneRectangle = "rectangle"
+	keepOutZonePolygon   = "polygon"
+)
+
+type point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type keepOutZone struct {
+	ZoneID    int            `json:"zoneID"`
+	Name      string         `json:"name"`
+	Kind      string         `json:"kind"`
+	Rectangle *tileRectangle `json:"rectangle,omitempty"`
+	Polygon   []point        `json:"polygon,omitempty"`
+}
+
+// Keep-out zones of the live map
+var keepOutZones = []keepOutZone{}
+
+// Loads the keep-out zones of the live map from the db
+func loadKeepOutZones(ctx context.Context, db DB) error {
+	zones, err := db.getLiveKeepOutZones(ctx)
+	if err != nil {
+		return fmt.Errorf("server: map_geofence: failed to get keep-out zones: %w", err)
+	}
+
+	keepOutZones = zones
+	return nil
+}
+
+func addKeepOutZone(ctx context.Context, db DB, zone keepOutZone) (int, error) {
+	if err := validateKeepOutZone(zone, Map); err != nil {
+		return -1, err
+	}
+
+	id, err := db.insertLiveKeepOutZone(ctx, zone)
+	if err != nil {
+		return -1, fmt.Errorf("server: map_geofence: failed to insert keep-out zone: %w", err)
+	}
+
+	zone.ZoneID = id
+	keepOutZones = append(keepOutZones, zone)
+	return id, nil
+}
+
+func removeKeepOutZone(ctx context.Context, db DB, zoneID int) error {
+	if err := db.deleteLiveKeepOutZone(ctx, zoneID); err != nil {
+		return fmt.Errorf("server: map_geofence: failed to delete keep-out zone: %w", err)
+	}
+
+	zones := []keepOutZone{}
+	for _, zone := range keepOutZones {
+		if zone.ZoneID != zoneID {
+			zones = append(zones, zone)
+		}
+	}
+	keepOutZones = zones
+	return nil
+}
+
+// Replaces the live keep-out zones with the keep-out zones stored with a saved map
+func restoreKeepOutZones(ctx context.Context, db DB, mapID int) error {
+	zones, err := db.getKeepOutZones(ctx, mapID)
+	if err != nil {
+		return fmt.Errorf("server: map_geofence: failed to get keep-out zones of map %v: %w", mapID, err)
+	}
+
+	live, err := db.replaceLiveKeepOutZones(ctx, zones)
+	if err != nil {
+		return fmt.Errorf("server: map_geofence: failed to replace live keep-out zones: %w", err)
+	}
+
+	keepOutZones = live
+	return nil
+}
+
+func validateKeepOutZone(zone keepOutZone, tileMap tileMap) error {
+	switch zone.Kind {
+	case keepOutZoneRectangle:
+		if zone.Rectangle == nil {
+			return errors.New("server: map_geofence: rectangle zone requires a rectangle")
+		}
+		return validateRectangle(*zone.Rectangle, tileMap)
+	case keepOutZonePolygon:
+		if len(zone.Polygon) < 3 {
+			return errors.New("server: map_geofence: polygon zone requires at least three points")
+		}
+		for _, p := range zone.Polygon {
+			if p.X < 0 || p.X > float64(tileMap.Cols) || p.Y < 0 || p.Y > float64(tileMap.Rows) {
+				return fmt.Errorf("server: map_geofence: polygon point (%v, %v) is outside of the map", p.X, p.Y)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("server: map_geofence: unknown zone kind %q", zone.Kind)
+}
+
+func (zone *keepOutZone) containsTile(x int, y int) bool {
+	switch zone.Kind {
+	case keepOutZoneRectangle:
+		r := zone.Rectangle
+		return r != nil && x >= r.Left && x <= r.Right && y >= r.Top && y <= r.Bottom
+	case keepOutZonePolygon:
+		return polygonContainsPoint(zone.Polygon, point{float64(x) + 0.5, float64(y) + 0.5})
+	}
+	return false
+}
+
+// Ray casting algorithm (see https://en.wikipedia.org/wiki/Point_in_polygon)
+func polygonContainsPoint(polygon []point, p point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func isInKeepOutZone(x int, y int, zones []keepOutZone) bool {
+	for i := range zones {
+		if zones[i].containsTile(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Returns a copy of the map where all tiles inside keep-out zones are marked as no-go tiles.
+	Used by the planner and autonomous mode so that zones are neither crossed nor chosen as destinations.
+	The rover's own tile is left out so that a rover that stands inside a zone can still drive out of it.
+*/
+func applyKeepOutZones(tileMap tileMap, zones []keepOutZone, rover rover) tileMap {
+	result := tileMap
+	result.Tiles = append([]int{}, tileMap.Tiles...)
+
+	if len(zones) == 0 {
+		return result
+	}
+
+	for row := 0; row < result.Rows; row++ {
+		for col := 0; col < result.Cols; col++ {
+			if row == rover.Y && col == rover.X {
+				continue
+			}
+			if result.getTile(row, col) <= 2 && isInKeepOutZone(col, row, zones) {
+				result.Tiles[row*result.Cols+col] = tileMapNoGoVal
+			}
+		}
+	}
+
+	return result
+}
+
+/*
+	Dead-reckons a forward drive of the given distance (cm) from the rover's current pose.
+	Returns an error naming the first keep-out zone that would be entered.
+	A partially driven tile counts as entered as the rover position is only known to tile accuracy.
+*/
+func checkForwardDriveAgainstKeepOutZones(rover rover, distance int, tileWidth int, zones []keepOutZone) error {
+	dx, dy := 0, 0
+	switch rover.Rotation {
+	case 0, 360:
+		dx = 1
+	case 90:
+		dy = 1
+	case 180:
+		dx = -1
+	case 270:
+		dy = -1
+	default:
+		return fmt.Errorf("server: map_geofence: unsupported rover rotation %v", rover.Rotation)
+	}
+
+	// Negative distances drive backwards
+	if distance < 0 {
+		dx, dy, distance = -dx, -dy, -distance
+	}
+
+	for i := 1; i <= (distance+tileWidth-1)/tileWidth; i++ {
+		x := rover.X + i*dx
+		y := rover.Y + i*dy
+		for j := range zones {
+			if zones[j].containsTile(x, y) {
+				return fmt.Errorf("server: map_geofence: drive would enter keep-out zone %q at tile (%v, %v)", zones[j].Name, x, y)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyKeepOutZones(t *testing.T) {
+	type test struct {
+		tileMap  tileMap
+		zones    []keepOutZone
+		rover    rover
+		expected tileMap
+	}
+
+	tests := []test{
+		{
+			tileMap: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 1, 2, 3,
+				3, 5, 1, 3,
+				3, 3, 3, 3,
+			}},
+			zones: []keepOutZone{},
+			expected: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 1, 2, 3,
+				3, 5, 1, 3,
+				3, 3, 3, 3,
+			}},
+		},
+		{
+			tileMap: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 1, 2, 3,
+				3, 5, 1, 3,
+				3, 3, 3, 3,
+			}},
+			zones: []keepOutZone{
+				{Name: "rect", Kind: keepOutZoneRectangle, Rectangle: &tileRectangle{Left: 1, Top: 1, Right: 2, Bottom: 2}},
+			},
+			expected: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 11, 11, 3,
+				3, 5, 11, 3,
+				3, 3, 3, 3,
+			}},
+		},
+		{
+			// Triangle covering the centres of tiles (1, 1), (2, 1) and (2, 2) only
+			tileMap: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 1, 2, 3,
+				3, 1, 1, 3,
+				3, 3, 3, 3,
+			}},
+			zones: []keepOutZone{
+				{Name: "triangle", Kind: keepOutZonePolygon, Polygon: []point{{1, 1}, {3, 1}, {3, 3}}},
+			},
+			expected: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 11, 11, 3,
+				3, 1, 11, 3,
+				3, 3, 3, 3,
+			}},
+		},
+		{
+			// Rover inside the zone keeps its own tile so that it can drive out
+			tileMap: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 2, 2, 3,
+				3, 2, 2, 3,
+				3, 3, 3, 3,
+			}},
+			zones: []keepOutZone{
+				{Name: "rect", Kind: keepOutZoneRectangle, Rectangle: &tileRectangle{Left: 1, Top: 1, Right: 2, Bottom: 2}},
+			},
+			rover: rover{X: 2, Y: 1},
+			expected: tileMap{Rows: 4, Cols: 4, Tiles: []int{
+				3, 3, 3, 3,
+				3, 11, 2, 3,
+				3, 11, 11, 3,
+				3, 3, 3, 3,
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		original := append([]int{}, test.tileMap.Tiles...)
+
+		output := applyKeepOutZones(test.tileMap, test.zones, test.rover)
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("Map not equal to expected map.\nOutput map: %v\nExpected map: %v", output, test.expected)
+		}
+		if !reflect.DeepEqual(test.tileMap.Tiles, original) {
+			t.Errorf("applyKeepOutZones modified the input map.\nInput map: %v\nOriginal map: %v", test.tileMap.Tiles, original)
+		}
+	}
+}
+
+func TestCheckForwardDriveAgainstKeepOutZones(t *testing.T) {
+	type test struct {
+		rover       rover
+		distance    int
+		expectError bool
+	}
+
+	zones := []keepOutZone{
+		{Name: "fragile", Kind: keepOutZoneRectangle, Rectangle: &tileRectangle{Left: 8, Top: 4, Right: 9, Bottom: 6}},
+	}
+
+	tests := []test{
+		{rover{X: 5, Y: 5, Rotation: 0}, 60, false},
+		{rover{X: 5, Y: 5, Rotation: 0}, 90, true},
+		{rover{X: 5, Y: 5, Rotation: 0}, 70, true}, // partially enters tile (8, 5)
+		{rover{X: 5, Y: 5, Rotation: 180}, 90, false},
+		{rover{X: 11, Y: 5, Rotation: 180}, 60, true},
+		{rover{X: 5, Y: 5, Rotation: 180}, -90, true}, // driving backwards
+		{rover{X: 8, Y: 2, Rotation: 90}, 60, true},
+		{rover{X: 8, Y: 2, Rotation: 270}, 60, false},
+		{rover{X: 5, Y: 5, Rotation: 45}, 30, true},
+	}
+
+	for _, test := range tests {
+		err := checkForwardDriveAgainstKeepOutZones(test.rover, test.distance, 30, zones)
+		if (err != nil) != test.expectError {
+			t.Errorf("checkForwardDriveAgainstKeepOutZones(%+v, %v) returned error %v, expected error: %v", test.rover, test.distance, err, test.expectError)
+		}
+	}
+}
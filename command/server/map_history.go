@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+	Every change to a tile of the live map is recorded as a revision.
+	Only the changed tile is stored (delta). A reset of the whole map is stored as a single revision with indx = -1.
+	The map at any revision can be rebuilt by applying all revisions since the last reset to the default map.
+	Each revision stores the dimensions of the live map at the time, so maps of earlier dimensions can be rebuilt as well.
+	Revisions recorded before the dimensions were stored have 0 rows and cols.
+*/
+type tileRevision struct {
+	RevisionID    int       `json:"revisionID"`
+	MissionID     int       `json:"missionID"`
+	Timestamp     time.Time `json:"timestamp"`
+	Indx          int       `json:"indx"` // -1 for a map reset
+	Value         int       `json:"value"`
+	PreviousValue int       `json:"previousValue"`
+	Cause         string    `json:"cause"`
+	Author        string    `json:"author"`
+	Rows          int       `json:"rows"`
+	Cols          int       `json:"cols"`
+}
+
+// Causes of tile revisions
+const (
+	causeDrive    = "drive"    // rover drove over tile
+	causeObstacle = "obstacle" // rover detected obstruction
+	causeManual   = "manual"   // operator edited map
+	causeImport   = "import"   // imported map was loaded
+	causeLoad     = "load"     // saved map was loaded
+	causeReset    = "reset"    // map reset to default
+)
+
+const mapResetIndx = -1
+
+type tileChange struct {
+	Indx          int `json:"indx"`
+	Row           int `json:"row"`
+	Col           int `json:"col"`
+	PreviousValue int `json:"previousValue"`
+	Value         int `json:"value"`
+}
+
+// Revisions waiting to be written to the db, no revisions are recorded while paused (during a replay)
+var pendingRevisions struct {
+	sync.Mutex
+	revisions []tileRevision
+	paused    bool
+}
+
+func setRevisionsPaused(paused bool) {
+	pendingRevisions.Lock()
+	defer pendingRevisions.Unlock()
+
+	pendingRevisions.paused = paused
+}
+
+// Updates a tile of the live map and records the change if the value changed
+func setTile(indx int, value int, cause string, author string) {
+	previousValue := Map.Tiles[indx]
+	Map.Tiles[indx] = value
+
+	if previousValue == value {
+		return
+	}
+
+	pendingRevisions.Lock()
+	defer pendingRevisions.Unlock()
+	if pendingRevisions.paused {
+		return
+	}
+	pendingRevisions.revisions = append(pendingRevisions.revisions, tileRevision{
+		MissionID:     currentMission.MissionID,
+		Timestamp:     time.Now().UTC(),
+		Indx:          indx,
+		Value:         value,
+		PreviousValue: previousValue,
+		Cause:         cause,
+		Author:        author,
+		Rows:          Map.Rows,
+		Cols:          Map.Cols,
+	})
+}
+
+// Resets the live map tiles to the default map and records the reset
+func resetTiles(author string) {
+	Map.Tiles = defaultTiles(Map.Rows, Map.Cols)
+
+	pendingRevisions.Lock()
+	defer pendingRevisions.Unlock()
+	if pendingRevisions.paused {
+		return
+	}
+	pendingRevisions.revisions = append(pendingRevisions.revisions, tileRevision{
+		MissionID: currentMission.MissionID,
+		Timestamp: time.Now().UTC(),
+		Indx:      mapResetIndx,
+		Cause:     causeReset,
+		Author:    author,
+		Rows:      Map.Rows,
+		Cols:      Map.Cols,
+	})
+}
+
+// Writes all pending revisions to the db
+func recordMapRevisions(ctx context.Context, db DB) error {
+	pendingRevisions.Lock()
+	revisions := pendingRevisions.revisions
+	pendingRevisions.revisions = nil
+	pendingRevisions.Unlock()
+
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	if err := db.insertTileRevisions(ctx, revisions); err != nil {
+		// Keep revisions for next attempt
+		pendingRevisions.Lock()
+		pendingRevisions.revisions = append(revisions, pendingRevisions.revisions...)
+		pendingRevisions.Unlock()
+
+		return fmt.Errorf("server: map_history: failed to insert tile revisions: %w", err)
+	}
+
+	return nil
+}
+
+// Default map: unknown (1) with borders (3)
+func defaultTiles(rows int, cols int) []int {
+	tiles := make([]int, rows*cols)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if row == 0 || col == 0 || row == rows-1 || col == cols-1 {
+				tiles[row*cols+col] = 3
+			} else {
+				tiles[row*cols+col] = tileMapUnknownVal
+			}
+		}
+	}
+	return tiles
+}
+
+// Applies revisions in order to a copy of the base map, a reset with stored dimensions also resizes the map
+func applyTileRevisions(base tileMap, revisions []tileRevision) tileMap {
+	result := tileMap{
+		Rows:  base.Rows,
+		Cols:  base.Cols,
+		Tiles: append([]int{}, base.Tiles...),
+	}
+
+	for _, revision := range revisions {
+		if revision.Indx == mapResetIndx {
+			if revision.Rows > 0 && revision.Cols > 0 {
+				result.Rows, result.Cols = revision.Rows, revision.Cols
+			}
+			result.Tiles = defaultTiles(result.Rows, result.Cols)
+		} else if revision.Indx >= 0 && revision.Indx < len(result.Tiles) {
+			result.Tiles[revision.Indx] = revision.Value
+		}
+	}
+
+	return result
+}
+
+// Returns all tiles that differ between two maps of the same dimensions
+func diffTileMaps(from tileMap, to tileMap) []tileChange {
+	changes := []tileChange{}
+	for i := range from.Tiles {
+		if from.Tiles[i] != to.Tiles[i] {
+			changes = append(changes, tileChange{
+				Indx:          i,
+				Row:           i / from.Cols,
+				Col:           i % from.Cols,
+				PreviousValue: from.Tiles[i],
+				Value:         to.Tiles[i],
+			})
+		}
+	}
+	return changes
+}
+
+/*
+	Rebuilds the live map as it was after the given revision.
+	The dimensions are taken from the latest reset, the live map dimensions are only used for revisions without stored dimensions.
+*/
+func mapAtRevision(ctx context.Context, db DB, revisionID int) (tileMap, error) {
+	resetID, err := db.getLatestResetRevisionID(ctx, revisionID)
+	if err != nil {
+		return tileMap{}, fmt.Errorf("server: map_history: failed to get latest reset revision: %w", err)
+	}
+
+	// Revision ids are integers, so this includes the reset itself
+	revisions, err := db.getTileRevisions(ctx, resetID-1, revisionID)
+	if err != nil {
+		return tileMap{}, fmt.Errorf("server: map_history: failed to get tile revisions: %w", err)
+	}
+
+	return applyTileRevisions(tileMap{
+		Rows:  Map.Rows,
+		Cols:  Map.Cols,
+		Tiles: defaultTiles(Map.Rows, Map.Cols),
+	}, revisions), nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyTileRevisions(t *testing.T) {
+	type test struct {
+		base        tileMap
+		revisions   []tileRevision
+		expectedMap tileMap
+	}
+
+	tests := []test{
+		{
+			base: tileMap{3, 3, defaultTiles(3, 3)},
+			revisions: []tileRevision{
+				{Indx: 4, Value: 2},
+				{Indx: 4, Value: 7},
+			},
+			expectedMap: tileMap{3, 3, []int{
+				3, 3, 3,
+				3, 7, 3,
+				3, 3, 3,
+			}},
+		},
+		{
+			base: tileMap{4, 3, []int{
+				3, 3, 3,
+				3, 2, 3,
+				3, 5, 3,
+				3, 3, 3,
+			}},
+			revisions: []tileRevision{
+				{Indx: mapResetIndx},
+				{Indx: 7, Value: 2},
+			},
+			expectedMap: tileMap{4, 3, []int{
+				3, 3, 3,
+				3, 1, 3,
+				3, 2, 3,
+				3, 3, 3,
+			}},
+		},
+		// Reset of a map with other dimensions than the base map
+		{
+			base: tileMap{3, 3, defaultTiles(3, 3)},
+			revisions: []tileRevision{
+				{Indx: mapResetIndx, Rows: 3, Cols: 4},
+				{Indx: 5, Value: 2},
+			},
+			expectedMap: tileMap{3, 4, []int{
+				3, 3, 3, 3,
+				3, 2, 1, 3,
+				3, 3, 3, 3,
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		m := applyTileRevisions(test.base, test.revisions)
+		if !reflect.DeepEqual(m, test.expectedMap) {
+			t.Errorf("Map not equal to expected map.\nOutput map: %v\nExpected map: %v", m, test.expectedMap)
+		}
+	}
+}
+
+func TestDiffTileMaps(t *testing.T) {
+	from := tileMap{2, 3, []int{
+		1, 1, 1,
+		1, 2, 1,
+	}}
+	to := tileMap{2, 3, []int{
+		1, 2, 1,
+		1, 2, 6,
+	}}
+
+	expectedChanges := []tileChange{
+		{Indx: 1, Row: 0, Col: 1, PreviousValue: 1, Value: 2},
+		{Indx: 5, Row: 1, Col: 2, PreviousValue: 1, Value: 6},
+	}
+
+	changes := diffTileMaps(from, to)
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("Changes not equal to expected changes.\nOutput changes: %v\nExpected changes: %v", changes, expectedChanges)
+	}
+}
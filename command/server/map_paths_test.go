@@ -160,7 +160,7 @@ func TestGetShortedPathFromStartToDestination(t *testing.T) {
 	for _, test := range tests {
 		path, err := getShortedPathFromStartToDestination(test.startRow, test.startCol, test.destinationRow, test.destinationCol, test.tileMap)
 		if err != nil {
-			t.Errorf("getShortedPathFromStartToDestination returned error: %w", err)
+			t.Errorf("getShortedPathFromStartToDestination returned error: %v", err)
 		}
 		if !reflect.DeepEqual(path, test.expectedPath) {
 			t.Errorf("Path not equal to expected path.\nOutput path: %v\nExpected path: %v", path, test.expectedPath)
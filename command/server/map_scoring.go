@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tile classes that are scored against a ground truth map
+type tileClass int
+
+const (
+	noClass tileClass = iota
+	obstacleClass
+	ballClass
+)
+
+func tileValueToClass(value int) tileClass {
+	if value == 3 || value == 5 {
+		return obstacleClass
+	} else if value >= 6 && value <= 10 {
+		return ballClass
+	}
+	return noClass
+}
+
+type classScore struct {
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+}
+
+type mapScore struct {
+	Obstacle       classScore `json:"obstacle"`
+	Ball           classScore `json:"ball"`
+	Coverage       float64    `json:"coverage"`       // percentage of ground truth tiles that are no longer unknown
+	FalseFreeTiles int        `json:"falseFreeTiles"` // tiles discovered as empty that contain an obstacle or ball
+
+	FullyDiscovered         bool    `json:"fullyDiscovered"`
+	TimeToFullDiscovery     float64 `json:"timeToFullDiscovery"`     // seconds, only set if fully discovered
+	DistanceToFullDiscovery int     `json:"distanceToFullDiscovery"` // cm, only set if fully discovered
+}
+
+/*
+	Keeps track of how long it takes to discover the whole map.
+	Reset together with the live map and updated every time the rover reports a completed instruction.
+*/
+type discoveryStats struct {
+	start                   time.Time
+	distance                int // cm driven since start
+	fullyDiscovered         bool
+	timeToFullDiscovery     time.Duration
+	distanceToFullDiscovery int
+}
+
+var discovery = discoveryStats{
+	start: time.Now(),
+}
+
+func resetDiscoveryStats() {
+	discovery = discoveryStats{
+		start: time.Now(),
+	}
+}
+
+// Called after the live map changed
+func updateDiscoveryStats() {
+	if discovery.fullyDiscovered {
+		return
+	}
+
+	// Unknown tiles inside keep-out zones can not be discovered
+	if fullyDiscovered, _, _ := getBestNextDestinationCoordinates(applyKeepOutZones(Map, keepOutZones, Rover)); fullyDiscovered {
+		discovery.fullyDiscovered = true
+		discovery.timeToFullDiscovery = time.Since(discovery.start)
+		discovery.distanceToFullDiscovery = discovery.distance
+	}
+}
+
+/*
+	Compares a discovered map against a ground truth map.
+
+	A ball tile only counts as a true positive if the ball colour matches.
+	Tiles that are already known when a mission starts (the border) are excluded from all scores.
+	Precision is 1 if no tiles of a class were discovered and recall is 1 if the ground truth contains no tiles of a class.
+*/
+func scoreMap(discovered tileMap, groundTruth tileMap, stats discoveryStats) (mapScore, error) {
+	if discovered.Rows != groundTruth.Rows || discovered.Cols != groundTruth.Cols || len(discovered.Tiles) != len(groundTruth.Tiles) {
+		return mapScore{}, errors.New("server: map_scoring: discovered map and ground truth have different dimensions")
+	}
+
+	score := mapScore{}
+	knownTiles, discoveredTiles := 0, 0
+	startTiles := defaultTiles(groundTruth.Rows, groundTruth.Cols)
+
+	for i, truthVal := range groundTruth.Tiles {
+		if startTiles[i] != tileMapUnknownVal {
+			continue
+		}
+
+		discoveredVal := discovered.Tiles[i]
+		truthClass := tileValueToClass(truthVal)
+		discoveredClass := tileValueToClass(discoveredVal)
+
+		if truthVal != tileMapUnknownVal {
+			knownTiles++
+			if discoveredVal != tileMapUnknownVal {
+				discoveredTiles++
+			}
+		}
+
+		if discoveredVal == 2 && truthClass != noClass {
+			score.FalseFreeTiles++
+		}
+
+		for _, c := range []struct {
+			class tileClass
+			score *classScore
+		}{
+			{obstacleClass, &score.Obstacle},
+			{ballClass, &score.Ball},
+		} {
+			isTruePositive := truthClass == c.class && discoveredClass == c.class &&
+				(c.class != ballClass || truthVal == discoveredVal)
+
+			if isTruePositive {
+				c.score.TruePositives++
+				continue
+			}
+			if discoveredClass == c.class {
+				c.score.FalsePositives++
+			}
+			if truthClass == c.class {
+				c.score.FalseNegatives++
+			}
+		}
+	}
+
+	for _, c := range []*classScore{&score.Obstacle, &score.Ball} {
+		c.Precision = 1
+		if c.TruePositives+c.FalsePositives > 0 {
+			c.Precision = float64(c.TruePositives) / float64(c.TruePositives+c.FalsePositives)
+		}
+		c.Recall = 1
+		if c.TruePositives+c.FalseNegatives > 0 {
+			c.Recall = float64(c.TruePositives) / float64(c.TruePositives+c.FalseNegatives)
+		}
+	}
+
+	score.Coverage = 100
+	if knownTiles > 0 {
+		score.Coverage = 100 * float64(discoveredTiles) / float64(knownTiles)
+	}
+
+	score.FullyDiscovered = stats.fullyDiscovered
+	if stats.fullyDiscovered {
+		score.TimeToFullDiscovery = stats.timeToFullDiscovery.Seconds()
+		score.DistanceToFullDiscovery = stats.distanceToFullDiscovery
+	}
+
+	return score, nil
+}
+
+// Human readable comparison report
+func (s mapScore) report(mapName string, groundTruthName string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Map %q compared to ground truth %q\n", mapName, groundTruthName)
+	fmt.Fprintf(&b, "  Coverage:          %.1f%%\n", s.Coverage)
+	fmt.Fprintf(&b, "  False free tiles:  %d\n", s.FalseFreeTiles)
+	for _, c := range []struct {
+		name  string
+		score classScore
+	}{
+		{"Obstacles", s.Obstacle},
+		{"Balls", s.Ball},
+	} {
+		fmt.Fprintf(&b, "  %-18s precision %.2f, recall %.2f (TP %d, FP %d, FN %d)\n", c.name+":", c.score.Precision, c.score.Recall, c.score.TruePositives, c.score.FalsePositives, c.score.FalseNegatives)
+	}
+	if s.FullyDiscovered {
+		fmt.Fprintf(&b, "  Full discovery:    %.0fs, %dcm driven\n", s.TimeToFullDiscovery, s.DistanceToFullDiscovery)
+	} else {
+		fmt.Fprintf(&b, "  Full discovery:    not reached\n")
+	}
+
+	return b.String()
+}
+
+// Registers a ground truth map that is given in one of the map exchange formats (see map_formats.go)
+func RegisterGroundTruth(ctx context.Context, db DB, name string, format string, data []byte) error {
+	groundTruth, err := decodeMap(data, format, Map.Rows, Map.Cols)
+	if err != nil {
+		return fmt.Errorf("server: map_scoring: failed to decode ground truth: %w", err)
+	}
+
+	if err := db.insertGroundTruth(ctx, name, groundTruth); err != nil {
+		return fmt.Errorf("server: map_scoring: failed to insert ground truth: %w", err)
+	}
+
+	return nil
+}
+
+// Returns a comparison report of a saved map against a registered ground truth
+func CompareMapToGroundTruth(ctx context.Context, db DB, mapName string, groundTruthName string) (string, error) {
+	score, err := scoreSavedMap(ctx, db, mapName, groundTruthName)
+	if err != nil {
+		return "", err
+	}
+
+	return score.report(mapName, groundTruthName), nil
+}
+
+func scoreSavedMap(ctx context.Context, db DB, mapName string, groundTruthName string) (mapScore, error) {
+	mapID, err := db.getMapID(ctx, mapName)
+	if err != nil {
+		return mapScore{}, fmt.Errorf("server: map_scoring: failed to get map id: %w", err)
+	}
+
+	return scoreSavedMapByID(ctx, db, mapID, groundTruthName)
+}
+
+func scoreSavedMapByID(ctx context.Context, db DB, mapID int, groundTruthName string) (mapScore, error) {
+	m, err := db.getMap(ctx, mapID)
+	if err != nil {
+		return mapScore{}, fmt.Errorf("server: map_scoring: failed to get map: %w", err)
+	}
+
+	groundTruth, err := db.getGroundTruth(ctx, groundTruthName)
+	if err != nil {
+		return mapScore{}, fmt.Errorf("server: map_scoring: failed to get ground truth: %w", err)
+	}
+
+	stats, err := db.getDiscoveryStats(ctx, mapID)
+	if err != nil {
+		return mapScore{}, fmt.Errorf("server: map_scoring: failed to get discovery stats: %w", err)
+	}
+
+	return scoreMap(m.tileMap(), groundTruth, stats)
+}
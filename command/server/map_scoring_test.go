@@ -0,0 +1,78 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScoreMap(t *testing.T) {
+	type test struct {
+		discovered    tileMap
+		groundTruth   tileMap
+		stats         discoveryStats
+		expectedScore mapScore
+	}
+
+	groundTruth := tileMap{4, 5, []int{
+		3, 3, 3, 3, 3,
+		3, 6, 5, 2, 3,
+		3, 2, 2, 7, 3,
+		3, 3, 3, 3, 3,
+	}}
+
+	tests := []test{
+		{
+			discovered:  groundTruth,
+			groundTruth: groundTruth,
+			stats: discoveryStats{
+				fullyDiscovered:         true,
+				timeToFullDiscovery:     90 * time.Second,
+				distanceToFullDiscovery: 240,
+			},
+			expectedScore: mapScore{
+				Obstacle:                classScore{1, 0, 0, 1, 1},
+				Ball:                    classScore{2, 0, 0, 1, 1},
+				Coverage:                100,
+				FullyDiscovered:         true,
+				TimeToFullDiscovery:     90,
+				DistanceToFullDiscovery: 240,
+			},
+		},
+		{
+			discovered: tileMap{4, 5, []int{
+				3, 3, 3, 3, 1,
+				3, 7, 2, 5, 3,
+				3, 1, 2, 1, 3,
+				3, 3, 3, 3, 3,
+			}},
+			groundTruth: groundTruth,
+			expectedScore: mapScore{
+				Obstacle:       classScore{0, 1, 1, 0, 0},
+				Ball:           classScore{0, 1, 2, 0, 0},
+				Coverage:       100 * 4.0 / 6.0,
+				FalseFreeTiles: 1,
+			},
+		},
+		// Freshly reset map: the border alone must not count as discovered
+		{
+			discovered:  tileMap{4, 5, defaultTiles(4, 5)},
+			groundTruth: groundTruth,
+			expectedScore: mapScore{
+				Obstacle: classScore{0, 0, 1, 1, 0},
+				Ball:     classScore{0, 0, 2, 1, 0},
+				Coverage: 0,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		score, err := scoreMap(test.discovered, test.groundTruth, test.stats)
+		if err != nil {
+			t.Errorf("scoreMap returned error: %v", err)
+		}
+		if !reflect.DeepEqual(score, test.expectedScore) {
+			t.Errorf("Score not equal to expected score.\nOutput score: %+v\nExpected score: %+v", score, test.expectedScore)
+		}
+	}
+}
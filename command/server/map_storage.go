@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errMapNotFound  = errors.New("server: map_storage: map does not exist")
+	errMapNameTaken = errors.New("server: map_storage: a map with this name already exists")
+	errMapSize      = errors.New("server: map_storage: map does not have the dimensions of the live map")
+)
+
+// Map as stored in the db. Tiles are omitted when listing maps.
+type savedMap struct {
+	MapID         int       `json:"mapID"`
+	Name          string    `json:"name"`
+	Rows          int       `json:"rows"`
+	Cols          int       `json:"cols"`
+	Tiles         []int     `json:"layout,omitempty"`
+	RoverIndx     int       `json:"roverIndx"`
+	RoverRotation int       `json:"roverRotation"`
+	MissionID     int       `json:"missionID"` // imported maps have a mission of their own
+	Created       time.Time `json:"created"`
+	Updated       time.Time `json:"updated"`
+}
+
+// Fields of a saved map that can be changed. Fields that are not set are left unchanged.
+type savedMapUpdate struct {
+	Name          *string `json:"name"`
+	Tiles         []int   `json:"layout"`
+	RoverIndx     *int    `json:"roverIndx"`
+	RoverRotation *int    `json:"roverRotation"`
+}
+
+func (m *savedMap) tileMap() tileMap {
+	return tileMap{
+		Rows:  m.Rows,
+		Cols:  m.Cols,
+		Tiles: m.Tiles,
+	}
+}
+
+func validateSavedMap(m savedMap) error {
+	if m.Name == "" {
+		return errors.New("server: map_storage: map name is required")
+	}
+	if m.Rows <= 0 || m.Cols <= 0 || len(m.Tiles) != m.Rows*m.Cols {
+		return fmt.Errorf("server: map_storage: layout must contain %v tiles", m.Rows*m.Cols)
+	}
+	for _, value := range m.Tiles {
+		if !isValidTileValue(value) {
+			return fmt.Errorf("server: map_storage: invalid tile value %v", value)
+		}
+	}
+	if m.RoverIndx < 0 || m.RoverIndx >= len(m.Tiles) {
+		return fmt.Errorf("server: map_storage: rover index %v is outside of the map", m.RoverIndx)
+	}
+	if _, err := angle2Direction(m.RoverRotation); err != nil {
+		return fmt.Errorf("server: map_storage: invalid rover rotation %v", m.RoverRotation)
+	}
+	return nil
+}
+
+func (u *savedMapUpdate) apply(m savedMap) savedMap {
+	if u.Name != nil {
+		m.Name = *u.Name
+	}
+	if u.Tiles != nil {
+		m.Tiles = u.Tiles
+	}
+	if u.RoverIndx != nil {
+		m.RoverIndx = *u.RoverIndx
+	}
+	if u.RoverRotation != nil {
+		m.RoverRotation = *u.RoverRotation
+	}
+	return m
+}
+
+// Saves the live map, rover pose, discovery stats and keep-out zones under a new name and links it to the current mission
+func saveLiveMap(ctx context.Context, db DB, name string) (int, error) {
+	now := time.Now()
+	m := savedMap{
+		Name:          name,
+		Rows:          Map.Rows,
+		Cols:          Map.Cols,
+		Tiles:         append([]int{}, Map.Tiles...),
+		RoverIndx:     Rover.X + (Rover.Y * Map.Cols),
+		RoverRotation: Rover.Rotation,
+		MissionID:     currentMission.MissionID,
+		Created:       now,
+		Updated:       now,
+	}
+	if err := validateSavedMap(m); err != nil {
+		return -1, err
+	}
+
+	mapID, err := db.insertMapSnapshot(ctx, m, discovery, keepOutZones)
+	if err != nil {
+		return -1, fmt.Errorf("server: map_storage: failed to save map: %w", err)
+	}
+
+	return mapID, nil
+}
+
+// Replaces the live map, rover pose and keep-out zones with a saved map that has the dimensions of the live map, the map revisions still need to be recorded
+func loadSavedMap(ctx context.Context, db DB, mapID int) (savedMap, error) {
+	m, err := db.getMap(ctx, mapID)
+	if err != nil {
+		return savedMap{}, err
+	}
+	if m.Rows != Map.Rows || m.Cols != Map.Cols {
+		return savedMap{}, fmt.Errorf("%w: %v rows and %v cols", errMapSize, Map.Rows, Map.Cols)
+	}
+	if err := restoreKeepOutZones(ctx, db, m.MapID); err != nil {
+		return savedMap{}, err
+	}
+
+	for i, value := range m.Tiles {
+		setTile(i, value, causeLoad, "")
+	}
+	Rover.X = m.RoverIndx % m.Cols
+	Rover.Y = m.RoverIndx / m.Cols
+	Rover.Rotation = m.RoverRotation
+	updateDiscoveryStats()
+
+	addToFeed("<br> <br> Saved map loaded: " + m.Name)
+	return m, nil
+}
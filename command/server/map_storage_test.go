@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestValidateSavedMap(t *testing.T) {
+	type test struct {
+		m           savedMap
+		expectError bool
+	}
+
+	valid := savedMap{Name: "arena", Rows: 3, Cols: 3, Tiles: defaultTiles(3, 3), RoverIndx: 4, RoverRotation: 90}
+
+	withName := valid
+	withName.Name = ""
+	withTiles := valid
+	withTiles.Tiles = defaultTiles(2, 3)
+	withValue := valid
+	withValue.Tiles = []int{3, 3, 3, 3, 12, 3, 3, 3, 3}
+	withRover := valid
+	withRover.RoverIndx = 9
+	withRotation := valid
+	withRotation.RoverRotation = 45
+
+	tests := []test{
+		{valid, false},
+		{withName, true},
+		{withTiles, true},
+		{withValue, true},
+		{withRover, true},
+		{withRotation, true},
+	}
+
+	for _, test := range tests {
+		err := validateSavedMap(test.m)
+		if (err != nil) != test.expectError {
+			t.Errorf("validateSavedMap(%+v) returned error %v, expected error: %v", test.m, err, test.expectError)
+		}
+	}
+}
+
+func TestApplySavedMapUpdate(t *testing.T) {
+	type test struct {
+		update   savedMapUpdate
+		expected savedMap
+	}
+
+	name := "renamed"
+	roverIndx := 5
+	original := savedMap{MapID: 1, Name: "arena", Rows: 2, Cols: 3, Tiles: []int{1, 1, 1, 1, 1, 1}, RoverIndx: 4, RoverRotation: 90}
+
+	tests := []test{
+		{
+			savedMapUpdate{},
+			original,
+		},
+		{
+			savedMapUpdate{Name: &name},
+			savedMap{MapID: 1, Name: "renamed", Rows: 2, Cols: 3, Tiles: []int{1, 1, 1, 1, 1, 1}, RoverIndx: 4, RoverRotation: 90},
+		},
+		{
+			savedMapUpdate{Tiles: []int{2, 2, 2, 2, 2, 2}, RoverIndx: &roverIndx},
+			savedMap{MapID: 1, Name: "arena", Rows: 2, Cols: 3, Tiles: []int{2, 2, 2, 2, 2, 2}, RoverIndx: 5, RoverRotation: 90},
+		},
+	}
+
+	for _, test := range tests {
+		output := test.update.apply(original)
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("Map not equal to expected map.\nOutput map: %+v\nExpected map: %+v", output, test.expected)
+		}
+	}
+}
+
+// Imported maps of any size must pass validation with the rover at its start position
+func TestRoverStart(t *testing.T) {
+	type test struct {
+		rows, cols int
+		expectedX  int
+		expectedY  int
+	}
+
+	tests := []test{
+		{1, 1, 0, 0},
+		{2, 3, 1, 0},
+		{4, 4, 1, 1},
+		{12, 12, 5, 5},
+	}
+
+	for _, test := range tests {
+		x, y := roverStart(test.rows, test.cols)
+		if x != test.expectedX || y != test.expectedY {
+			t.Errorf("roverStart(%v, %v) returned (%v, %v), expected (%v, %v)", test.rows, test.cols, x, y, test.expectedX, test.expectedY)
+		}
+
+		m := savedMap{Name: "imported", Rows: test.rows, Cols: test.cols, Tiles: defaultTiles(test.rows, test.cols), RoverIndx: x + y*test.cols}
+		if err := validateSavedMap(m); err != nil {
+			t.Errorf("validateSavedMap of %vx%v map with the rover at its start returned error: %v", test.rows, test.cols, err)
+		}
+	}
+}
+
+func TestLoadSavedMapRestoresKeepOutZones(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenDB(ctx, zap.NewNop(), t.TempDir()+"/serverDB.db")
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	liveMap := tileMap{Map.Rows, Map.Cols, append([]int{}, Map.Tiles...)}
+	liveRover := Rover
+	liveZones := keepOutZones
+	defer func() {
+		Map = liveMap
+		Rover = liveRover
+		keepOutZones = liveZones
+	}()
+
+	keepOutZones = []keepOutZone{}
+	saved := keepOutZone{Name: "fragile", Kind: keepOutZoneRectangle, Rectangle: &tileRectangle{Left: 1, Top: 1, Right: 2, Bottom: 2}}
+	if _, err := addKeepOutZone(ctx, db, saved); err != nil {
+		t.Fatalf("failed to add keep-out zone: %v", err)
+	}
+	mapID, err := saveLiveMap(ctx, db, "arena")
+	if err != nil {
+		t.Fatalf("failed to save live map: %v", err)
+	}
+
+	if err := removeKeepOutZone(ctx, db, keepOutZones[0].ZoneID); err != nil {
+		t.Fatalf("failed to remove keep-out zone: %v", err)
+	}
+	if _, err := addKeepOutZone(ctx, db, keepOutZone{Name: "reserved", Kind: keepOutZonePolygon, Polygon: []point{{1, 1}, {3, 1}, {3, 3}}}); err != nil {
+		t.Fatalf("failed to add keep-out zone: %v", err)
+	}
+
+	if _, err := loadSavedMap(ctx, db, mapID); err != nil {
+		t.Fatalf("loadSavedMap returned error: %v", err)
+	}
+
+	if len(keepOutZones) != 1 || keepOutZones[0].Name != saved.Name || !reflect.DeepEqual(keepOutZones[0].Rectangle, saved.Rectangle) {
+		t.Errorf("Live keep-out zones not equal to zones of the saved map.\nLive zones: %+v\nSaved zone: %+v", keepOutZones, saved)
+	}
+	zones, err := db.getLiveKeepOutZones(ctx)
+	if err != nil {
+		t.Fatalf("failed to get live keep-out zones: %v", err)
+	}
+	if !reflect.DeepEqual(zones, keepOutZones) {
+		t.Errorf("Stored live keep-out zones not equal to live keep-out zones.\nStored zones: %+v\nLive zones: %+v", zones, keepOutZones)
+	}
+}
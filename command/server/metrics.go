@@ -0,0 +1,219 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+	Metrics of the server in the Prometheus text format (GET /metrics):
+		- spacexpp_http_request_duration_seconds: latency of HTTP requests by method, route pattern and status
+		- spacexpp_mqtt_messages_received_total / spacexpp_mqtt_messages_published_total: MQTT messages by topic
+		- spacexpp_instruction_round_trip_seconds: time from publishing a drive instruction until the rover reports that it started it
+		- spacexpp_planner_duration_seconds: runtime of the path planner
+		- spacexpp_replans_total: paths recomputed because of an obstruction
+		- spacexpp_obstacles_found_total: obstructions found by type
+		- spacexpp_battery_state_of_charge_percent / spacexpp_battery_state_of_health_percent: latest battery readings
+	Go runtime and process metrics are included as well.
+*/
+type metricsRegistry struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	httpRequestDuration  *prometheus.HistogramVec
+	mqttReceived         *prometheus.CounterVec
+	mqttPublished        *prometheus.CounterVec
+	instructionRoundTrip prometheus.Histogram
+	plannerDuration      prometheus.Histogram
+	replans              prometheus.Counter
+	obstaclesFound       *prometheus.CounterVec
+	batteryStateOfCharge prometheus.Gauge
+	batteryStateOfHealth prometheus.Gauge
+
+	// Publish times of drive instructions the rover has not started yet (in order)
+	mu                   sync.Mutex
+	instructionsInFlight []time.Time
+}
+
+var (
+	httpDurationBuckets    = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	roundTripBuckets       = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	plannerDurationBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+)
+
+// Rover stops sending feedback for dropped instructions, so the oldest ones are forgotten
+const maxInstructionsInFlight = 256
+
+// HTTP methods used as method label, any other method is counted as "other" so that clients can't create new series
+var metricsHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+var serverMetrics = newMetricsRegistry()
+
+func newMetricsRegistry() *metricsRegistry {
+	m := &metricsRegistry{
+		registry: prometheus.NewRegistry(),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "spacexpp_http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by route.",
+			Buckets: httpDurationBuckets,
+		}, []string{"method", "route", "status"}),
+		mqttReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "spacexpp_mqtt_messages_received_total",
+			Help: "MQTT messages received by topic.",
+		}, []string{"topic"}),
+		mqttPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "spacexpp_mqtt_messages_published_total",
+			Help: "MQTT messages published by topic.",
+		}, []string{"topic"}),
+		instructionRoundTrip: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "spacexpp_instruction_round_trip_seconds",
+			Help:    "Time from publishing a drive instruction until the rover started it.",
+			Buckets: roundTripBuckets,
+		}),
+		plannerDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "spacexpp_planner_duration_seconds",
+			Help:    "Runtime of the path planner.",
+			Buckets: plannerDurationBuckets,
+		}),
+		replans: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "spacexpp_replans_total",
+			Help: "Paths recomputed because of an obstruction.",
+		}),
+		obstaclesFound: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "spacexpp_obstacles_found_total",
+			Help: "Obstructions found by type.",
+		}, []string{"type"}),
+		batteryStateOfCharge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "spacexpp_battery_state_of_charge_percent",
+			Help: "Latest state of charge reported by the rover.",
+		}),
+		batteryStateOfHealth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "spacexpp_battery_state_of_health_percent",
+			Help: "Latest state of health reported by the rover.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.httpRequestDuration,
+		m.mqttReceived,
+		m.mqttPublished,
+		m.instructionRoundTrip,
+		m.plannerDuration,
+		m.replans,
+		m.obstaclesFound,
+		m.batteryStateOfCharge,
+		m.batteryStateOfHealth,
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+
+	return m
+}
+
+// Records the latency of every request by its route pattern (e.g. /maps/{id}), must be used before the router
+func instrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		serverMetrics.observeHTTPRequest(r.Method, route, status, time.Since(start))
+	})
+}
+
+func (h *HttpServer) getMetrics(w http.ResponseWriter, r *http.Request) {
+	serverMetrics.handler.ServeHTTP(w, r)
+}
+
+func metricsMethod(method string) string {
+	if metricsHTTPMethods[method] {
+		return method
+	}
+	return "other"
+}
+
+func (m *metricsRegistry) observeHTTPRequest(method string, route string, status int, duration time.Duration) {
+	m.httpRequestDuration.WithLabelValues(metricsMethod(method), route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+func (m *metricsRegistry) messageReceived(topic string) {
+	m.mqttReceived.WithLabelValues(topic).Inc()
+}
+
+func (m *metricsRegistry) messagePublished(topic string) {
+	m.mqttPublished.WithLabelValues(topic).Inc()
+}
+
+func (m *metricsRegistry) instructionPublished(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.instructionsInFlight) >= maxInstructionsInFlight {
+		m.instructionsInFlight = m.instructionsInFlight[1:]
+	}
+	m.instructionsInFlight = append(m.instructionsInFlight, now)
+}
+
+// The rover starts instructions in the order they were published
+func (m *metricsRegistry) instructionStarted(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.instructionsInFlight) == 0 {
+		return
+	}
+	m.instructionRoundTrip.Observe(now.Sub(m.instructionsInFlight[0]).Seconds())
+	m.instructionsInFlight = m.instructionsInFlight[1:]
+}
+
+// The rover drops its queued instructions when it stops for an obstruction
+func (m *metricsRegistry) instructionsDropped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.instructionsInFlight = nil
+}
+
+func (m *metricsRegistry) observePlanner(duration time.Duration) {
+	m.plannerDuration.Observe(duration.Seconds())
+}
+
+func (m *metricsRegistry) replanned() {
+	m.replans.Inc()
+}
+
+func (m *metricsRegistry) obstacleFound(obstacleType string) {
+	m.obstaclesFound.WithLabelValues(obstacleType).Inc()
+}
+
+// Called by the MQTT handler that updates the battery readings so that scrapes don't read them concurrently
+func (m *metricsRegistry) energyReported(e energy) {
+	m.batteryStateOfCharge.Set(float64(e.StateOfCharge))
+	m.batteryStateOfHealth.Set(float64(e.StateOfHealth))
+}
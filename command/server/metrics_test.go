@@ -0,0 +1,90 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsMethod(t *testing.T) {
+	type test struct {
+		method   string
+		expected string
+	}
+
+	tests := []test{
+		{http.MethodGet, "GET"},
+		{http.MethodDelete, "DELETE"},
+		{"BREW", "other"},
+		{"get", "other"},
+	}
+
+	for _, test := range tests {
+		output := metricsMethod(test.method)
+		if output != test.expected {
+			t.Errorf("Method label of %q not equal to expected label.\nOutput label: %v\nExpected label: %v", test.method, output, test.expected)
+		}
+	}
+}
+
+func TestInstructionRoundTrip(t *testing.T) {
+	m := newMetricsRegistry()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Sequence of two instructions and the end of sequence signal
+	for i := 0; i < 3; i++ {
+		m.instructionPublished(now)
+	}
+	m.instructionStarted(now.Add(time.Second))
+	m.instructionStarted(now.Add(3 * time.Second))
+
+	// Stopped for an obstruction, the end of sequence signal is dropped
+	m.instructionsDropped()
+	m.instructionStarted(now.Add(5 * time.Second))
+
+	output := scrapeMetrics(t, m)
+	for _, expected := range []string{
+		"spacexpp_instruction_round_trip_seconds_count 2\n",
+		"spacexpp_instruction_round_trip_seconds_sum 4\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Metrics output does not contain %q:\n%v", expected, output)
+		}
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	m := newMetricsRegistry()
+	m.observeHTTPRequest("BREW", "unmatched", http.StatusMethodNotAllowed, time.Millisecond)
+	m.observeHTTPRequest(http.MethodGet, "/maps/{id}", http.StatusOK, time.Millisecond)
+	m.energyReported(energy{StateOfCharge: 80, StateOfHealth: 95})
+
+	output := scrapeMetrics(t, m)
+	for _, expected := range []string{
+		`spacexpp_http_request_duration_seconds_count{method="other",route="unmatched",status="405"} 1`,
+		`spacexpp_http_request_duration_seconds_count{method="GET",route="/maps/{id}",status="200"} 1`,
+		"spacexpp_battery_state_of_charge_percent 80\n",
+		"spacexpp_battery_state_of_health_percent 95\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Metrics output does not contain %q:\n%v", expected, output)
+		}
+	}
+	if strings.Contains(output, "BREW") {
+		t.Errorf("Metrics output contains client method:\n%v", output)
+	}
+}
+
+func scrapeMetrics(t *testing.T, m *metricsRegistry) string {
+	recorder := httptest.NewRecorder()
+	m.handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, err := ioutil.ReadAll(recorder.Result().Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+	return string(body)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+/*
+	A mission is one run of the rover on the live map.
+	A new mission is started whenever the server starts or the live map is reset.
+	Instructions, telemetry and tile revisions (including obstacles) are recorded for the current mission
+	and saving the live map links the saved map to the current mission.
+*/
+type mission struct {
+	MissionID int       `json:"missionID"`
+	Started   time.Time `json:"started"`
+}
+
+var currentMission mission
+
+func startMission(ctx context.Context, db DB) error {
+	started := time.Now().UTC()
+
+	missionID, err := db.insertMission(ctx, started)
+	if err != nil {
+		return fmt.Errorf("server: missions: failed to insert mission: %w", err)
+	}
+
+	currentMission = mission{
+		MissionID: missionID,
+		Started:   started,
+	}
+
+	return nil
+}
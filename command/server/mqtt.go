@@ -4,13 +4,18 @@
 
 package server
 
-import "go.uber.org/zap"
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
 
 type MQTT interface {
 	getLogger() *zap.Logger
 	Connect() error
 	Disconnect()
 	publish(topic string, data string, qos byte)
-	publishDriveInstructionSequence(instructionSequence driveInstructions)
+	publishDriveInstructionSequence(ctx context.Context, instructionSequence driveInstructions) // ctx only carries the request ID
 	getIsConnected() bool
+	getIsSubscribed() bool
 }
@@ -10,9 +10,10 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"go.uber.org/zap"
@@ -21,32 +22,44 @@ import (
 type MQTTClient struct {
 	client mqtt.Client
 	logger *zap.Logger
+
+	// In-flight publishes and message handlers, waited for by Drain
+	pending  sync.WaitGroup
+	mu       sync.Mutex
+	draining bool
+
+	// All topics are subscribed, reset when the connection is lost
+	subscribed bool
 }
 
-func InitMQTT(ctx context.Context, logger *zap.Logger, db DB, mqttBrokerURL string, mqttUsername string, mqttPassword string) (*MQTTClient, error) {
-	tlsConfig, err := NewTlsConfig()
+// Topic that makes the rover drop its queued drive instructions
+const driveStopTopic = "/drive/stop"
+
+func InitMQTT(ctx context.Context, logger *zap.Logger, db DB, config MQTTConfig) (*MQTTClient, error) {
+	tlsConfig, err := NewTlsConfig(config.CAFileName)
 	if err != nil {
 		return &MQTTClient{}, fmt.Errorf("server: mqtt: failed to get TLS config: %w", err)
 	}
 
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(mqttBrokerURL)
+	opts.AddBroker(config.BrokerURL)
 	opts.SetTLSConfig(tlsConfig)
-	opts.SetUsername(mqttUsername)
-	opts.SetPassword(mqttPassword)
-	opts.SetClientID("SpaceXpp_server")
+	opts.SetUsername(config.Username)
+	opts.SetPassword(config.Password)
+	opts.SetClientID(config.ClientID)
 	opts.SetOrderMatters(true) // Drive instruction order must be preserved
 	opts.SetCleanSession(true)
 	opts.SetConnectRetry(true)
 
-	opts.OnConnect = mqttConnectHandler(logger, ctx, db)
-	opts.OnConnectionLost = mqttConnectLostHandler
-
-	return &MQTTClient{
-		client: mqtt.NewClient(opts),
+	m := &MQTTClient{
 		logger: logger,
-	}, nil
+	}
 
+	opts.OnConnect = mqttConnectHandler(m, ctx, db)
+	opts.OnConnectionLost = mqttConnectLostHandler(m)
+
+	m.client = mqtt.NewClient(opts)
+	return m, nil
 }
 
 func (m *MQTTClient) getLogger() *zap.Logger {
@@ -66,42 +79,120 @@ func (m *MQTTClient) Disconnect() {
 	m.logger.Info("Disconnected from MQTT broker successfully")
 }
 
-var testStatusMessagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	fmt.Printf("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
+// Registers a publish or message handler, returns false once the client is draining
+func (m *MQTTClient) begin() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.draining {
+		return false
+	}
+	m.pending.Add(1)
+	return true
 }
 
-func mqttConnectHandler(logger *zap.Logger, ctx context.Context, db DB) mqtt.OnConnectHandler {
-	return func(client mqtt.Client) {
-		fmt.Println("Connected to MQTT broker successfully")
+/*
+	Stops publishing and handling messages and waits until the in-flight publishes
+	and message handlers (including their DB writes) are done or the context is done.
+*/
+func (m *MQTTClient) Drain(ctx context.Context) error {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("server: mqtt: failed to drain in-flight messages: %w", ctx.Err())
+	}
+}
+
+// Makes the rover drop its queued drive instructions so that it stops after the current one
+func (m *MQTTClient) StopRover(ctx context.Context) error {
+	token := m.client.Publish(driveStopTopic, 2, false, "stop")
+	serverMetrics.messagePublished(driveStopTopic)
 
-		// Subscribe to topics
-		if token := client.Subscribe("/test/status", 0, testStatusMessagePubHandler); token.Wait() && token.Error() != nil {
-			log.Fatalf("server: mqtt: failed to subscribe to /test/status: %v", token.Error())
+	select {
+	case <-token.Done():
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("server: mqtt: failed to publish stop command: %w", err)
 		}
-		fmt.Println("Subscribed to topic: /test/status")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("server: mqtt: failed to publish stop command: %w", ctx.Err())
+	}
+}
+
+func testStatusMessagePubHandler(m *MQTTClient) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		m.logger.Info("received test status", zap.String("topic", msg.Topic()), zap.ByteString("payload", msg.Payload()))
+	}
+}
 
-		// Subscribe to instructions
-		if token := client.Subscribe("/feedback/instruction", 2, instructionFeedPubHandler(logger, ctx, db)); token.Wait() && token.Error() != nil {
-			log.Fatalf("server: mqtt: failed to subscribe to /feedback/instruction: %v", token.Error())
+/*
+	Subscribes to all topics whenever the client (re)connects.
+	A failed subscription is logged and leaves the client unsubscribed (GET /readyz fails) until the next reconnect.
+*/
+func mqttConnectHandler(m *MQTTClient, ctx context.Context, db DB) mqtt.OnConnectHandler {
+	return func(client mqtt.Client) {
+		m.logger.Info("connected to MQTT broker successfully")
+
+		subscriptions := []struct {
+			topic   string
+			qos     byte
+			handler mqtt.MessageHandler
+		}{
+			{"/test/status", 0, testStatusMessagePubHandler(m)},
+			{"/feedback/instruction", 2, instructionFeedPubHandler(m, ctx, db)},
+			{"/energy/status", 0, instructionEnergyPubHandler(m, ctx, db)},
 		}
-		fmt.Println("Subscribed to topic: /feedback/instruction")
 
-		// Subscribe to energy
-		if token := client.Subscribe("/energy/status", 0, instructionEnergyPubHandler(logger)); token.Wait() && token.Error() != nil {
-			log.Fatalf("server: mqtt: failed to subscribe to /energy/status: %v", token.Error())
+		for _, subscription := range subscriptions {
+			if token := client.Subscribe(subscription.topic, subscription.qos, subscription.handler); token.Wait() && token.Error() != nil {
+				m.logger.Error("server: mqtt: failed to subscribe to topic", zap.String("topic", subscription.topic), zap.Error(token.Error()))
+				return
+			}
+			m.logger.Info("subscribed to topic", zap.String("topic", subscription.topic))
 		}
-		fmt.Println("Subscribed to topic: /energy/status")
+
+		m.setSubscribed(true)
 	}
 }
 
-var mqttConnectLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
-	fmt.Printf("Connect to MQTT broker lost: %v", err)
+func mqttConnectLostHandler(m *MQTTClient) mqtt.ConnectionLostHandler {
+	return func(client mqtt.Client, err error) {
+		m.setSubscribed(false)
+
+		m.logger.Warn("connection to MQTT broker lost", zap.Error(err))
+	}
+}
+
+func (m *MQTTClient) setSubscribed(subscribed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscribed = subscribed
 }
 
-func NewTlsConfig() (*tls.Config, error) {
+func (m *MQTTClient) getIsSubscribed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.subscribed
+}
+
+// Trusts the CA of the broker
+func NewTlsConfig(caFileName string) (*tls.Config, error) {
 	certpool := x509.NewCertPool()
 
-	ca, err := ioutil.ReadFile("cert/mqtt_ca_cert.pem")
+	ca, err := ioutil.ReadFile(caFileName)
 	if err != nil {
 		return nil, fmt.Errorf("server: mqtt: failed to read CA certificate: %w", err)
 	}
@@ -114,123 +205,196 @@ func NewTlsConfig() (*tls.Config, error) {
 }
 
 func (m *MQTTClient) publish(topic string, data string, qos byte) {
+	m.publishWithLogger(m.logger, topic, data, qos)
+}
+
+// Logs with the given logger so that publishes of an instruction sequence carry its correlation IDs
+func (m *MQTTClient) publishWithLogger(logger *zap.Logger, topic string, data string, qos byte) {
+	if !m.begin() {
+		logger.Warn("server: mqttGeneral: dropped mqtt message while shutting down", zap.String("topic", topic), zap.String("data", data))
+		return
+	}
+
 	token := m.client.Publish(topic, qos, false, data)
+	logger.Debug("publishing mqtt message", zap.String("topic", topic), zap.String("data", data))
+	serverMetrics.messagePublished(topic)
+	if topic == "/drive/instruction" {
+		serverMetrics.instructionPublished(time.Now())
+	}
+
 	go func() {
+		defer m.pending.Done()
+
 		token.Wait()
 		if err := token.Error(); err != nil {
-			m.logger.Error("server: mqttGeneral: failed to publish mqtt message", zap.Error(err))
+			logger.Error("server: mqttGeneral: failed to publish mqtt message", zap.String("topic", topic), zap.String("data", data), zap.Error(err))
 		}
 	}()
 }
 
-func (m *MQTTClient) publishDriveInstructionSequence(instructionSequence driveInstructions) {
+// Every sequence gets a new sequence ID, the feedback of the rover is logged with the IDs of the latest sequence
+func (m *MQTTClient) publishDriveInstructionSequence(ctx context.Context, instructionSequence driveInstructions) {
 	driveInstructionDelimiter := ":"
 	topic := "/drive/instruction"
 	var qos byte = 2 // Guarantee delivery
 
+	requestID := getRequestID(ctx)
+	sequenceID := newCorrelationID()
+	setCurrentSequence(requestID, sequenceID)
+	logger := m.logger.With(correlationFields(requestID, sequenceID)...)
+
 	for _, instruction := range instructionSequence {
 		encodedInstruction := fmt.Sprintf("%s%s%d", instruction.Instruction, driveInstructionDelimiter, instruction.Value)
-		m.publish(topic, encodedInstruction, qos)
+		m.publishWithLogger(logger, topic, encodedInstruction, qos)
 	}
 
-	m.publish(topic, "X", qos)
+	m.publishWithLogger(logger, topic, "X", qos)
 
-	m.logger.Info("published drive instruction sequence successfully", zap.Array("instructionSequence", &instructionSequence))
+	logger.Info("published drive instruction sequence successfully", zap.Array("instructionSequence", &instructionSequence))
 }
 
 // Subscribing to instruction feed
 var stopData string
 
-func instructionFeedPubHandler(logger *zap.Logger, ctx context.Context, db DB) mqtt.MessageHandler {
+func instructionFeedPubHandler(m *MQTTClient, ctx context.Context, db DB) mqtt.MessageHandler {
 	return func(client mqtt.Client, msg mqtt.Message) {
-		fmt.Printf("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
-
-		s := strings.Split(string(msg.Payload()), ":")
-		value := s[1]
-		v, _ := strconv.Atoi(value) // No error checking as this is supposed to fail for stop instructions
-
-		var instruction driveInstruction
-		if s[0] == "F" {
-			instruction.Instruction = "forward"
-			instruction.Value = v
-			fmt.Println("storing instruction: updating map: calling function")
-			updateMap(instruction, ctx, db)
-		} else if s[0] == "R" {
-			instruction.Instruction = "turnRight"
-			instruction.Value = v
-			fmt.Println("storing instruction: updating map: calling function")
-			updateMapWithObstructionWhileTurning("")
-			updateMap(instruction, ctx, db)
-		} else if s[0] == "L" {
-			instruction.Instruction = "turnLeft"
-			instruction.Value = v
-			fmt.Println("storing instruction: updating map: calling function")
-			updateMapWithObstructionWhileTurning("")
-			updateMap(instruction, ctx, db)
-		} else if s[0] == "X" {
-			instruction.Instruction = "nil"
-			instruction.Value = 0
-			updateMap(instruction, ctx, db)
-
-			mqttClient := &MQTTClient{
-				client: client,
-				logger: logger,
-			}
+		if !m.begin() {
+			m.logger.Warn("server: mqttGeneral: ignored instruction feedback while shutting down", zap.ByteString("payload", msg.Payload()))
+			return
+		}
+		defer m.pending.Done()
 
-			if stopAutonomous == false {
-				autonomousDrive(mqttClient)
-			} else {
-				feed = "<br> <br> Rover has reached its destination" + feed
-			}
+		serverMetrics.messageReceived(msg.Topic())
+		observeInstructionFeedback(string(msg.Payload()), time.Now())
 
-		} else if s[0] == "S" {
-			if stashedDriveInstruction.Instruction == "forward" { // wait for second part of stop instruction to update map and stop
-				stopData = value
-			} else { // turning => update map without stopping
-				updateMapWithObstructionWhileTurning(value)
-			}
-		} else if s[0] == "SD" {
-			// Need to create MQTTClient for calling methods on it
-			mqttClient := &MQTTClient{
-				client: client,
-				logger: logger,
-			}
+		if err := db.insertTelemetry(ctx, currentMission.MissionID, msg.Topic(), string(msg.Payload())); err != nil {
+			m.logger.Error("server: mqttGeneral: failed to record instruction feedback", zap.Error(err))
+		}
 
-			ballIsFound(value)
+		handleInstructionFeedback(m, ctx, db, string(msg.Payload()))
+	}
+}
 
-			if v == -1 { // stopping after turn (map already updated with obstruction)
-				stop(mqttClient, ctx, db, 0, stopData, true)
-			} else { // stopping after forward (map not yet updated with obstruction)
-				stop(mqttClient, ctx, db, v, stopData, false)
-			}
+/*
+	The rover reports every instruction (F, R, L and X) when it starts it.
+	On an obstruction (S, SD) it drops its queued instructions. B is added by the rover itself.
+*/
+func observeInstructionFeedback(payload string, now time.Time) {
+	switch strings.Split(payload, ":")[0] {
+	case "F", "R", "L", "X":
+		serverMetrics.instructionStarted(now)
+	case "SD":
+		serverMetrics.instructionsDropped()
+	}
+}
 
-			stopData = ""
-		} else if s[0] == "B" {
-			// Ignore backwards instruction that are used for distance correction (drive only)
+/*
+	Updates the map based on instruction feedback from the rover.
+	Separate from the MQTT handler so that recorded feedback can be replayed (see replay.go).
+*/
+func handleInstructionFeedback(mqttClient MQTT, ctx context.Context, db DB, payload string) {
+	logger := mqttClient.getLogger().With(currentSequenceFields()...)
+	logger.Debug("received instruction feedback", zap.String("payload", payload))
+
+	s := strings.Split(payload, ":")
+	if len(s) < 2 {
+		logger.Error("server: mqttGeneral: malformed instruction feedback", zap.String("payload", payload))
+		return
+	}
+	value := s[1]
+	v, _ := strconv.Atoi(value) // No error checking as this is supposed to fail for stop instructions
+
+	var instruction driveInstruction
+	if s[0] == "F" {
+		instruction.Instruction = "forward"
+		instruction.Value = v
+		updateMap(instruction, ctx, db)
+	} else if s[0] == "R" {
+		instruction.Instruction = "turnRight"
+		instruction.Value = v
+		updateMapWithObstructionWhileTurning(logger, "")
+		updateMap(instruction, ctx, db)
+	} else if s[0] == "L" {
+		instruction.Instruction = "turnLeft"
+		instruction.Value = v
+		updateMapWithObstructionWhileTurning(logger, "")
+		updateMap(instruction, ctx, db)
+	} else if s[0] == "X" {
+		instruction.Instruction = "nil"
+		instruction.Value = 0
+		updateMap(instruction, ctx, db)
+
+		if stopAutonomous == false {
+			autonomousDrive(ctx, mqttClient)
 		} else {
-			fmt.Println("server: mqttGeneral: unknown drive instruction")
+			addToFeed("<br> <br> Rover has reached its destination")
+		}
+
+	} else if s[0] == "S" {
+		if stashedDriveInstruction.Instruction == "forward" { // wait for second part of stop instruction to update map and stop
+			stopData = value
+		} else { // turning => update map without stopping
+			updateMapWithObstructionWhileTurning(logger, value)
+		}
+	} else if s[0] == "SD" {
+		ballIsFound(value)
+
+		if v == -1 { // stopping after turn (map already updated with obstruction)
+			stop(mqttClient, ctx, db, 0, stopData, true)
+		} else { // stopping after forward (map not yet updated with obstruction)
+			stop(mqttClient, ctx, db, v, stopData, false)
 		}
+
+		stopData = ""
+	} else if s[0] == "B" {
+		// Ignore backwards instruction that are used for distance correction (drive only)
+	} else {
+		logger.Warn("server: mqttGeneral: unknown drive instruction", zap.String("payload", payload))
+	}
+
+	if err := recordMapRevisions(ctx, db); err != nil {
+		logger.Error("server: mqttGeneral: failed to record map revisions", zap.Error(err))
 	}
 }
 
-func instructionEnergyPubHandler(logger *zap.Logger) mqtt.MessageHandler {
+func instructionEnergyPubHandler(m *MQTTClient, ctx context.Context, db DB) mqtt.MessageHandler {
 	return func(client mqtt.Client, msg mqtt.Message) {
-		fmt.Printf("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
-
-		s := strings.Split(string(msg.Payload()), ":")
-		value := s[1]
-		v, _ := strconv.Atoi(value) // No error checking as this is supposed to fail for stop instructions
-
-		if s[0] == "C" {
-			currentEnergy.StateOfCharge = v
-		} else if s[0] == "H" {
-			currentEnergy.StateOfHealth = v
-		} else if s[0] == "E" {
-			currentEnergy.ErrorInCells = v
-		} else {
-			fmt.Println("server: mqttGeneral: unknown energy information")
+		if !m.begin() {
+			return
 		}
+		defer m.pending.Done()
+
+		m.logger.Debug("received energy status", zap.ByteString("payload", msg.Payload()))
+		serverMetrics.messageReceived(msg.Topic())
+
+		if err := db.insertTelemetry(ctx, currentMission.MissionID, msg.Topic(), string(msg.Payload())); err != nil {
+			m.logger.Error("server: mqttGeneral: failed to record energy status", zap.Error(err))
+		}
+
+		handleEnergyStatus(m.logger, string(msg.Payload()))
+	}
+}
+
+func handleEnergyStatus(logger *zap.Logger, payload string) {
+	s := strings.Split(payload, ":")
+	if len(s) < 2 {
+		logger.Warn("server: mqttGeneral: malformed energy information", zap.String("payload", payload))
+		return
+	}
+	value := s[1]
+	v, _ := strconv.Atoi(value)
+
+	if s[0] == "C" {
+		currentEnergy.StateOfCharge = v
+	} else if s[0] == "H" {
+		currentEnergy.StateOfHealth = v
+	} else if s[0] == "E" {
+		currentEnergy.ErrorInCells = v
+	} else {
+		logger.Warn("server: mqttGeneral: unknown energy information", zap.String("payload", payload))
+		return
 	}
+	serverMetrics.energyReported(currentEnergy)
 }
 
 func (m *MQTTClient) getIsConnected() bool {
@@ -258,5 +422,5 @@ func ballIsFound(data string) {
 		name = "unknown"
 	}
 
-	feed = "<br> <br> Obstacle identified as: " + name + feed
+	addToFeed("<br> <br> Obstacle identified as: " + name)
 }
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMQTTClientDrain(t *testing.T) {
+	m := &MQTTClient{logger: zap.NewNop()}
+
+	// In-flight message handler
+	if !m.begin() {
+		t.Fatal("begin returned false before draining")
+	}
+
+	// Times out while the handler is running
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain with in-flight handler returned error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// No new messages while draining
+	if m.begin() {
+		t.Error("begin returned true while draining")
+	}
+
+	// Returns once the handler is done
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.pending.Done()
+	}()
+	if err := m.Drain(context.Background()); err != nil {
+		t.Errorf("Drain returned error: %v", err)
+	}
+}
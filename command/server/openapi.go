@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//go:generate go run ./cmd/apigen -o client/client_gen.go
+
+/*
+	OpenAPI 3.0 specification of the versioned API (GET /api/v1/openapi.json).
+	The spec is built from the route table in api_v1.go and the Go types of the request and response bodies,
+	so it can't get out of sync with the handlers. The typed Go client in client/ is generated from it (go generate).
+	Schemas are named after the Go types with an upper case first letter (e.g. savedMap -> SavedMap).
+	Fields are required unless their json tag has omitempty.
+	All errors are described by the default response (errorResponse).
+*/
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Servers    []openAPIServer                        `json:"servers"`
+	Security   []map[string][]string                  `json:"security"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"` // by path and lower case method
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Security    *[]map[string][]string     `json:"security,omitempty"` // empty for public routes
+	Role        role                       `json:"x-role,omitempty"`   // minimum role of the user
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"` // by status
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"` // path or query
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+
+	err error // first unsupported type
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref,omitempty"`
+	Type       string                    `json:"type,omitempty"`
+	Format     string                    `json:"format,omitempty"`
+	Properties map[string]*openAPISchema `json:"properties,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+	Items      *openAPISchema            `json:"items,omitempty"`
+}
+
+const (
+	openAPIVersion = "3.0.3"
+	apiVersion     = "1.0.0"
+	jsonMediaType  = "application/json"
+)
+
+var openAPIPathParam = regexp.MustCompile(`{([A-Za-z]+)}`)
+
+// Spec of all routes in apiV1Routes
+func OpenAPISpec() ([]byte, error) {
+	spec, err := buildOpenAPIDocument((&HttpServer{}).apiV1Routes(context.Background()))
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("server: openapi: failed to encode spec: %w", err)
+	}
+	return data, nil
+}
+
+func (h *HttpServer) getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(spec); err != nil {
+		h.requestLogger(r).Error("server: openapi: failed to write spec")
+	}
+}
+
+func buildOpenAPIDocument(routes []apiRoute) (openAPIDocument, error) {
+	doc := openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:   "SpaceX++ command server",
+			Version: apiVersion,
+			Description: "Drives the rover and manages its maps. " +
+				"Requests authenticated with basic auth or a client certificate must set the X-Requested-With header unless they are GET requests.",
+		},
+		Servers:  []openAPIServer{{URL: apiV1Prefix}},
+		Security: []map[string][]string{{"basicAuth": {}}, {"bearerAuth": {}}},
+		Paths:    make(map[string]map[string]openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]*openAPISchema),
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"basicAuth":  {Type: "http", Scheme: "basic"},
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Access token of POST /auth/login"},
+			},
+		},
+	}
+
+	operationIDs := make(map[string]bool)
+	for _, route := range routes {
+		if operationIDs[route.operationID] {
+			return doc, fmt.Errorf("server: openapi: duplicate operation id %v", route.operationID)
+		}
+		operationIDs[route.operationID] = true
+
+		op := openAPIOperation{
+			OperationID: route.operationID,
+			Summary:     route.summary,
+			Role:        route.role,
+			Responses:   make(map[string]openAPIResponse),
+		}
+		if route.role == "" {
+			op.Security = &[]map[string][]string{}
+		}
+
+		for _, match := range openAPIPathParam.FindAllStringSubmatch(route.path, -1) {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   &openAPISchema{Type: "integer"},
+			})
+		}
+		for _, param := range route.query {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        param.name,
+				In:          "query",
+				Description: param.description,
+				Schema:      doc.Components.schema(reflect.TypeOf(param.value)),
+			})
+		}
+
+		if route.request != nil {
+			op.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]openAPIMediaType{jsonMediaType: {Schema: doc.Components.schema(reflect.TypeOf(route.request))}},
+			}
+		}
+
+		status := route.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := openAPIResponse{Description: http.StatusText(status)}
+		if route.response != nil {
+			response.Content = map[string]openAPIMediaType{jsonMediaType: {Schema: doc.Components.schema(reflect.TypeOf(route.response))}}
+		}
+		op.Responses[fmt.Sprint(status)] = response
+		op.Responses["default"] = openAPIResponse{
+			Description: "Error (see requests.go for the codes)",
+			Content:     map[string]openAPIMediaType{jsonMediaType: {Schema: doc.Components.schema(reflect.TypeOf(errorResponse{}))}},
+		}
+
+		if doc.Paths[route.path] == nil {
+			doc.Paths[route.path] = make(map[string]openAPIOperation)
+		}
+		doc.Paths[route.path][strings.ToLower(route.method)] = op
+	}
+
+	return doc, doc.Components.err
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema of a Go type, structs are added to the components and referenced
+func (c *openAPIComponents) schema(t reflect.Type) *openAPISchema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case t.Kind() == reflect.String:
+		return &openAPISchema{Type: "string"}
+	case t.Kind() == reflect.Slice:
+		return &openAPISchema{Type: "array", Items: c.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		name := schemaName(t)
+		if _, ok := c.Schemas[name]; !ok {
+			c.Schemas[name] = nil // Reserved so that recursive types terminate
+			c.Schemas[name] = c.structSchema(t)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + name}
+	}
+	if c.err == nil {
+		c.err = fmt.Errorf("server: openapi: unsupported type %v", t)
+	}
+	return &openAPISchema{}
+}
+
+func (c *openAPIComponents) structSchema(t reflect.Type) *openAPISchema {
+	s := &openAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*openAPISchema),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		s.Properties[name] = c.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+	Passwords are hashed with bcrypt (default) or argon2id.
+	The algorithm is stored as part of the hash so existing hashes keep working after the algorithm is changed,
+	the configured algorithm is only used for new passwords.
+*/
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+var errIncorrectPassword = errors.New("server: passwords: incorrect password")
+
+const DefaultBcryptCost = 12
+
+type passwordHashing struct {
+	algorithm  string
+	bcryptCost int
+}
+
+var currentPasswordHashing = passwordHashing{
+	algorithm:  PasswordHashBcrypt,
+	bcryptCost: DefaultBcryptCost,
+}
+
+// argon2id parameters (second recommended option of RFC 9106)
+const (
+	argon2idTime    = 3
+	argon2idMemory  = 64 * 1024 // KiB
+	argon2idThreads = 4
+	argon2idKeyLen  = 32
+	argon2idSaltLen = 16
+)
+
+// Sets the algorithm used to hash new passwords. bcryptCost is ignored for argon2id.
+func SetPasswordHashing(algorithm string, bcryptCost int) error {
+	switch algorithm {
+	case PasswordHashBcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("server: passwords: bcrypt cost must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordHashArgon2id:
+	default:
+		return fmt.Errorf("server: passwords: unknown password hash algorithm %q (bcrypt or argon2id)", algorithm)
+	}
+
+	currentPasswordHashing = passwordHashing{
+		algorithm:  algorithm,
+		bcryptCost: bcryptCost,
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if currentPasswordHashing.algorithm == PasswordHashArgon2id {
+		return hashArgon2id(password)
+	}
+
+	// Hash with salt
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), currentPasswordHashing.bcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("server: passwords: failed to encrypt password: %w", err)
+	}
+	return string(passwordHash), nil
+}
+
+// Returns errIncorrectPassword if the password does not match the hash
+func verifyPassword(passwordHash string, password string) error {
+	if strings.HasPrefix(passwordHash, "$argon2id$") {
+		return verifyArgon2id(passwordHash, password)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		return errIncorrectPassword
+	}
+	return nil
+}
+
+// Hashes are encoded in the PHC string format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func hashArgon2id(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("server: passwords: failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2idMemory, argon2idTime, argon2idThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func verifyArgon2id(passwordHash string, password string) error {
+	parts := strings.Split(passwordHash, "$")
+	if len(parts) != 6 {
+		return errIncorrectPassword
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return errIncorrectPassword
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return errIncorrectPassword
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return errIncorrectPassword
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return errIncorrectPassword
+	}
+
+	output := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(output, key) != 1 {
+		return errIncorrectPassword
+	}
+	return nil
+}
+
+/*
+	Password policy:
+		- at least minPasswordLength characters
+		- at most maxPasswordLength bytes (bcrypt ignores everything after 72 bytes)
+		- must not contain the username and must not be a commonly used password
+		- passwords shorter than passphraseLength must contain three of: lower case, upper case, digits, symbols
+*/
+const (
+	minPasswordLength = 10
+	maxPasswordLength = 72
+	passphraseLength  = 16
+)
+
+const PasswordPolicy = "Passwords must be 10 to 72 characters long, must not contain the username and, unless they are at least 16 characters long, must contain three of: lower case letters, upper case letters, digits and symbols."
+
+var commonPasswords = map[string]bool{
+	"password123":  true,
+	"password1234": true,
+	"passw0rd123":  true,
+	"1234567890":   true,
+	"0123456789":   true,
+	"1q2w3e4r5t":   true,
+	"qwertyuiop":   true,
+	"qwerty1234":   true,
+	"iloveyou123":  true,
+	"welcome123":   true,
+	"letmein123":   true,
+	"admin12345":   true,
+	"spacexpp123":  true,
+}
+
+func validatePassword(username string, password string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return fmt.Errorf("%w: password must contain at least %v characters", errInvalidUser, minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("%w: password must not be longer than %v bytes", errInvalidUser, maxPasswordLength)
+	}
+
+	lowerPassword := strings.ToLower(password)
+	if username != "" && strings.Contains(lowerPassword, strings.ToLower(username)) {
+		return fmt.Errorf("%w: password must not contain the username", errInvalidUser)
+	}
+	if commonPasswords[lowerPassword] {
+		return fmt.Errorf("%w: password is too common", errInvalidUser)
+	}
+
+	if len([]rune(password)) >= passphraseLength {
+		return nil
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < 3 {
+		return fmt.Errorf("%w: password must contain three of lower case letters, upper case letters, digits and symbols (or be at least %v characters long)", errInvalidUser, passphraseLength)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidatePassword(t *testing.T) {
+	type test struct {
+		username    string
+		password    string
+		expectError bool
+	}
+
+	tests := []test{
+		{"alice", "Rover-Drive7", false},
+		{"alice", "correct horse battery staple", false},
+		{"alice", "Short1!", true},
+		{"alice", "alllowercaseletters", false},
+		{"alice", "lowercase12", true},
+		{"alice", "Alice-Rover7", true},
+		{"alice", "Password123", true},
+		{"alice", "Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa1!Aa", true},
+	}
+
+	for _, test := range tests {
+		err := validatePassword(test.username, test.password)
+		if (err != nil) != test.expectError {
+			t.Errorf("validatePassword(%q, %q) returned error %v, expected error: %v", test.username, test.password, err, test.expectError)
+		}
+		if err != nil && !errors.Is(err, errInvalidUser) {
+			t.Errorf("validatePassword(%q, %q) returned error %v, expected %v", test.username, test.password, err, errInvalidUser)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	defer func(previous passwordHashing) {
+		currentPasswordHashing = previous
+	}(currentPasswordHashing)
+
+	for _, algorithm := range []string{PasswordHashBcrypt, PasswordHashArgon2id} {
+		if err := SetPasswordHashing(algorithm, bcrypt.MinCost); err != nil {
+			t.Fatalf("SetPasswordHashing(%q) returned error: %v", algorithm, err)
+		}
+
+		hash, err := hashPassword("Rover-Drive7")
+		if err != nil {
+			t.Fatalf("hashPassword with %v returned error: %v", algorithm, err)
+		}
+
+		if err := verifyPassword(hash, "Rover-Drive7"); err != nil {
+			t.Errorf("verifyPassword of correct %v password returned error: %v", algorithm, err)
+		}
+		if err := verifyPassword(hash, "Rover-Drive8"); !errors.Is(err, errIncorrectPassword) {
+			t.Errorf("verifyPassword of incorrect %v password returned error %v, expected %v", algorithm, err, errIncorrectPassword)
+		}
+	}
+
+	if err := SetPasswordHashing("md5", 0); err == nil {
+		t.Errorf("SetPasswordHashing with unknown algorithm returned no error")
+	}
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+	Replays recorded rover telemetry (instruction feedback, obstruction detections and energy readings)
+	through the same map update logic that is used for live feedback.
+
+	A replay plays back the telemetry of one recorded mission.
+	The live map is reset before a replay starts and is updated as if the rover was driving.
+	A replay therefore can't be started while the rover is connected or autonomous mode is running,
+	and routes that drive the rover or change the live map are rejected while it runs (see rejectDuringReplay).
+	Once the replay ends, the live map, rover and discovery stats are restored to their state before the replay.
+	Progress is reported through the feed.
+	Drive instructions computed during the replay (e.g. by autonomous mode) are logged but never sent to the rover.
+	Replayed map changes are not added to the tile revision history as they didn't happen on the arena.
+*/
+type telemetryRecord struct {
+	MissionID int       `json:"missionID"`
+	Timestamp time.Time `json:"timestamp"`
+	Topic     string    `json:"topic"`
+	Payload   string    `json:"payload"`
+}
+
+type replayStatus struct {
+	Running   bool    `json:"running"`
+	MissionID int     `json:"missionID"`
+	Speed     float64 `json:"speed"`
+	Processed int     `json:"processed"`
+	Total     int     `json:"total"`
+}
+
+// Replays can run at most this many times faster than recorded
+const maxReplaySpeed = 100
+
+var (
+	errReplayRunning     = errors.New("server: replay: a replay is already running")
+	errReplayRoverActive = errors.New("server: replay: the rover is connected or autonomous mode is running")
+)
+
+var replay struct {
+	sync.Mutex
+	status replayStatus
+	cancel context.CancelFunc
+}
+
+// Live state that is overwritten by a replay
+type liveSnapshot struct {
+	tileMap                 tileMap
+	rover                   rover
+	discovery               discoveryStats
+	energy                  energy
+	ballCount               balls
+	stashedDriveInstruction driveInstruction
+	stopData                string
+}
+
+func takeLiveSnapshot() liveSnapshot {
+	return liveSnapshot{
+		tileMap:                 tileMap{Map.Rows, Map.Cols, append([]int{}, Map.Tiles...)},
+		rover:                   Rover,
+		discovery:               discovery,
+		energy:                  currentEnergy,
+		ballCount:               ballCount,
+		stashedDriveInstruction: stashedDriveInstruction,
+		stopData:                stopData,
+	}
+}
+
+func (s liveSnapshot) restore() {
+	Map = s.tileMap
+	Rover = s.rover
+	discovery = s.discovery
+	currentEnergy = s.energy
+	ballCount = s.ballCount
+	stashedDriveInstruction = s.stashedDriveInstruction
+	stopData = s.stopData
+}
+
+// Used instead of the MQTT client during a replay so that nothing is sent to the rover
+type replayMQTT struct {
+	logger *zap.Logger
+}
+
+func (m *replayMQTT) getLogger() *zap.Logger {
+	return m.logger
+}
+
+func (m *replayMQTT) Connect() error {
+	return nil
+}
+
+func (m *replayMQTT) Disconnect() {}
+
+func (m *replayMQTT) publish(topic string, data string, qos byte) {
+	m.logger.Info("replay: suppressed mqtt publish", zap.String("topic", topic), zap.String("data", data))
+}
+
+func (m *replayMQTT) publishDriveInstructionSequence(ctx context.Context, instructionSequence driveInstructions) {
+	m.logger.Info("replay: suppressed drive instruction sequence", append(correlationFields(getRequestID(ctx), ""), zap.Array("instructionSequence", &instructionSequence))...)
+}
+
+func (m *replayMQTT) getIsConnected() bool {
+	return false
+}
+
+func (m *replayMQTT) getIsSubscribed() bool {
+	return false
+}
+
+// Used instead of the server DB during a replay so that replayed instructions and telemetry are not recorded a second time
+
+type replayDB struct {
+	DB
+}
+
+func (d *replayDB) storeInstruction(ctx context.Context, missionID int, instruction string, value int) error {
+	return nil
+}
+
+func (d *replayDB) insertTelemetry(ctx context.Context, missionID int, topic string, payload string) error {
+	return nil
+}
+
+func validateReplaySpeed(speed float64) error {
+	if speed < 0 || speed > maxReplaySpeed {
+		return &validationError{"speed", "must be between 0 and " + strconv.Itoa(maxReplaySpeed)}
+	}
+	return nil
+}
+
+// speed is a multiplier on the recorded timing (2 = twice as fast). Records are replayed back to back if speed is 0.
+func startReplay(ctx context.Context, logger *zap.Logger, db DB, mqtt MQTT, missionID int, speed float64) error {
+	if err := validateReplaySpeed(speed); err != nil {
+		return err
+	}
+
+	records, err := db.getTelemetry(ctx, missionID)
+	if err != nil {
+		return fmt.Errorf("server: replay: failed to get telemetry: %w", err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("server: replay: no telemetry recorded for mission %v", missionID)
+	}
+
+	replay.Lock()
+	defer replay.Unlock()
+
+	if replay.status.Running {
+		return errReplayRunning
+	}
+	if mqtt.getIsConnected() || !stopAutonomous {
+		return errReplayRoverActive
+	}
+
+	// Changes to the live map made before the replay belong to the history, replayed changes don't
+	if err := recordMapRevisions(ctx, db); err != nil {
+		return fmt.Errorf("server: replay: failed to record map revisions: %w", err)
+	}
+	setRevisionsPaused(true)
+	snapshot := takeLiveSnapshot()
+
+	replayCtx, cancel := context.WithCancel(ctx)
+	replay.cancel = cancel
+	replay.status = replayStatus{
+		Running:   true,
+		MissionID: missionID,
+		Speed:     speed,
+		Total:     len(records),
+	}
+
+	// Start from the same state as the recorded run
+	Map.Tiles = defaultTiles(Map.Rows, Map.Cols)
+	resetRover()
+	stashedDriveInstruction = driveInstruction{}
+	stopData = ""
+	resetDiscoveryStats()
+
+	addToFeed("<br> <br> Replay of mission " + strconv.Itoa(missionID) + " started: " + strconv.Itoa(len(records)) + " recorded messages")
+
+	go runReplay(replayCtx, logger, &replayDB{db}, records, snapshot)
+
+	return nil
+}
+
+func runReplay(ctx context.Context, logger *zap.Logger, db DB, records []telemetryRecord, snapshot liveSnapshot) {
+	mqttClient := &replayMQTT{
+		logger: logger,
+	}
+
+	// The live state is restored before routes that change it are accepted again
+	defer func() {
+		snapshot.restore()
+		setRevisionsPaused(false)
+
+		replay.Lock()
+		replay.status.Running = false
+		replay.cancel = nil
+		replay.Unlock()
+
+		addToFeed("<br> <br> Live map restored after replay")
+	}()
+
+	previous := records[0].Timestamp
+	for i, record := range records {
+		replay.Lock()
+		speed := replay.status.Speed
+		replay.Unlock()
+
+		if speed > 0 {
+			delay := time.Duration(float64(record.Timestamp.Sub(previous)) / speed)
+			select {
+			case <-ctx.Done():
+				addToFeed("<br> <br> Replay stopped")
+				return
+			case <-time.After(delay):
+			}
+		} else if ctx.Err() != nil {
+			addToFeed("<br> <br> Replay stopped")
+			return
+		}
+		previous = record.Timestamp
+
+		switch record.Topic {
+		case "/feedback/instruction":
+			handleInstructionFeedback(mqttClient, ctx, db, record.Payload)
+		case "/energy/status":
+			handleEnergyStatus(logger, record.Payload)
+		default:
+			logger.Info("replay: skipping message from unknown topic", zap.String("topic", record.Topic))
+		}
+
+		replay.Lock()
+		replay.status.Processed = i + 1
+		replay.Unlock()
+	}
+
+	addToFeed("<br> <br> Replay finished")
+}
+
+func stopReplay() error {
+	replay.Lock()
+	defer replay.Unlock()
+
+	if !replay.status.Running {
+		return errors.New("server: replay: no replay is running")
+	}
+
+	replay.cancel()
+	return nil
+}
+
+func setReplaySpeed(speed float64) error {
+	if err := validateReplaySpeed(speed); err != nil {
+		return err
+	}
+
+	replay.Lock()
+	defer replay.Unlock()
+
+	replay.status.Speed = speed
+	return nil
+}
+
+func isReplayRunning() bool {
+	replay.Lock()
+	defer replay.Unlock()
+
+	return replay.status.Running
+}
+
+func getReplayStatus() replayStatus {
+	replay.Lock()
+	defer replay.Unlock()
+
+	return replay.status
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MQTT client of a connected rover
+type connectedMQTT struct {
+	replayMQTT
+}
+
+func (m *connectedMQTT) getIsConnected() bool {
+	return true
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenDB(ctx, zap.NewNop(), t.TempDir()+"/serverDB.db")
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	liveMap := tileMap{Map.Rows, Map.Cols, append([]int{}, Map.Tiles...)}
+	liveRover := Rover
+	defer func() {
+		Map = liveMap
+		Rover = liveRover
+	}()
+
+	const missionID = 7
+	for _, payload := range []string{"F:60", "X:0"} {
+		if err := db.insertTelemetry(ctx, missionID, "/feedback/instruction", payload); err != nil {
+			t.Fatalf("failed to insert telemetry: %v", err)
+		}
+	}
+	if err := db.insertTelemetry(ctx, missionID+1, "/feedback/instruction", "F:30"); err != nil {
+		t.Fatalf("failed to insert telemetry: %v", err)
+	}
+
+	// Live map edit that is still pending when the replay starts
+	editIndx := Map.Cols + 1
+	setTile(editIndx, 2, causeManual, "user")
+	editedMap := tileMap{Map.Rows, Map.Cols, append([]int{}, Map.Tiles...)}
+
+	mqtt := &replayMQTT{logger: zap.NewNop()}
+
+	if err := startReplay(ctx, zap.NewNop(), db, &connectedMQTT{*mqtt}, missionID, 0); !errors.Is(err, errReplayRoverActive) {
+		t.Errorf("startReplay with a connected rover returned error %v, expected %v", err, errReplayRoverActive)
+	}
+	stopAutonomous = false
+	err = startReplay(ctx, zap.NewNop(), db, mqtt, missionID, 0)
+	stopAutonomous = true
+	if !errors.Is(err, errReplayRoverActive) {
+		t.Errorf("startReplay in autonomous mode returned error %v, expected %v", err, errReplayRoverActive)
+	}
+	if err := startReplay(ctx, zap.NewNop(), db, mqtt, missionID, maxReplaySpeed+1); err == nil {
+		t.Errorf("startReplay with speed %v did not return error", maxReplaySpeed+1)
+	}
+	if err := startReplay(ctx, zap.NewNop(), db, mqtt, missionID+2, 0); err == nil {
+		t.Errorf("startReplay of mission without telemetry did not return error")
+	}
+
+	if err := startReplay(ctx, zap.NewNop(), db, mqtt, missionID, 0); err != nil {
+		t.Fatalf("startReplay returned error: %v", err)
+	}
+	revisionID, err := db.getLatestRevisionID(ctx)
+	if err != nil {
+		t.Fatalf("failed to get latest revision: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for getReplayStatus().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("replay did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status := getReplayStatus(); status.Processed != 2 || status.MissionID != missionID {
+		t.Errorf("Replay processed %v records of mission %v, expected 2 of mission %v", status.Processed, status.MissionID, missionID)
+	}
+	if !reflect.DeepEqual(Map, editedMap) || Rover != liveRover {
+		t.Errorf("Live state not restored after replay.\nOutput map: %v\nExpected map: %v\nOutput rover: %+v\nExpected rover: %+v", Map, editedMap, Rover, liveRover)
+	}
+
+	// The pending edit is recorded before the replay, replayed changes are not recorded at all
+	revisions, err := db.getTileRevisions(ctx, 0, revisionID)
+	if err != nil || len(revisions) == 0 || revisions[len(revisions)-1].Indx != editIndx {
+		t.Errorf("getTileRevisions returned %+v, %v, expected the live map edit last", revisions, err)
+	}
+	if err := recordMapRevisions(ctx, db); err != nil {
+		t.Fatalf("failed to record map revisions: %v", err)
+	}
+	if latest, err := db.getLatestRevisionID(ctx); err != nil || latest != revisionID {
+		t.Errorf("Replay recorded tile revisions up to %v (error: %v), expected none after %v", latest, err, revisionID)
+	}
+	if records, err := db.getTelemetry(ctx, missionID); err != nil || len(records) != 2 {
+		t.Errorf("Replay changed the recorded telemetry to %v records (error: %v), expected 2", len(records), err)
+	}
+}
+
+func TestRejectDuringReplay(t *testing.T) {
+	type test struct {
+		running        bool
+		expectedStatus int
+	}
+
+	tests := []test{
+		{false, http.StatusOK},
+		{true, http.StatusConflict},
+	}
+
+	h := &HttpServer{logger: zap.NewNop()}
+	handler := h.rejectDuringReplay(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range tests {
+		replay.Lock()
+		replay.status.Running = test.running
+		replay.Unlock()
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/map/edit/tile", nil))
+		if w.Code != test.expectedStatus {
+			t.Errorf("Status not equal to expected status while running is %v.\nOutput status: %v\nExpected status: %v", test.running, w.Code, test.expectedStatus)
+		}
+	}
+
+	replay.Lock()
+	replay.status.Running = false
+	replay.Unlock()
+}
+
+func TestValidateReplaySpeed(t *testing.T) {
+	type test struct {
+		speed       float64
+		expectError bool
+	}
+
+	tests := []test{
+		{0, false},
+		{0.5, false},
+		{maxReplaySpeed, false},
+		{-1, true},
+		{maxReplaySpeed + 0.5, true},
+	}
+
+	for _, test := range tests {
+		if err := validateReplaySpeed(test.speed); (err != nil) != test.expectError {
+			t.Errorf("validateReplaySpeed(%v) returned error %v, expected error: %v", test.speed, err, test.expectError)
+		}
+	}
+}
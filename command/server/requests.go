@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+/*
+	Decoding and validation of request bodies and the error format of all routes.
+	Handlers decode their body with decodeRequest and return as soon as it fails, the error response has been written by then:
+		var req driveAngleRequest
+		if !h.decodeRequest(w, r, &req) {
+			return
+		}
+	Request types that implement validator are validated after decoding.
+	Every error response is an errorResponse, clients should use the code rather than the message.
+*/
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`     // request field that failed validation
+	RequestID string `json:"requestID,omitempty"` // for finding the request in the server logs
+}
+
+// Error codes
+const (
+	errCodeBadRequest   = "bad_request"
+	errCodeInvalidBody  = "invalid_body"  // body is missing, too large or not JSON of the expected type
+	errCodeInvalidValue = "invalid_value" // a value is out of bounds (see validationError)
+	errCodeUnauthorized = "unauthorized"
+	errCodeForbidden    = "forbidden"
+	errCodeNotFound     = "not_found"
+	errCodeMethod       = "method_not_allowed"
+	errCodeConflict     = "conflict"
+	errCodeRateLimited  = "rate_limited"
+	errCodeInternal     = "internal_error"
+	errCodeUnavailable  = "unavailable"
+)
+
+// Maximum size of JSON request bodies (bytes), map imports have their own limit
+const maxRequestBodySize = 1 << 16
+
+type validator interface {
+	validate() error
+}
+
+// Value of a request field that is out of bounds
+type validationError struct {
+	field   string
+	message string
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("server: requests: invalid %v: %v", e.field, e.message)
+}
+
+/*
+	Decodes the JSON body into v and validates it if v implements validator.
+	An empty or null body, unknown object fields and trailing data are rejected.
+	Returns false after writing the error response.
+*/
+func (h *HttpServer) decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	defer r.Body.Close()
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, errorResponse{
+				Code:    errCodeInvalidBody,
+				Message: fmt.Sprintf("request body must not be larger than %v bytes", maxRequestBodySize),
+			})
+			return false
+		}
+		h.writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    errCodeInvalidBody,
+			Message: fmt.Sprintf("failed to read request body: %v", err),
+		})
+		return false
+	}
+
+	if err := decodeJSON(data, v); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    errCodeInvalidBody,
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	if val, ok := v.(validator); ok {
+		if err := val.validate(); err != nil {
+			h.writeValidationError(w, r, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return errors.New("server: requests: request body is required")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("server: requests: invalid request body: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("server: requests: invalid request body: unexpected data after JSON value")
+	}
+	return nil
+}
+
+// Error response with the code of the status
+func (h *HttpServer) writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	h.writeErrorResponse(w, r, status, errorResponse{
+		Code:    statusErrorCode(status),
+		Message: message,
+	})
+}
+
+// Bad request with the field of a validationError
+func (h *HttpServer) writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	resp := errorResponse{
+		Code:    errCodeInvalidValue,
+		Message: err.Error(),
+	}
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		resp.Field = validationErr.field
+	}
+	h.writeErrorResponse(w, r, http.StatusBadRequest, resp)
+}
+
+func (h *HttpServer) writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, resp errorResponse) {
+	resp.RequestID = getRequestID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.requestLogger(r).Error("server: requests: failed to encode error response", zap.Error(err))
+	}
+}
+
+func statusErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return errCodeBadRequest
+	case http.StatusUnauthorized:
+		return errCodeUnauthorized
+	case http.StatusForbidden:
+		return errCodeForbidden
+	case http.StatusNotFound:
+		return errCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return errCodeMethod
+	case http.StatusConflict:
+		return errCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return errCodeInvalidBody
+	case http.StatusTooManyRequests:
+		return errCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return errCodeUnavailable
+	}
+	if status >= 500 {
+		return errCodeInternal
+	}
+	return errCodeBadRequest
+}
+
+func (h *HttpServer) notFound(w http.ResponseWriter, r *http.Request) {
+	h.writeError(w, r, http.StatusNotFound, "route not found")
+}
+
+func (h *HttpServer) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	h.writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// Writes v as JSON, the status must be written before the body
+func (h *HttpServer) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.requestLogger(r).Error("server: requests: failed to encode response", zap.Error(err))
+	}
+}
+
+// Bounds checks of driving and map requests
+
+// Drive distances are in cm
+func validateDistance(distance int) error {
+	if distance < 0 {
+		return &validationError{"distance", "must not be negative"}
+	}
+	return nil
+}
+
+// Turn angles are in degrees, the rover only turns in steps of 90 degrees
+func validateAngle(angle int) error {
+	if angle%90 != 0 {
+		return &validationError{"angle", "must be a multiple of 90"}
+	}
+	if angle < -360 || angle > 360 {
+		return &validationError{"angle", "must be between -360 and 360"}
+	}
+	return nil
+}
+
+func validateTarget(x int, y int, mode int, tileMap tileMap) error {
+	if x < 0 || x >= tileMap.Cols {
+		return &validationError{"x", fmt.Sprintf("must be between 0 and %v", tileMap.Cols-1)}
+	}
+	if y < 0 || y >= tileMap.Rows {
+		return &validationError{"y", fmt.Sprintf("must be between 0 and %v", tileMap.Rows-1)}
+	}
+	if _, err := value2Mode(mode); err != nil {
+		return &validationError{"mode", "must be 0 (simple), 1 (full discovery) or 2 (destination discovery)"}
+	}
+	return nil
+}
+
+func validateMapName(name string) error {
+	if name == "" {
+		return &validationError{"name", "is required"}
+	}
+	return nil
+}
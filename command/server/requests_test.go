@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type test struct {
+		input       string
+		v           interface{}
+		expectError bool
+	}
+
+	tests := []test{
+		{"90", new(int), false},
+		{" \n90\n", new(int), false},
+		{`{"distance": 10}`, &driveDistanceRequest{}, false},
+		{"", new(int), true},
+		{"null", new(int), true},
+		{`"90"`, new(int), true},
+		{"90 180", new(int), true},
+		{`{"distance": 10}{}`, &driveDistanceRequest{}, true},
+		{`{"distance": 10, "speed": 2}`, &driveDistanceRequest{}, true},
+		{`{"distance": 10.5}`, &driveDistanceRequest{}, true},
+	}
+
+	for _, test := range tests {
+		err := decodeJSON([]byte(test.input), test.v)
+		if (err != nil) != test.expectError {
+			t.Errorf("decodeJSON of %q returned error %v, expected error: %v", test.input, err, test.expectError)
+		}
+	}
+}
+
+func TestValidateDriveRequests(t *testing.T) {
+	type test struct {
+		name          string
+		err           error
+		expectedField string // empty if valid
+	}
+
+	tileMap := tileMap{Rows: 12, Cols: 10}
+	tests := []test{
+		{"distance 0", validateDistance(0), ""},
+		{"distance 50", validateDistance(50), ""},
+		{"distance -1", validateDistance(-1), "distance"},
+		{"angle 90", validateAngle(90), ""},
+		{"angle -270", validateAngle(-270), ""},
+		{"angle 360", validateAngle(360), ""},
+		{"angle 45", validateAngle(45), "angle"},
+		{"angle 450", validateAngle(450), "angle"},
+		{"target (0, 0)", validateTarget(0, 0, 0, tileMap), ""},
+		{"target (9, 11)", validateTarget(9, 11, 2, tileMap), ""},
+		{"target (10, 0)", validateTarget(10, 0, 0, tileMap), "x"},
+		{"target (-1, 0)", validateTarget(-1, 0, 0, tileMap), "x"},
+		{"target (0, 12)", validateTarget(0, 12, 0, tileMap), "y"},
+		{"target mode 3", validateTarget(0, 0, 3, tileMap), "mode"},
+	}
+
+	for _, test := range tests {
+		if test.expectedField == "" {
+			if test.err != nil {
+				t.Errorf("%v returned error %v, expected valid", test.name, test.err)
+			}
+			continue
+		}
+
+		var validationErr *validationError
+		if !errors.As(test.err, &validationErr) || validationErr.field != test.expectedField {
+			t.Errorf("%v returned error %v, expected invalid %v", test.name, test.err, test.expectedField)
+		}
+	}
+}
+
+// Legacy driving routes must stop after an invalid request instead of driving with zero values
+func TestDriveRequestErrors(t *testing.T) {
+	type test struct {
+		handler         string
+		body            string
+		expectedStatus  int
+		expectedCode    string
+		expectedField   string
+		expectedPublish int
+	}
+
+	tests := []test{
+		{"driveD", "20", http.StatusOK, "", "", 1},
+		{"driveD", "-20", http.StatusBadRequest, errCodeInvalidValue, "distance", 0},
+		{"driveD", "null", http.StatusBadRequest, errCodeInvalidBody, "", 0},
+		{"driveA", "-90", http.StatusOK, "", "", 1},
+		{"driveA", "45", http.StatusBadRequest, errCodeInvalidValue, "angle", 0},
+		{"driveA", `"left"`, http.StatusBadRequest, errCodeInvalidBody, "", 0},
+		{"targetCoords", `{"x": 40, "y": 2, "mode": 0}`, http.StatusBadRequest, errCodeInvalidValue, "x", 0},
+		{"targetCoords", `{"x": 2, "y": 2, "mode": 7}`, http.StatusBadRequest, errCodeInvalidValue, "mode", 0},
+		{"targetCoords", `{"x": 2, "y": 2}{}`, http.StatusBadRequest, errCodeInvalidBody, "", 0},
+		{"stopAutonom", `"yes"`, http.StatusBadRequest, errCodeInvalidBody, "", 0},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		core, logs := observer.New(zap.InfoLevel)
+		h := &HttpServer{logger: zap.NewNop(), mqtt: &replayMQTT{logger: zap.New(core)}}
+		handlers := map[string]http.HandlerFunc{
+			"driveD":       h.driveD,
+			"driveA":       h.driveA(ctx),
+			"targetCoords": h.targetCoords,
+			"stopAutonom":  h.stopAutonom,
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+		r = r.WithContext(withRequestID(r.Context(), "request-1"))
+		w := httptest.NewRecorder()
+		handlers[test.handler](w, r)
+
+		if w.Code != test.expectedStatus {
+			t.Errorf("%v with body %q returned status %v, expected %v", test.handler, test.body, w.Code, test.expectedStatus)
+			continue
+		}
+		if published := logs.FilterMessage("replay: suppressed drive instruction sequence").Len(); published != test.expectedPublish {
+			t.Errorf("%v with body %q published %v instruction sequences, expected %v", test.handler, test.body, published, test.expectedPublish)
+		}
+		if test.expectedCode == "" {
+			continue
+		}
+
+		var resp errorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%v with body %q returned invalid error response %q: %v", test.handler, test.body, w.Body.String(), err)
+			continue
+		}
+		if resp.Code != test.expectedCode || resp.Field != test.expectedField || resp.RequestID != "request-1" {
+			t.Errorf("%v with body %q returned error %+v, expected code %v and field %q", test.handler, test.body, resp, test.expectedCode, test.expectedField)
+		}
+	}
+}
+
+// Only bodies over the size limit are rejected as too large, other read errors are bad requests
+func TestDecodeRequestBodyErrors(t *testing.T) {
+	type test struct {
+		name           string
+		body           io.Reader
+		expectedStatus int
+	}
+
+	tests := []test{
+		{"valid", strings.NewReader("20"), http.StatusOK},
+		{"too large", strings.NewReader(strings.Repeat(" ", maxRequestBodySize+1)), http.StatusRequestEntityTooLarge},
+		{"read error", iotest.ErrReader(errors.New("connection reset")), http.StatusBadRequest},
+	}
+
+	h := &HttpServer{logger: zap.NewNop()}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", test.body)
+		w := httptest.NewRecorder()
+
+		var distance int
+		if h.decodeRequest(w, r, &distance) {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		if w.Code != test.expectedStatus {
+			t.Errorf("%v: decodeRequest returned status %v, expected %v", test.name, w.Code, test.expectedStatus)
+		}
+	}
+}
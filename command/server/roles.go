@@ -0,0 +1,40 @@
+package server
+
+import "fmt"
+
+/*
+	Roles of users of the HTTP API. Every role includes the permissions of the roles below it.
+		- viewer: read-only access to the map, rover and telemetry
+		- operator: can also drive the rover and edit and save maps
+		- admin: can also manage users
+*/
+type role string
+
+const (
+	roleViewer   role = "viewer"
+	roleOperator role = "operator"
+	roleAdmin    role = "admin"
+)
+
+var roleLevels = map[role]int{
+	roleViewer:   1,
+	roleOperator: 2,
+	roleAdmin:    3,
+}
+
+func parseRole(s string) (role, error) {
+	r := role(s)
+	if _, ok := roleLevels[r]; !ok {
+		return "", fmt.Errorf("server: roles: unknown role %q (viewer, operator or admin)", s)
+	}
+	return r, nil
+}
+
+// Returns true if the role has at least the permissions of the required role
+func (r role) includes(required role) bool {
+	level, ok := roleLevels[r]
+	if !ok {
+		return false
+	}
+	return level >= roleLevels[required]
+}
@@ -0,0 +1,55 @@
+package server
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	type test struct {
+		r        role
+		required role
+		expected bool
+	}
+
+	tests := []test{
+		{roleViewer, roleViewer, true},
+		{roleViewer, roleOperator, false},
+		{roleViewer, roleAdmin, false},
+		{roleOperator, roleViewer, true},
+		{roleOperator, roleOperator, true},
+		{roleOperator, roleAdmin, false},
+		{roleAdmin, roleViewer, true},
+		{roleAdmin, roleOperator, true},
+		{roleAdmin, roleAdmin, true},
+		{role(""), roleViewer, false},
+		{role("pilot"), roleViewer, false},
+	}
+
+	for _, test := range tests {
+		output := test.r.includes(test.required)
+		if output != test.expected {
+			t.Errorf("%q includes %q not equal to expected value.\nOutput: %v\nExpected: %v", test.r, test.required, output, test.expected)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	type test struct {
+		input       string
+		expected    role
+		expectError bool
+	}
+
+	tests := []test{
+		{"viewer", roleViewer, false},
+		{"operator", roleOperator, false},
+		{"admin", roleAdmin, false},
+		{"Admin", "", true},
+		{"", "", true},
+	}
+
+	for _, test := range tests {
+		output, err := parseRole(test.input)
+		if (err != nil) != test.expectError || output != test.expected {
+			t.Errorf("parseRole(%q) returned %q, %v, expected %q (error: %v)", test.input, output, err, test.expected, test.expectError)
+		}
+	}
+}
@@ -8,4 +8,4 @@ mkdir -p bin db
 
 make credentials
 
-./bin/credentials -db ${DB_NAME}
+./bin/credentials -db ${DB_NAME} "${@:2}"
@@ -8,7 +8,7 @@ HTTP_TLS_KEY_FILE="${3:-cert/server.key}"
 MQTT_BROKER_URL="${4:-ssl://18.130.239.157:8883}"
 MQTT_USERNAME="${5:-spaceXpp_server}"
 MQTT_PASSWORD="${6:-mqtt}"
-DB_NAME="${7:-serverDB.db}"
+DB_NAME="${7:-db/serverDB.db}"
 
 mkdir -p bin db
 
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Token based sessions as an alternative to sending basic auth credentials with every request.
+
+	Logging in creates a session and returns two tokens:
+		- access token: short-lived JWT (HS256) that is sent as "Authorization: Bearer <token>"
+		- refresh token: long-lived opaque token ("<sessionID>.<secret>") that is exchanged for new tokens
+	Only a hash of the refresh token is stored. Every refresh replaces the refresh token of the session.
+	Logging out revokes the session which invalidates both its refresh token and its access tokens.
+*/
+const (
+	accessTokenLifetime  = 15 * time.Minute
+	refreshTokenLifetime = 7 * 24 * time.Hour
+)
+
+var (
+	errInvalidToken   = errors.New("server: tokens: invalid token")
+	errExpiredToken   = errors.New("server: tokens: token expired")
+	errRevokedSession = errors.New("server: tokens: session revoked")
+
+	errSessionNotFound = errors.New("server: tokens: session does not exist")
+)
+
+type session struct {
+	SessionID        string
+	Username         string
+	RefreshTokenHash string
+	Created          time.Time
+	Expires          time.Time
+	Revoked          bool
+}
+
+type accessTokenClaims struct {
+	Username  string `json:"sub"`
+	Role      role   `json:"role"`
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	Expires   int64  `json:"exp"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"` // seconds until the access token expires
+	Role         role   `json:"role"`
+}
+
+type tokenIssuer struct {
+	key []byte
+
+	// Revoked sessions whose access tokens may not have expired yet, mapped to the time when all of them have expired
+	revoked sync.Map
+}
+
+// Tokens signed with a random key become invalid when the server restarts (refresh tokens stay valid)
+func newTokenIssuer(key []byte) (*tokenIssuer, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("server: tokens: failed to generate signing key: %w", err)
+		}
+	}
+
+	return &tokenIssuer{
+		key: key,
+	}, nil
+}
+
+// Loads sessions that were revoked while their access tokens may still be valid
+func (t *tokenIssuer) loadRevokedSessions(ctx context.Context, db DB) error {
+	sessionIDs, err := db.getRevokedSessionIDs(ctx, time.Now().Add(-accessTokenLifetime))
+	if err != nil {
+		return fmt.Errorf("server: tokens: failed to get revoked sessions: %w", err)
+	}
+
+	now := time.Now()
+	for _, sessionID := range sessionIDs {
+		t.revoke(sessionID, now)
+	}
+
+	return nil
+}
+
+// Rejects the access tokens of a session and forgets sessions whose access tokens have all expired
+func (t *tokenIssuer) revoke(sessionID string, now time.Time) {
+	t.revoked.Store(sessionID, now.Add(accessTokenLifetime))
+
+	t.revoked.Range(func(sessionID, expires interface{}) bool {
+		if !now.Before(expires.(time.Time)) {
+			t.revoked.Delete(sessionID)
+		}
+		return true
+	})
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (t *tokenIssuer) signAccessToken(claims accessTokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("server: tokens: failed to marshal claims: %w", err)
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(t.signature(unsigned)), nil
+}
+
+func (t *tokenIssuer) signature(unsigned string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func (t *tokenIssuer) verifyAccessToken(token string, now time.Time) (accessTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return accessTokenClaims{}, errInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.signature(parts[0]+"."+parts[1])) {
+		return accessTokenClaims{}, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return accessTokenClaims{}, errInvalidToken
+	}
+
+	var claims accessTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return accessTokenClaims{}, errInvalidToken
+	}
+
+	if now.Unix() >= claims.Expires {
+		return accessTokenClaims{}, errExpiredToken
+	}
+	if _, revoked := t.revoked.Load(claims.SessionID); revoked {
+		return accessTokenClaims{}, errRevokedSession
+	}
+
+	return claims, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("server: tokens: failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func splitRefreshToken(refreshToken string) (sessionID string, secret string, err error) {
+	parts := strings.Split(refreshToken, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errInvalidToken
+	}
+	return parts[0], parts[1], nil
+}
+
+// Creates a new session for an authenticated user
+func (t *tokenIssuer) login(ctx context.Context, db DB, cred credential) (tokenResponse, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	now := time.Now().UTC()
+	if err := db.insertSession(ctx, session{
+		SessionID:        sessionID,
+		Username:         cred.username,
+		RefreshTokenHash: hashRefreshSecret(secret),
+		Created:          now,
+		Expires:          now.Add(refreshTokenLifetime),
+	}); err != nil {
+		return tokenResponse{}, fmt.Errorf("server: tokens: failed to insert session: %w", err)
+	}
+
+	return t.issue(cred, sessionID, secret, now)
+}
+
+/*
+	Exchanges a refresh token for new tokens. The old refresh token can't be used again.
+	Also returns the username of the session.
+*/
+func (t *tokenIssuer) refresh(ctx context.Context, db DB, creds *credentialStore, refreshToken string) (tokenResponse, string, error) {
+	s, err := t.validateRefreshToken(ctx, db, refreshToken)
+	if err != nil {
+		return tokenResponse{}, "", err
+	}
+
+	// Disabled or removed users can't refresh
+	cred, ok, err := creds.lookup(ctx, s.Username)
+	if err != nil {
+		return tokenResponse{}, s.Username, fmt.Errorf("server: tokens: failed to look up credentials: %w", err)
+	}
+	if !ok {
+		return tokenResponse{}, s.Username, errInvalidToken
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return tokenResponse{}, s.Username, err
+	}
+
+	now := time.Now().UTC()
+	if err := db.updateSessionRefreshToken(ctx, s.SessionID, hashRefreshSecret(secret), now.Add(refreshTokenLifetime)); err != nil {
+		return tokenResponse{}, s.Username, fmt.Errorf("server: tokens: failed to update session: %w", err)
+	}
+
+	tokens, err := t.issue(cred, s.SessionID, secret, now)
+	return tokens, s.Username, err
+}
+
+// Revokes the session of a refresh token and returns the username of the session
+func (t *tokenIssuer) logout(ctx context.Context, db DB, refreshToken string) (string, error) {
+	s, err := t.validateRefreshToken(ctx, db, refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.revokeSession(ctx, s.SessionID); err != nil {
+		return s.Username, fmt.Errorf("server: tokens: failed to revoke session: %w", err)
+	}
+	t.revoke(s.SessionID, time.Now())
+
+	return s.Username, nil
+}
+
+func (t *tokenIssuer) validateRefreshToken(ctx context.Context, db DB, refreshToken string) (session, error) {
+	sessionID, secret, err := splitRefreshToken(refreshToken)
+	if err != nil {
+		return session{}, err
+	}
+
+	s, err := db.getSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			return session{}, errInvalidToken
+		}
+		return session{}, fmt.Errorf("server: tokens: failed to get session: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(s.RefreshTokenHash), []byte(hashRefreshSecret(secret))) != 1 {
+		return session{}, errInvalidToken
+	}
+	if s.Revoked {
+		return session{}, errRevokedSession
+	}
+	if !time.Now().Before(s.Expires) {
+		return session{}, errExpiredToken
+	}
+
+	return s, nil
+}
+
+func (t *tokenIssuer) issue(cred credential, sessionID string, secret string, now time.Time) (tokenResponse, error) {
+	accessToken, err := t.signAccessToken(accessTokenClaims{
+		Username:  cred.username,
+		Role:      cred.role,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		Expires:   now.Add(accessTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: sessionID + "." + secret,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenLifetime.Seconds()),
+		Role:         cred.role,
+	}, nil
+}
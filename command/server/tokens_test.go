@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifyAccessToken(t *testing.T) {
+	type test struct {
+		name          string
+		token         string
+		now           time.Time
+		expected      accessTokenClaims
+		expectedError error
+	}
+
+	issuer, err := newTokenIssuer([]byte("test key"))
+	if err != nil {
+		t.Fatalf("failed to create token issuer: %v", err)
+	}
+	otherIssuer, err := newTokenIssuer([]byte("other key"))
+	if err != nil {
+		t.Fatalf("failed to create token issuer: %v", err)
+	}
+
+	issued := time.Unix(1600000000, 0)
+	claims := accessTokenClaims{
+		Username:  "user",
+		Role:      roleOperator,
+		SessionID: "session",
+		IssuedAt:  issued.Unix(),
+		Expires:   issued.Add(accessTokenLifetime).Unix(),
+	}
+	revokedClaims := claims
+	revokedClaims.SessionID = "revoked"
+	issuer.revoke("revoked", issued)
+
+	token, _ := issuer.signAccessToken(claims)
+	revokedToken, _ := issuer.signAccessToken(revokedClaims)
+	otherToken, _ := otherIssuer.signAccessToken(claims)
+
+	// Changed role with the original signature
+	adminClaims := claims
+	adminClaims.Role = roleAdmin
+	adminToken, _ := issuer.signAccessToken(adminClaims)
+	tamperedToken := adminToken[:len(adminToken)-43] + token[len(token)-43:]
+
+	tests := []test{
+		{"valid", token, issued.Add(time.Minute), claims, nil},
+		{"expired", token, issued.Add(accessTokenLifetime), accessTokenClaims{}, errExpiredToken},
+		{"revoked", revokedToken, issued.Add(time.Minute), accessTokenClaims{}, errRevokedSession},
+		{"other key", otherToken, issued.Add(time.Minute), accessTokenClaims{}, errInvalidToken},
+		{"tampered", tamperedToken, issued.Add(time.Minute), accessTokenClaims{}, errInvalidToken},
+		{"malformed", "not.a token", issued.Add(time.Minute), accessTokenClaims{}, errInvalidToken},
+		{"empty", "", issued.Add(time.Minute), accessTokenClaims{}, errInvalidToken},
+	}
+
+	for _, test := range tests {
+		output, err := issuer.verifyAccessToken(test.token, test.now)
+		if !errors.Is(err, test.expectedError) {
+			t.Errorf("%s: verifyAccessToken returned error %v, expected %v", test.name, err, test.expectedError)
+		}
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("%s: Claims not equal to expected claims.\nOutput claims: %+v\nExpected claims: %+v", test.name, output, test.expected)
+		}
+	}
+}
+
+// Sessions are forgotten once all of their access tokens have expired
+func TestRevokedSessionsArePruned(t *testing.T) {
+	issuer, err := newTokenIssuer([]byte("test key"))
+	if err != nil {
+		t.Fatalf("failed to create token issuer: %v", err)
+	}
+
+	revoked := time.Unix(1600000000, 0)
+	issuer.revoke("old", revoked)
+	issuer.revoke("recent", revoked.Add(time.Minute))
+	issuer.revoke("new", revoked.Add(accessTokenLifetime))
+
+	sessionIDs := map[string]bool{}
+	issuer.revoked.Range(func(sessionID, _ interface{}) bool {
+		sessionIDs[sessionID.(string)] = true
+		return true
+	})
+	expected := map[string]bool{"recent": true, "new": true}
+	if !reflect.DeepEqual(sessionIDs, expected) {
+		t.Errorf("Revoked sessions not equal to expected sessions.\nOutput sessions: %v\nExpected sessions: %v", sessionIDs, expected)
+	}
+}
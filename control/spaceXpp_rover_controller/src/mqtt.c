@@ -83,6 +83,9 @@ void mqtt_init()
 void subscribe_to_mqtt_topics() {
     int msg_id = esp_mqtt_client_subscribe(mqttClient, "/drive/instruction", 2);
     ESP_LOGI(MQTT_tag, "sent subscribe successful for path '/drive/instruction', msg_id=%d", msg_id);
+
+    msg_id = esp_mqtt_client_subscribe(mqttClient, "/drive/stop", 2);
+    ESP_LOGI(MQTT_tag, "sent subscribe successful for path '/drive/stop', msg_id=%d", msg_id);
 }
 
 void handle_mqtt_event_data(esp_mqtt_event_handle_t event) {
@@ -96,6 +99,11 @@ void handle_mqtt_event_data(esp_mqtt_event_handle_t event) {
 
         // Block for 10 ticks if queue is full
         xQueueSend(driveInstructionQueue, (void*)data, (TickType_t)10);
+    } else if (strcmp(topic, "/drive/stop") == 0) {
+        ESP_LOGI(MQTT_tag, "MQTT_EVENT_DATA: data from topic: %s", topic);
+
+        // Sent by the server when it shuts down, the current instruction is still completed
+        flush_drive_instruction_queue();
     } else {
         ESP_LOGE(MQTT_tag, "MQTT_EVENT_DATA: Unknown topic: %s", topic);
     }